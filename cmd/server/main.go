@@ -1,21 +1,53 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
 
 	"KdnSite/assets"
+	"KdnSite/internal/account"
 	"KdnSite/internal/achievements"
+	"KdnSite/internal/auth"
+	"KdnSite/internal/avatar"
+	"KdnSite/internal/classes"
+	"KdnSite/internal/config"
+	"KdnSite/internal/csrf"
+	"KdnSite/internal/export"
+	"KdnSite/internal/flashcards"
 	"KdnSite/internal/handlers"
 	"KdnSite/internal/leaderboard"
+	"KdnSite/internal/library"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/markdown"
+	"KdnSite/internal/mastery"
+	"KdnSite/internal/metrics"
+	"KdnSite/internal/migrate"
+	"KdnSite/internal/planner"
+	"KdnSite/internal/problem"
 	"KdnSite/internal/projects"
 	"KdnSite/internal/quiz"
+	"KdnSite/internal/ratelimit"
 	"KdnSite/internal/resources"
 	"KdnSite/internal/revision"
+	"KdnSite/internal/search"
+	"KdnSite/internal/session"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/storage"
+	"KdnSite/internal/study"
+	"KdnSite/internal/tags"
+	"KdnSite/internal/tracing"
 	"KdnSite/internal/user"
+	"KdnSite/internal/utils"
 	adminpages "KdnSite/ui/pages/admin"
 	errorpages "KdnSite/ui/pages/error"
 	legalpages "KdnSite/ui/pages/legal"
@@ -25,100 +57,195 @@ import (
 	userpagesprojects "KdnSite/ui/pages/user/projects"
 	userpagesquiz "KdnSite/ui/pages/user/quiz"
 
+	"github.com/a-h/templ"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
-	setupLogging()
-	checkEnvVars()
-	db := setupDatabase()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Errorf("Invalid configuration:\n%v", err)
+		os.Exit(1)
+	}
+	logging.Setup(cfg.Log)
+	if err := run(cfg); err != nil {
+		log.Errorf("Server stopped: %v", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until SIGINT or SIGTERM, then drains in-flight requests before returning.
+func run(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	db := setupDatabase(cfg.DatabaseURL)
 	defer db.Close()
+	if err := migrate.Up(ctx, db); err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+	if err := specs.Seed(ctx, db); err != nil {
+		return fmt.Errorf("loading exam specifications: %w", err)
+	}
+	handlers.SetDB(db)
+	handlers.SetConfig(cfg)
+	problem.SetHTMLRenderer(renderErrorPage)
+	auth.Configure(cfg.Auth0)
+	utils.SetTrustedProxies(cfg.TrustedProxies)
+	metrics.RegisterDB(db)
+	// Load signing keys now rather than on the first login; /readyz retries if this fails
+	go auth.CheckJWKS()
+	store := setupStorage(cfg.Storage)
+	exportWorker := export.NewWorker(db, store)
+	exportWorker.Start(ctx)
+	deletions := account.NewService(db, store, cfg.AccountDeletionGracePeriod)
+	deletions.Start(ctx)
+	flashcards.StartMediaSweep(ctx, db, store)
+
+	setupRateLimits(cfg.RateLimits)
 
 	mux := http.NewServeMux()
-	registerStaticRoutes(mux)
+	registerHealthRoutes(mux, db)
+	registerStaticRoutes(mux, cfg)
 	registerLegalRoutes(mux)
 	registerAuthRoutes(mux)
-	registerUserRoutes(mux)
-	SetupAssetsRoutes(mux)
-	registerAPIRoutes(mux, db)
+	registerAccountDeletionRoutes(mux, deletions)
+	registerAvatarRoutes(mux, db, store)
+	registerFlashcardRoutes(mux, db, store)
+	registerSessionRoutes(mux, db)
+	registerUserRoutes(mux, cfg)
+	SetupAssetsRoutes(mux, cfg)
+	registerAPIRoutes(mux, db, cfg)
+	registerLibraryRoutes(mux, db, cfg)
+	registerPlannerRoutes(mux, db)
+	registerStudyRoutes(mux, db)
+	registerExportRoutes(mux, db, store, exportWorker)
 
 	hstsMiddleware := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if os.Getenv("GO_ENV") == "production" {
+			if cfg.Production() {
 				w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
 			}
 			next.ServeHTTP(w, r)
 		})
 	}
 
-	handler := hstsMiddleware(mux)
+	handler := tracing.Middleware(mux, logging.Middleware(metrics.Middleware(mux, hstsMiddleware(csrf.Protect(cfg.Production(), mux)))))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8090"
-	}
-	log.Infof("Server running on :%s", port)
+	port := cfg.Port
+	srv := newServer(":"+port, handler, cfg.HTTP)
+	// SSE connections never go idle on their own, so end them or Shutdown waits the full timeout
+	srv.RegisterOnShutdown(handlers.CloseStreams)
+	servers := []*http.Server{srv}
 
-	if os.Getenv("GO_ENV") == "production" {
+	errCh := make(chan error, 3)
+	// With METRICS_ADDR set, /metrics is only served on that (internal) address; otherwise admins can read it on the main port
+	if addr := cfg.HTTP.MetricsAddr; addr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", metrics.Handler())
+		admin := newServer(addr, adminMux, cfg.HTTP)
+		servers = append(servers, admin)
 		go func() {
-			http.ListenAndServe(":80", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				http.Redirect(w, r, "https://"+r.Host+r.URL.String(), http.StatusMovedPermanently)
-			}))
+			log.Infof("Metrics available on %s/metrics", addr)
+			if err := admin.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("metrics server: %w", err)
+			}
 		}()
+	} else {
+		mux.Handle("/metrics", handlers.RequireAuth(requireAdmin(cfg.AdminPermission, metrics.Handler())))
 	}
-
-	err := http.ListenAndServe(":"+port, handler)
-	if err != nil {
-		return
+	if cfg.Production() {
+		redirect := newServer(":80", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "https://"+r.Host+r.URL.String(), http.StatusMovedPermanently)
+		}), cfg.HTTP)
+		servers = append(servers, redirect)
+		go func() {
+			if err := redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("redirect server: %w", err)
+			}
+		}()
 	}
-}
+	go func() {
+		log.Infof("Server running on :%s", port)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
 
-func setupLogging() {
-	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
-	log.SetLevel(log.InfoLevel)
-}
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		log.Info("Shutdown signal received, draining requests")
+	case serveErr = <-errCh:
+	}
+	stop()
 
-func checkEnvVars() {
-	domain := os.Getenv("AUTH0_DOMAIN")
-	clientID := os.Getenv("AUTH0_CLIENT_ID")
-	if domain == "" {
-		log.Fatal("AUTH0_DOMAIN environment variable is not set!")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("Shutdown of %s did not finish cleanly: %v", s.Addr, err)
+			if serveErr == nil {
+				serveErr = err
+			}
+		}
 	}
-	if clientID == "" {
-		log.Fatal("AUTH0_CLIENT_ID environment variable is not set!")
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Errorf("Failed to flush traces: %v", err)
 	}
-	dbURL := os.Getenv("POSTGRES_DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("POSTGRES_DATABASE_URL environment variable is not set!")
+	return serveErr
+}
+
+// newServer applies the configured timeouts. Handlers that stream (SSE, downloads)
+// extend their own write deadline.
+func newServer(addr string, handler http.Handler, cfg config.HTTP) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
 }
 
-func setupDatabase() *sql.DB {
-	dbURL := os.Getenv("POSTGRES_DATABASE_URL")
-	db, err := sql.Open("postgres", dbURL)
+func setupDatabase(dbURL string) *sql.DB {
+	db, err := tracing.OpenDB("postgres", dbURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to Postgres DB: %v", err)
 	}
 	return db
 }
 
-func registerStaticRoutes(mux *http.ServeMux) {
+func setupStorage(cfg config.Storage) storage.Storage {
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+	return store
+}
+
+func registerHealthRoutes(mux *http.ServeMux, db *sql.DB) {
+	mux.HandleFunc("/healthz", handlers.HandleHealthCheck)
+	mux.HandleFunc("/readyz", handlers.HandleReadiness(db))
+	mux.HandleFunc("/ping", handlers.HandlePing)
+}
+
+func registerStaticRoutes(mux *http.ServeMux, cfg *config.Config) {
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
 			return
 		}
 		if r.URL.Path != "/" {
-			w.WriteHeader(http.StatusNotFound)
-			err := errorpages.NotFound().Render(r.Context(), w)
-			if err != nil {
-				log.Errorf("Render error (NotFound): %v", err)
-			}
+			problem.Write(w, r, problem.NotFound("No page or endpoint exists at this address."))
 			return
 		}
-		domain := os.Getenv("AUTH0_DOMAIN")
-		clientID := os.Getenv("AUTH0_CLIENT_ID")
-		err := publicpages.Landing(domain, clientID).Render(r.Context(), w)
+		err := publicpages.Landing(cfg.Auth0.Domain, cfg.Auth0.ClientID).Render(r.Context(), w)
 		if err != nil {
 			log.Errorf("Render error (Landing): %v", err)
 		}
@@ -140,34 +267,94 @@ func registerLegalRoutes(mux *http.ServeMux) {
 	})
 }
 
+// Per-route rate limits, set up by setupRateLimits; each can be overridden with
+// RATE_LIMIT_<NAME>="<burst>/<interval>"
+var (
+	authCallbackLimiter       *ratelimit.Limiter
+	changePasswordLimiter     *ratelimit.Limiter
+	changeUsernameLimiter     *ratelimit.Limiter
+	avatarLimiter             *ratelimit.Limiter
+	resendVerificationLimiter *ratelimit.Limiter
+	quizAttemptLimiter        *ratelimit.Limiter
+	exportLimiter             *ratelimit.Limiter
+	searchLimiter             *ratelimit.Limiter
+	flashcardMediaLimiter     *ratelimit.Limiter
+)
+
+func setupRateLimits(limits map[string]config.RateLimit) {
+	authCallbackLimiter = ratelimit.New(ratelimit.Rule{Name: "auth_callback", Burst: 20, Every: 3 * time.Second, Key: ratelimit.ByIP}, limits)
+	changePasswordLimiter = ratelimit.New(ratelimit.Rule{Name: "change_password", Burst: 3, Every: 10 * time.Minute}, limits)
+	changeUsernameLimiter = ratelimit.New(ratelimit.Rule{Name: "change_username", Burst: 5, Every: time.Minute}, limits)
+	avatarLimiter = ratelimit.New(ratelimit.Rule{Name: "avatar", Burst: 5, Every: time.Minute}, limits)
+	resendVerificationLimiter = ratelimit.New(ratelimit.Rule{Name: "resend_verification", Burst: 3, Every: 5 * time.Minute}, limits)
+	quizAttemptLimiter = ratelimit.New(ratelimit.Rule{Name: "quiz_attempt", Burst: 10, Every: 6 * time.Second}, limits)
+	exportLimiter = ratelimit.New(ratelimit.Rule{Name: "export", Burst: 10, Every: time.Minute}, limits)
+	searchLimiter = ratelimit.New(ratelimit.Rule{Name: "search", Burst: 30, Every: time.Second}, limits)
+	flashcardMediaLimiter = ratelimit.New(ratelimit.Rule{Name: "flashcard_media", Burst: 20, Every: 10 * time.Second}, limits)
+}
+
+func registerAccountDeletionRoutes(mux *http.ServeMux, svc *account.Service) {
+	mux.Handle("/api/auth/delete", handlers.RequireAuth(handlers.DeleteAccountHandler(svc)))
+	mux.Handle("/api/auth/delete/status", handlers.RequireAuth(handlers.AccountDeletionStatusHandler(svc)))
+	mux.Handle("/api/auth/delete/cancel", handlers.RequireAuth(handlers.CancelAccountDeletionHandler(svc)))
+}
+
 func registerAuthRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/api/auth/callback", handlers.HandleAuthCallback)
+	mux.Handle("/api/auth/callback", authCallbackLimiter.Middleware(http.HandlerFunc(handlers.HandleAuthCallback)))
 	mux.HandleFunc("/api/auth/logout", handlers.LogoutHandler)
-	mux.HandleFunc("/api/auth/delete", handlers.DeleteAccountHandler)
-	mux.HandleFunc("/api/auth/change-password", handlers.ChangePasswordHandler)
-	mux.HandleFunc("/api/auth/change-username", handlers.ChangeUsernameHandler)
-	mux.HandleFunc("/api/auth/avatar", handlers.AvatarUploadHandler)
-	mux.HandleFunc("/api/auth/email", handlers.GetCurrentUserEmailHandler)
-	mux.Handle("/api/auth/resend-verification", handlers.RequireAuth(http.HandlerFunc(handlers.ResendVerificationHandler)))
+	mux.Handle("/api/auth/change-password", handlers.RequireAuth(changePasswordLimiter.Middleware(http.HandlerFunc(handlers.ChangePasswordHandler))))
+	mux.Handle("/api/auth/change-username", handlers.RequireAuth(changeUsernameLimiter.Middleware(http.HandlerFunc(handlers.ChangeUsernameHandler))))
+	mux.Handle("/api/auth/email", handlers.RequireAuth(http.HandlerFunc(handlers.GetCurrentUserEmailHandler)))
+	mux.Handle("/api/auth/resend-verification", handlers.RequireAuth(resendVerificationLimiter.Middleware(http.HandlerFunc(handlers.ResendVerificationHandler))))
 	mux.Handle("/api/auth/logout-all", handlers.RequireAuth(http.HandlerFunc(handlers.LogoutAllHandler)))
-	mux.Handle("/api/auth/sessions", handlers.RequireAuth(http.HandlerFunc(handlers.SessionsHandler)))
 	mux.HandleFunc("/api/auth/check", handlers.AuthCheckHandler)
-	mux.HandleFunc("/api/auth/current-username", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/auth/webhook/email-verified", handlers.EmailVerifiedWebhookHandler)
+	mux.Handle("/api/auth/current-username", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username, err := handlers.GetUsernameFromJWT(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(""))
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(username))
-	})
+	})))
+}
+
+func registerAvatarRoutes(mux *http.ServeMux, db *sql.DB, store storage.Storage) {
+	mux.Handle("/api/auth/avatar", handlers.RequireAuth(avatarLimiter.Middleware(avatar.Upload(db, store))))
+	mux.Handle(avatar.URLPrefix, avatar.Serve(store))
+}
+
+func registerFlashcardRoutes(mux *http.ServeMux, db *sql.DB, store storage.Storage) {
+	mux.Handle("/api/flashcards", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			flashcards.ListFlashcards(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/flashcards/media", handlers.RequireAuth(flashcardMediaLimiter.Middleware(flashcards.UploadMedia(db, store))))
+	mux.Handle("/api/flashcards/{id}/review", handlers.RequireAuth(flashcards.ReviewCard(db)))
+	mux.Handle(flashcards.MediaURLPrefix, flashcards.ServeMedia(store))
 }
 
-func registerUserRoutes(mux *http.ServeMux) {
+func registerSessionRoutes(mux *http.ServeMux, db *sql.DB) {
+	mux.Handle("/api/auth/sessions", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			session.ListSessions(db)(w, r)
+		case http.MethodDelete:
+			session.RevokeSessionHandler(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+}
+
+func registerUserRoutes(mux *http.ServeMux, cfg *config.Config) {
 	mux.HandleFunc("/dash", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
 			return
 		}
 		handlers.RequireAuth(http.HandlerFunc(handlers.DashPageHandler)).ServeHTTP(w, r)
@@ -198,10 +385,8 @@ func registerUserRoutes(mux *http.ServeMux) {
 		})).ServeHTTP(w, r)
 	})
 	mux.HandleFunc("/user/settings", func(w http.ResponseWriter, r *http.Request) {
-		domain := os.Getenv("AUTH0_DOMAIN")
-		clientID := os.Getenv("AUTH0_CLIENT_ID")
 		handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			err := userpages.Settings(domain, clientID).Render(r.Context(), w)
+			err := userpages.Settings(cfg.Auth0.Domain, cfg.Auth0.ClientID).Render(r.Context(), w)
 			if err != nil {
 				log.Errorf("Render error (Settings): %v", err)
 			}
@@ -215,6 +400,14 @@ func registerUserRoutes(mux *http.ServeMux) {
 			}
 		})).ServeHTTP(w, r)
 	})
+	mux.HandleFunc("/user/planner", func(w http.ResponseWriter, r *http.Request) {
+		handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := userpages.Planner().Render(r.Context(), w)
+			if err != nil {
+				log.Errorf("Render error (Planner): %v", err)
+			}
+		})).ServeHTTP(w, r)
+	})
 	mux.HandleFunc("/error/verifyemail", func(w http.ResponseWriter, r *http.Request) {
 		err := errorpages.VerifyEmail().Render(r.Context(), w)
 		if err != nil {
@@ -242,24 +435,9 @@ func registerUserRoutes(mux *http.ServeMux) {
 			log.Errorf("Render error (InternalServerError): %v", err)
 		}
 	})
-	mux.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
-		handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user := r.Context().Value("user")
-			var claims map[string]interface{}
-			if user != nil {
-				if c, ok := user.(map[string]interface{}); ok {
-					claims = c
-				}
-			}
-			adminPerm := os.Getenv("ADMIN_PERMISSION")
-			if claims == nil || adminPerm == "" || !hasPermission(claims, adminPerm) {
-				w.WriteHeader(http.StatusForbidden)
-				_ = errorpages.Forbidden().Render(r.Context(), w)
-				return
-			}
-			_ = adminpages.AdminPanel().Render(r.Context(), w)
-		})).ServeHTTP(w, r)
-	})
+	mux.Handle("/admin", handlers.RequireAuth(requireAdmin(cfg.AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = adminpages.AdminPanel().Render(r.Context(), w)
+	}))))
 
 	mux.HandleFunc("/user/quizzes", func(w http.ResponseWriter, r *http.Request) {
 		handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -279,8 +457,8 @@ func registerUserRoutes(mux *http.ServeMux) {
 	})
 }
 
-func SetupAssetsRoutes(mux *http.ServeMux) {
-	var isDevelopment = os.Getenv("GO_ENV") != "production"
+func SetupAssetsRoutes(mux *http.ServeMux, cfg *config.Config) {
+	var isDevelopment = !cfg.Production()
 	var fs http.Handler
 	if isDevelopment {
 		fs = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -291,9 +469,10 @@ func SetupAssetsRoutes(mux *http.ServeMux) {
 		fs = http.FileServer(http.FS(assets.Assets))
 	}
 	mux.Handle("/assets/", http.StripPrefix("/assets/", fs))
+	mux.HandleFunc("/assets/css/highlight.css", markdown.StyleHandler)
 }
 
-func registerAPIRoutes(mux *http.ServeMux, db *sql.DB) {
+func registerAPIRoutes(mux *http.ServeMux, db *sql.DB, cfg *config.Config) {
 	mux.Handle("/api/projects", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -301,7 +480,7 @@ func registerAPIRoutes(mux *http.ServeMux, db *sql.DB) {
 		case http.MethodPost:
 			projects.CreateProject(db)(w, r)
 		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
 		}
 	})))
 	mux.Handle("/api/revision", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -311,21 +490,34 @@ func registerAPIRoutes(mux *http.ServeMux, db *sql.DB) {
 		case http.MethodPost:
 			revision.CreateRevisionResource(db)(w, r)
 		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/revision/bulk", handlers.RequireAuth(revision.BulkRevisionResources(db)))
+	mux.Handle("/api/revision/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			revision.GetRevisionResource(db)(w, r)
+		case http.MethodPatch:
+			revision.UpdateRevisionResource(db)(w, r)
+		case http.MethodDelete:
+			revision.DeleteRevisionResource(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
 		}
 	})))
 	mux.Handle("/api/leaderboard", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			leaderboard.ListLeaderboard(db)(w, r)
 		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
 		}
 	})))
 	mux.Handle("/api/achievements", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			achievements.ListAchievements(db)(w, r)
 		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
 		}
 	})))
 	mux.Handle("/api/user/profile", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -335,7 +527,7 @@ func registerAPIRoutes(mux *http.ServeMux, db *sql.DB) {
 		case http.MethodPost:
 			user.UpdateProfile(db)(w, r)
 		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
 		}
 	})))
 	mux.Handle("/api/resources", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -345,24 +537,219 @@ func registerAPIRoutes(mux *http.ServeMux, db *sql.DB) {
 		case http.MethodPost:
 			resources.CreateResource(db)(w, r)
 		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/resources/bulk", handlers.RequireAuth(resources.BulkResources(db)))
+	mux.Handle("/api/resources/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			resources.GetResource(db)(w, r)
+		case http.MethodPatch:
+			resources.UpdateResource(db)(w, r)
+		case http.MethodDelete:
+			resources.DeleteResource(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/tags", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			tags.ListTags(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/tags/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPatch:
+			tags.RenameTag(db)(w, r)
+		case http.MethodDelete:
+			tags.DeleteTag(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
 		}
 	})))
-	mux.HandleFunc("/api/sse/email-verified", handlers.EmailVerificationSSE)
+	mux.Handle("/api/sse/email-verified", handlers.RequireAuthUnverified(http.HandlerFunc(handlers.EmailVerificationSSE)))
 	mux.Handle("/api/quizzes", handlers.RequireAuth(quiz.ListQuizzes(db)))
 	mux.Handle("/api/quiz", handlers.RequireAuth(quiz.GetQuiz(db)))
-	mux.Handle("/api/quiz/attempt", handlers.RequireAuth(quiz.SubmitQuizAttempt(db)))
+	mux.Handle("/api/quiz/attempt", handlers.RequireAuth(quizAttemptLimiter.Middleware(quiz.SubmitQuizAttempt(db))))
+	mux.Handle("/api/quizzes/{id}/spec-points", handlers.RequireAuth(requireAdmin(cfg.AdminPermission, specs.SetLinks(db, specs.Quizzes, "Quiz"))))
+	mux.Handle("/api/questions/{id}/spec-points", handlers.RequireAuth(requireAdmin(cfg.AdminPermission, specs.SetLinks(db, specs.Questions, "Question"))))
+	mux.Handle("/api/specs", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			specs.ListSpecs(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/specs/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			specs.GetSpec(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/progress", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mastery.GetProgress(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/search", handlers.RequireAuth(searchLimiter.Middleware(search.Handler(db))))
+	mux.Handle("/debug/vars", handlers.RequireAuth(requireAdmin(cfg.AdminPermission, expvar.Handler())))
 }
 
-func hasPermission(claims map[string]interface{}, permission string) bool {
-	perms, ok := claims["permissions"].([]interface{})
-	if !ok {
-		return false
+// renderErrorPage shows a problem to a browser as the matching error page
+func renderErrorPage(w http.ResponseWriter, r *http.Request, p *problem.Problem) {
+	var page templ.Component
+	switch p.Status {
+	case http.StatusBadRequest:
+		page = errorpages.BadRequest()
+	case http.StatusForbidden:
+		page = errorpages.Forbidden()
+	case http.StatusNotFound:
+		page = errorpages.NotFound()
+	case http.StatusInternalServerError:
+		page = errorpages.InternalServerError()
+	default:
+		page = errorpages.ErrorPage(p.Status, p.Title, p.Detail)
 	}
-	for _, p := range perms {
-		if pstr, ok := p.(string); ok && pstr == permission {
-			return true
-		}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(p.Status)
+	if err := page.Render(r.Context(), w); err != nil {
+		log.Errorf("Render error (%d): %v", p.Status, err)
 	}
-	return false
+}
+
+// requireAdmin responds 403 unless the JWT carries the admin permission
+func requireAdmin(adminPerm string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.HasPermission(r, adminPerm) {
+			problem.Write(w, r, problem.Forbidden("Administrator access is required."))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func registerLibraryRoutes(mux *http.ServeMux, db *sql.DB, cfg *config.Config) {
+	roles := auth.Roles{Admin: cfg.AdminPermission, Teacher: cfg.TeacherPermission}
+	mux.Handle("/api/classes", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			classes.ListClasses(db)(w, r)
+		case http.MethodPost:
+			classes.CreateClass(db, roles)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/classes/join", handlers.RequireAuth(classes.JoinClass(db)))
+	mux.Handle("/api/classes/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			classes.LeaveClass(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/library", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			library.ListLibrary(db, roles)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/library/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			library.GetLibraryItem(db, roles)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/library/{id}/publish", handlers.RequireAuth(library.PublishResource(db, roles)))
+	mux.Handle("/api/library/{id}/moderation", handlers.RequireAuth(requireAdmin(cfg.AdminPermission, library.ModerateItem(db))))
+	mux.Handle("/api/library/{id}/copy", handlers.RequireAuth(library.CopyLibraryItem(db)))
+}
+
+func registerPlannerRoutes(mux *http.ServeMux, db *sql.DB) {
+	mux.Handle("/api/planner/exams", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			planner.ListExams(db)(w, r)
+		case http.MethodPost:
+			planner.CreateExam(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/planner/exams/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPatch:
+			planner.UpdateExam(db)(w, r)
+		case http.MethodDelete:
+			planner.DeleteExam(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/planner/availability", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			planner.GetAvailability(db)(w, r)
+		case http.MethodPut:
+			planner.SetAvailability(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/planner/plan", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			planner.GetPlan(db)(w, r)
+		case http.MethodPost:
+			planner.RebuildPlan(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/planner/plan.ics", handlers.RequireAuth(planner.ExportCalendar(db)))
+	mux.Handle("/api/planner/sessions/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			planner.UpdateSession(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+}
+
+func registerStudyRoutes(mux *http.ServeMux, db *sql.DB) {
+	mux.Handle("/api/study-sessions", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			study.ListSessions(db)(w, r)
+		case http.MethodPost:
+			study.StartSession(db)(w, r)
+		default:
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/study-sessions/summary", handlers.RequireAuth(study.GetSummary(db)))
+	mux.Handle("/api/study-sessions/{id}", handlers.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			study.DeleteSession(db)(w, r)
+		} else {
+			problem.Write(w, r, problem.MethodNotAllowed())
+		}
+	})))
+	mux.Handle("/api/study-sessions/{id}/pause", handlers.RequireAuth(study.PauseSession(db)))
+	mux.Handle("/api/study-sessions/{id}/resume", handlers.RequireAuth(study.ResumeSession(db)))
+	mux.Handle("/api/study-sessions/{id}/finish", handlers.RequireAuth(study.FinishSession(db)))
+}
+
+func registerExportRoutes(mux *http.ServeMux, db *sql.DB, store storage.Storage, worker *export.Worker) {
+	mux.Handle("/api/user/export", handlers.RequireAuth(exportLimiter.Middleware(export.RequestExport(db, worker))))
+	mux.Handle("/api/user/export/status", handlers.RequireAuth(export.GetExportStatus(db)))
+	mux.Handle("/api/user/export/download", handlers.RequireAuth(export.DownloadExport(db, store)))
 }
@@ -0,0 +1,81 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const deletionColumns = `id, COALESCE(user_id, ''), subject_hash, status, requested_at, scheduled_for, COALESCE(cancelled_at, 0), COALESCE(completed_at, 0), attempts, COALESCE(last_error, '')`
+
+func CreateDeletion(ctx context.Context, db *sql.DB, d *Deletion) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO account_deletions (id, user_id, subject_hash, status, requested_at, scheduled_for, attempts) VALUES ($1, $2, $3, $4, $5, $6, 0)`,
+		d.ID, d.UserID, d.SubjectHash, d.Status, d.RequestedAt, d.ScheduledFor)
+	return err
+}
+
+// GetScheduledDeletion returns the user's pending deletion, or sql.ErrNoRows.
+func GetScheduledDeletion(ctx context.Context, db *sql.DB, userID string) (*Deletion, error) {
+	row := db.QueryRowContext(ctx, `SELECT `+deletionColumns+` FROM account_deletions WHERE user_id=$1 AND status=$2`, userID, StatusScheduled)
+	return scanDeletion(row)
+}
+
+// CancelDeletion returns sql.ErrNoRows if the user has no pending deletion.
+func CancelDeletion(ctx context.Context, db *sql.DB, userID string) error {
+	res, err := db.ExecContext(ctx, `UPDATE account_deletions SET status=$1, cancelled_at=$2 WHERE user_id=$3 AND status=$4`,
+		StatusCancelled, time.Now().Unix(), userID, StatusScheduled)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func ListDueDeletions(ctx context.Context, db *sql.DB) ([]*Deletion, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+deletionColumns+` FROM account_deletions WHERE status=$1 AND scheduled_for <= $2 ORDER BY scheduled_for`,
+		StatusScheduled, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deletions []*Deletion
+	for rows.Next() {
+		d, err := scanDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+func RecordDeletionFailure(ctx context.Context, db *sql.DB, id, msg string) error {
+	_, err := db.ExecContext(ctx, `UPDATE account_deletions SET attempts=attempts+1, last_error=$1 WHERE id=$2`, msg, id)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeletion(row rowScanner) (*Deletion, error) {
+	var d Deletion
+	err := row.Scan(&d.ID, &d.UserID, &d.SubjectHash, &d.Status, &d.RequestedAt, &d.ScheduledFor, &d.CancelledAt, &d.CompletedAt, &d.Attempts, &d.LastError)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CompleteDeletion marks d completed as part of the deletion transaction and drops
+// the user ID from it and from any earlier, cancelled requests.
+func CompleteDeletion(ctx context.Context, tx *sql.Tx, d *Deletion) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE account_deletions SET status=$1, completed_at=$2, last_error=NULL WHERE id=$3`,
+		StatusCompleted, time.Now().Unix(), d.ID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE account_deletions SET user_id=NULL WHERE user_id=$1`, d.UserID)
+	return err
+}
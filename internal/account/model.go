@@ -0,0 +1,22 @@
+package account
+
+const (
+	StatusScheduled = "scheduled"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Deletion is the audit record of an account deletion request. It outlives the
+// account: once completed, UserID is cleared and only SubjectHash remains.
+type Deletion struct {
+	ID           string `json:"id"`
+	UserID       string `json:"-"`
+	SubjectHash  string `json:"-"`
+	Status       string `json:"status"`
+	RequestedAt  int64  `json:"requested_at"`
+	ScheduledFor int64  `json:"scheduled_for"`
+	CancelledAt  int64  `json:"cancelled_at,omitempty"`
+	CompletedAt  int64  `json:"completed_at,omitempty"`
+	Attempts     int    `json:"-"`
+	LastError    string `json:"-"`
+}
@@ -0,0 +1,225 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/avatar"
+	"KdnSite/internal/flashcards"
+	"KdnSite/internal/session"
+	"KdnSite/internal/storage"
+)
+
+// sweepInterval is how often due deletions are carried out.
+const sweepInterval = time.Minute
+
+// userDataStatements delete every row owned by a user, children before parents so
+// foreign keys hold. Quizzes are kept for other students' attempts, but unlinked.
+var userDataStatements = []string{
+	`DELETE FROM card_reviews WHERE owner_id = $1`,
+	`DELETE FROM card_schedules WHERE owner_id = $1`,
+	`DELETE FROM question_attempts WHERE user_id = $1`,
+	`DELETE FROM study_sessions WHERE user_id = $1`,
+	`DELETE FROM plan_sessions WHERE user_id = $1`,
+	`DELETE FROM exams WHERE user_id = $1`,
+	`DELETE FROM study_availability WHERE user_id = $1`,
+	`DELETE FROM anki_cards WHERE owner_id = $1`,
+	`DELETE FROM anki_decks WHERE owner_id = $1`,
+	`DELETE FROM user_quiz_attempts WHERE user_id = $1`,
+	`DELETE FROM quiz_results WHERE user_id = $1`,
+	`DELETE FROM achievements WHERE user_id = $1`,
+	`DELETE FROM flashcards WHERE owner_id = $1`,
+	`DELETE FROM flashcard_media WHERE owner_id = $1`,
+	`DELETE FROM revision_resources WHERE owner_id = $1`,
+	`DELETE FROM resources WHERE owner_id = $1`,
+	`DELETE FROM class_members WHERE user_id = $1`,
+	`DELETE FROM classes WHERE teacher_id = $1`,
+	`DELETE FROM tags WHERE owner_id = $1`,
+	`DELETE FROM leaderboard WHERE user_id = $1`,
+	`DELETE FROM projects WHERE owner_id = $1`,
+	`UPDATE quizzes SET owner_id = NULL WHERE owner_id = $1`,
+	`DELETE FROM export_jobs WHERE user_id = $1`,
+	`DELETE FROM sessions WHERE user_id = $1`,
+	`DELETE FROM users WHERE id = $1`,
+}
+
+// Service schedules, cancels and carries out account deletions.
+type Service struct {
+	db          *sql.DB
+	store       storage.Storage
+	gracePeriod time.Duration
+}
+
+// NewService returns a Service that deletes accounts gracePeriod after they are
+// scheduled, or immediately if gracePeriod is zero.
+func NewService(db *sql.DB, store storage.Storage, gracePeriod time.Duration) *Service {
+	return &Service{db: db, store: store, gracePeriod: gracePeriod}
+}
+
+// Schedule records a deletion request and signs the user out everywhere. The account
+// is deleted once the grace period has passed unless the user cancels first. A repeated
+// request returns the existing schedule.
+func (s *Service) Schedule(ctx context.Context, userID string) (*Deletion, error) {
+	if d, err := GetScheduledDeletion(ctx, s.db, userID); err == nil {
+		return d, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	now := time.Now()
+	d := &Deletion{
+		ID:           uuid.NewString(),
+		UserID:       userID,
+		SubjectHash:  subjectHash(userID),
+		Status:       StatusScheduled,
+		RequestedAt:  now.Unix(),
+		ScheduledFor: now.Add(s.gracePeriod).Unix(),
+	}
+	if err := CreateDeletion(ctx, s.db, d); err != nil {
+		return nil, err
+	}
+	if err := session.RevokeAllSessions(ctx, s.db, userID); err != nil {
+		log.Errorf("[account.Schedule] Failed to revoke sessions for deletion %s: %v", d.ID, err)
+	}
+	log.Infof("[account.Schedule] Deletion %s scheduled for %s", d.ID, time.Unix(d.ScheduledFor, 0).UTC().Format(time.RFC3339))
+	if s.gracePeriod == 0 {
+		if err := s.Execute(ctx, d); err != nil {
+			return nil, err
+		}
+		d.Status = StatusCompleted
+	}
+	return d, nil
+}
+
+// Status returns the user's pending deletion, or sql.ErrNoRows.
+func (s *Service) Status(ctx context.Context, userID string) (*Deletion, error) {
+	return GetScheduledDeletion(ctx, s.db, userID)
+}
+
+// Cancel withdraws a pending deletion. It returns sql.ErrNoRows if there is none.
+func (s *Service) Cancel(ctx context.Context, userID string) error {
+	return CancelDeletion(ctx, s.db, userID)
+}
+
+// Execute deletes the account. Local rows are deleted inside a transaction that is
+// only committed once Auth0 has deleted the user, so a failed Auth0 call leaves the
+// account intact and the deletion is retried on the next sweep. Auth0 treats deleting
+// a missing user as success, so a retry after a failed commit is also safe. Files are
+// removed last, once nothing references them.
+func (s *Service) Execute(ctx context.Context, d *Deletion) error {
+	files, err := s.userFiles(ctx, d.UserID)
+	if err != nil {
+		return s.fail(ctx, d, "collect files", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return s.fail(ctx, d, "begin transaction", err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range userDataStatements {
+		if _, err := tx.ExecContext(ctx, stmt, d.UserID); err != nil {
+			return s.fail(ctx, d, stmt, err)
+		}
+	}
+	if err := CompleteDeletion(ctx, tx, d); err != nil {
+		return s.fail(ctx, d, "record completion", err)
+	}
+	if err := auth.DeleteUser(ctx, d.UserID); err != nil {
+		return s.fail(ctx, d, "delete Auth0 user", err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("[account.Execute] Auth0 user deleted but local commit failed for deletion %s, will retry: %v", d.ID, err)
+		return s.fail(ctx, d, "commit", err)
+	}
+	for _, remove := range files {
+		if err := remove(ctx); err != nil {
+			log.Warnf("[account.Execute] Failed to remove a file for deletion %s: %v", d.ID, err)
+		}
+	}
+	log.Infof("[account.Execute] Deletion %s completed", d.ID)
+	return nil
+}
+
+// userFiles returns removers for every stored file that belongs to the user. They run
+// once the user's row is gone, so an avatar another account still shows is kept.
+func (s *Service) userFiles(ctx context.Context, userID string) ([]func(context.Context) error, error) {
+	var files []func(context.Context) error
+	avatarURL, err := avatar.GetAvatarURL(ctx, s.db, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if avatarURL != "" {
+		files = append(files, func(ctx context.Context) error { return avatar.Delete(ctx, s.db, s.store, avatarURL) })
+	}
+	media, err := flashcards.ListMediaNames(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range media {
+		files = append(files, func(ctx context.Context) error { return flashcards.DeleteMedia(ctx, s.store, name) })
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT object_key FROM export_jobs WHERE user_id=$1 AND object_key IS NOT NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		files = append(files, func(ctx context.Context) error { return s.store.Delete(ctx, key) })
+	}
+	return files, rows.Err()
+}
+
+func (s *Service) fail(ctx context.Context, d *Deletion, step string, err error) error {
+	err = fmt.Errorf("%s: %w", step, err)
+	if recErr := RecordDeletionFailure(context.WithoutCancel(ctx), s.db, d.ID, err.Error()); recErr != nil {
+		log.Errorf("[account.Execute] Failed to record failure for deletion %s: %v", d.ID, recErr)
+	}
+	return err
+}
+
+// Start carries out due deletions every minute until ctx is cancelled.
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweep(ctx)
+			}
+		}
+	}()
+}
+
+func (s *Service) sweep(ctx context.Context) {
+	due, err := ListDueDeletions(ctx, s.db)
+	if err != nil {
+		log.Errorf("[account.sweep] Failed to list due deletions: %v", err)
+		return
+	}
+	for _, d := range due {
+		if err := s.Execute(ctx, d); err != nil {
+			log.Errorf("[account.sweep] Deletion %s failed (attempt %d): %v", d.ID, d.Attempts+1, err)
+		}
+	}
+}
+
+// subjectHash identifies a deleted account in the audit log without keeping its ID.
+func subjectHash(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:])
+}
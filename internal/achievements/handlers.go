@@ -2,22 +2,40 @@ package achievements
 
 import (
 	"KdnSite/internal/auth"
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
 	"database/sql"
-	"encoding/json"
 	"net/http"
 )
 
+// listSpec is what GET /api/achievements can sort and filter by.
+var listSpec = pagination.Spec{
+	IDColumn: "id",
+	Sorts: map[string]pagination.SortField{
+		"earned_at": {Column: "earned_at", Numeric: true},
+		"name":      {Column: "name"},
+	},
+	DefaultSort: "-earned_at",
+	DateColumn:  "earned_at",
+}
+
 // ListAchievements handles GET /api/achievements
 func ListAchievements(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		q, err := pagination.Parse(r, listSpec)
+		if err != nil {
+			problem.Error(w, r, err)
 			return
 		}
-		rows, err := db.QueryContext(r.Context(), `SELECT id, user_id, name, desc, earned_at FROM achievements WHERE user_id=$1`, userID)
+		query, args := q.SQL(`SELECT id, user_id, name, "desc", earned_at FROM achievements WHERE user_id=$1`, userID)
+		rows, err := db.QueryContext(r.Context(), query, args...)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Write(w, r, problem.Internal())
 			return
 		}
 		defer rows.Close()
@@ -25,12 +43,11 @@ func ListAchievements(db *sql.DB) http.HandlerFunc {
 		for rows.Next() {
 			var a Achievement
 			if err := rows.Scan(&a.ID, &a.UserID, &a.Name, &a.Desc, &a.EarnedAt); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				problem.Write(w, r, problem.Internal())
 				return
 			}
 			achievements = append(achievements, &a)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(achievements)
+		pagination.Write(w, pagination.NewPage(q, achievements, (*Achievement).cursor))
 	}
 }
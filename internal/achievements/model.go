@@ -1,5 +1,7 @@
 package achievements
 
+import "strconv"
+
 type Achievement struct {
 	ID       string
 	UserID   string
@@ -7,3 +9,11 @@ type Achievement struct {
 	Desc     string
 	EarnedAt int64
 }
+
+// cursor returns the achievement's value for a list sort key, and its ID.
+func (a *Achievement) cursor(sortKey string) (string, string) {
+	if sortKey == "name" {
+		return a.Name, a.ID
+	}
+	return strconv.FormatInt(a.EarnedAt, 10), a.ID
+}
@@ -4,46 +4,86 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/MicahParks/keyfunc"
 	"github.com/golang-jwt/jwt/v4"
 	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/config"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/metrics"
 )
 
+// settings is the Auth0 tenant configuration, set once at startup by Configure
+var settings config.Auth0
+
+// Configure sets the Auth0 tenant used to validate tokens and call the Management API.
+func Configure(cfg config.Auth0) {
+	settings = cfg
+}
+
 var (
-	jwksInstance *keyfunc.JWKS
-	jwksOnce     sync.Once
-	jwksErr      error
+	jwksInstance    *keyfunc.JWKS
+	jwksMu          sync.Mutex
+	jwksErr         error
+	jwksLastAttempt time.Time
 )
 
-// getJWKS fetches and caches the JWKS from Auth0
+// jwksRetryInterval limits how often a failed JWKS fetch is retried.
+const jwksRetryInterval = 10 * time.Second
+
+// getJWKS fetches and caches the JWKS from Auth0. A failed fetch is retried on a
+// later call rather than cached for the life of the process.
 func getJWKS() (*keyfunc.JWKS, error) {
-	jwksOnce.Do(func() {
-		domain := os.Getenv("AUTH0_DOMAIN")
-		if domain == "" {
-			log.Error("[getJWKS] AUTH0_DOMAIN not set")
-			jwksErr = errors.New("AUTH0_DOMAIN not set")
-			return
-		}
-		jwksURL := "https://" + domain + "/.well-known/jwks.json"
-		log.Infof("[getJWKS] Fetching JWKS from %s", jwksURL)
-		jwksInstance, jwksErr = keyfunc.Get(jwksURL, keyfunc.Options{
-			RefreshInterval:     time.Hour, // refresh every hour
-			RefreshErrorHandler: func(err error) { log.Errorf("[getJWKS] JWKS refresh error: %v", err) },
-			RefreshTimeout:      10 * time.Second,
-			RefreshUnknownKID:   true,
-		})
-		if jwksErr != nil {
-			log.Errorf("[getJWKS] Failed to fetch JWKS: %v", jwksErr)
-		}
+	jwksMu.Lock()
+	defer jwksMu.Unlock()
+	if jwksInstance != nil {
+		return jwksInstance, nil
+	}
+	if jwksErr != nil && time.Since(jwksLastAttempt) < jwksRetryInterval {
+		return nil, jwksErr
+	}
+	jwksLastAttempt = time.Now()
+	domain := settings.Domain
+	if domain == "" {
+		log.Error("[getJWKS] AUTH0_DOMAIN not set")
+		jwksErr = errors.New("AUTH0_DOMAIN not set")
+		return nil, jwksErr
+	}
+	jwksURL := "https://" + domain + "/.well-known/jwks.json"
+	log.Infof("[getJWKS] Fetching JWKS from %s", jwksURL)
+	jwks, err := keyfunc.Get(jwksURL, keyfunc.Options{
+		RefreshInterval: time.Hour, // refresh every hour
+		Client:          Client,
+		RefreshErrorHandler: func(err error) {
+			metrics.JWKSRefreshFailures.Inc()
+			log.Errorf("[getJWKS] JWKS refresh error: %v", err)
+		},
+		RefreshTimeout:    10 * time.Second,
+		RefreshUnknownKID: true,
 	})
-	if jwksErr != nil {
-		log.Error("[getJWKS] Returning error: ", jwksErr)
+	if err != nil {
+		metrics.JWKSRefreshFailures.Inc()
+		log.Errorf("[getJWKS] Failed to fetch JWKS: %v", err)
+		jwksErr = err
+		return nil, err
+	}
+	jwksInstance, jwksErr = jwks, nil
+	return jwksInstance, nil
+}
+
+// CheckJWKS loads the JWKS if needed and reports whether signing keys are available.
+func CheckJWKS() error {
+	jwks, err := getJWKS()
+	if err != nil {
+		return err
+	}
+	if len(jwks.KIDs()) == 0 {
+		return errors.New("JWKS has no keys")
 	}
-	return jwksInstance, jwksErr
+	return nil
 }
 
 // ValidateAndParseJWT validates the JWT and returns claims if valid
@@ -68,8 +108,8 @@ func ValidateAndParseJWT(tokenStr string) (jwt.MapClaims, error) {
 		return nil, errors.New("invalid claims")
 	}
 	// Validate issuer and audience
-	domain := os.Getenv("AUTH0_DOMAIN")
-	clientID := os.Getenv("AUTH0_CLIENT_ID")
+	domain := settings.Domain
+	clientID := settings.ClientID
 	if claims["iss"] != "https://"+domain+"/" {
 		log.Warnf("[ValidateAndParseJWT] Invalid issuer: %v", claims["iss"])
 		return nil, errors.New("invalid issuer")
@@ -121,22 +161,21 @@ func GetJWTFromRequest(r *http.Request) string {
 // GetUserIDFromRequest extracts the user ID (sub claim) from a validated Auth0 JWT in the request.
 // This function performs full signature and claims validation using Auth0 JWKS.
 func GetUserIDFromRequest(r *http.Request) (string, error) {
+	logger := logging.FromContext(r.Context())
 	tokenStr := GetJWTFromRequest(r)
-	log.Infof("[GetUserIDFromRequest] Extracting user from JWT (token present: %v) from %s %s", tokenStr != "", r.Method, r.URL.Path)
 	if tokenStr == "" {
-		log.Warnf("[GetUserIDFromRequest] Missing token from %s %s", r.Method, r.URL.Path)
+		logger.Debug("[GetUserIDFromRequest] Missing token")
 		return "", fmt.Errorf("missing token")
 	}
 	claims, err := ValidateAndParseJWT(tokenStr)
 	if err != nil {
-		log.Warnf("[GetUserIDFromRequest] Invalid JWT: %v", err)
+		logger.Warnf("[GetUserIDFromRequest] Invalid JWT: %v", err)
 		return "", err
 	}
 	userID, ok := claims["sub"].(string)
 	if !ok {
-		log.Warnf("[GetUserIDFromRequest] Missing sub claim in JWT")
+		logger.Warn("[GetUserIDFromRequest] Missing sub claim in JWT")
 		return "", fmt.Errorf("missing sub claim")
 	}
-	log.Infof("[GetUserIDFromRequest] User ID extracted: %s", userID)
 	return userID, nil
 }
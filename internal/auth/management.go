@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/metrics"
+	"KdnSite/internal/tracing"
+)
+
+// Client is used for every request to Auth0 so their latency is recorded and traced.
+var Client = &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(metrics.Auth0Transport(http.DefaultTransport))}
+
+// managementConfig returns the domain and token used for Auth0 Management API calls.
+func managementConfig() (domain, token string, err error) {
+	domain, token = settings.ManagementDomain, settings.ManagementToken
+	if domain == "" || token == "" {
+		return "", "", errors.New("Auth0 management config missing")
+	}
+	return domain, token, nil
+}
+
+// FetchEmailVerified asks the Auth0 Management API whether the user's email address is verified.
+func FetchEmailVerified(ctx context.Context, userID string) (bool, error) {
+	if userID == "" {
+		return false, errors.New("missing userID")
+	}
+	domain, token, err := managementConfig()
+	if err != nil {
+		return false, err
+	}
+	endpoint := "https://" + domain + "/api/v2/users/" + url.PathEscape(userID) + "?fields=email_verified&include_fields=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := Client.Do(req)
+	if err != nil {
+		log.Errorf("[FetchEmailVerified] Request error: %v", err)
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		log.Warnf("[FetchEmailVerified] Auth0 error: status=%d", resp.StatusCode)
+		return false, fmt.Errorf("auth0 returned status %d", resp.StatusCode)
+	}
+	var body struct {
+		EmailVerified bool `json:"email_verified"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false, err
+	}
+	return body.EmailVerified, nil
+}
+
+// DeleteUser deletes the user from Auth0. A user that no longer exists counts as
+// deleted, so retries after a partial failure are safe.
+func DeleteUser(ctx context.Context, userID string) error {
+	if userID == "" {
+		return errors.New("missing userID")
+	}
+	domain, token, err := managementConfig()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "https://"+domain+"/api/v2/users/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := Client.Do(req)
+	if err != nil {
+		log.Errorf("[DeleteUser] Request error: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound {
+		log.Errorf("[DeleteUser] Auth0 error: status=%d", resp.StatusCode)
+		return fmt.Errorf("auth0 returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// HasPermission reports whether the request's JWT is valid and carries permission in
+// its permissions claim. An empty permission is never granted.
+func HasPermission(r *http.Request, permission string) bool {
+	if permission == "" {
+		return false
+	}
+	claims, err := ValidateAndParseJWT(GetJWTFromRequest(r))
+	if err != nil {
+		return false
+	}
+	perms, _ := claims["permissions"].([]interface{})
+	for _, p := range perms {
+		if pstr, ok := p.(string); ok && pstr == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles names the permissions that make a user staff. Admins can do everything
+// teachers can.
+type Roles struct {
+	Admin   string
+	Teacher string
+}
+
+// IsAdmin reports whether the request is from an admin.
+func (ro Roles) IsAdmin(r *http.Request) bool {
+	return HasPermission(r, ro.Admin)
+}
+
+// IsTeacher reports whether the request is from a teacher or an admin.
+func (ro Roles) IsTeacher(r *http.Request) bool {
+	return HasPermission(r, ro.Teacher) || ro.IsAdmin(r)
+}
@@ -0,0 +1,160 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+
+	"KdnSite/internal/storage"
+)
+
+const (
+	// MaxUploadSize bounds the raw upload accepted from clients.
+	MaxUploadSize = 5 << 20
+	// maxPixels guards against decompression bombs before an image is decoded.
+	maxPixels = 4096 * 4096
+	// URLPrefix is the route avatars are served from.
+	URLPrefix = "/avatars/"
+)
+
+// Sizes are the square edge lengths every avatar is stored at; the first is the default.
+var Sizes = []int{256, 64}
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type, use PNG, JPEG, GIF or WebP")
+	ErrTooLarge        = errors.New("image dimensions are too large")
+
+	allowedTypes = map[string]bool{
+		"image/png":  true,
+		"image/jpeg": true,
+		"image/gif":  true,
+		"image/webp": true,
+	}
+	// nameRe matches the object names generated by Save; anything else is rejected by Serve
+	nameRe = regexp.MustCompile(`^[a-f0-9]{64}_[0-9]+\.png$`)
+)
+
+// Save validates and normalises an uploaded image and stores every size.
+// The image is sniffed from its content (the client's filename and Content-Type are
+// ignored), cropped to a square and re-encoded as PNG, which drops EXIF and any other
+// metadata. Objects are named by the SHA-256 of the user's ID and the normalised image,
+// so re-uploading the same picture reuses the same files but no two users ever share
+// one. It returns the URL of the default size.
+func Save(ctx context.Context, store storage.Storage, userID string, r io.Reader) (string, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, MaxUploadSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(raw) > MaxUploadSize {
+		return "", ErrTooLarge
+	}
+	if !allowedTypes[http.DetectContentType(raw)] {
+		return "", ErrUnsupportedType
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return "", ErrUnsupportedType
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return "", ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", ErrUnsupportedType
+	}
+	src = cropSquare(src)
+
+	encoded := make([][]byte, len(Sizes))
+	for i, size := range Sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, dst); err != nil {
+			return "", err
+		}
+		encoded[i] = buf.Bytes()
+	}
+	h := sha256.New()
+	h.Write([]byte(userID))
+	h.Write([]byte{0})
+	h.Write(encoded[0])
+	hash := hex.EncodeToString(h.Sum(nil))
+	for i, size := range Sizes {
+		if err := store.Put(ctx, key(hash, size), bytes.NewReader(encoded[i]), int64(len(encoded[i])), "image/png"); err != nil {
+			return "", err
+		}
+	}
+	return URLPrefix + name(hash, Sizes[0]), nil
+}
+
+// Delete removes every stored size of the avatar behind url, unless a user still has
+// it as their picture: avatars saved before names included the user could be shared.
+// URLs that were not produced by Save (legacy or external pictures) are ignored.
+func Delete(ctx context.Context, db *sql.DB, store storage.Storage, url string) error {
+	hash, ok := hashFromURL(url)
+	if !ok {
+		return nil
+	}
+	var inUse bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE avatar_url=$1)`, url).Scan(&inUse); err != nil || inUse {
+		return err
+	}
+	var errs []error
+	for _, size := range Sizes {
+		errs = append(errs, store.Delete(ctx, key(hash, size)))
+	}
+	return errors.Join(errs...)
+}
+
+func hashFromURL(url string) (string, bool) {
+	n := strings.TrimPrefix(url, URLPrefix)
+	if n == url || !nameRe.MatchString(n) {
+		return "", false
+	}
+	hash, _, _ := strings.Cut(n, "_")
+	return hash, true
+}
+
+// cropSquare returns the centred square of img.
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	edge := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-edge)/2
+	y0 := b.Min.Y + (b.Dy()-edge)/2
+	square := image.NewRGBA(image.Rect(0, 0, edge, edge))
+	draw.Draw(square, square.Bounds(), img, image.Pt(x0, y0), draw.Src)
+	return square
+}
+
+func name(hash string, size int) string {
+	return fmt.Sprintf("%s_%d.png", hash, size)
+}
+
+func key(hash string, size int) string {
+	return "avatars/" + name(hash, size)
+}
+
+// Open returns the default size of the avatar behind url, or storage.ErrNotFound
+// for URLs that were not produced by Save.
+func Open(ctx context.Context, store storage.Storage, url string) (io.ReadCloser, error) {
+	hash, ok := hashFromURL(url)
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return store.Get(ctx, key(hash, Sizes[0]))
+}
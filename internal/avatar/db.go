@@ -0,0 +1,24 @@
+package avatar
+
+import (
+	"context"
+	"database/sql"
+)
+
+func GetAvatarURL(ctx context.Context, db *sql.DB, userID string) (string, error) {
+	var url sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT avatar_url FROM users WHERE id=$1`, userID).Scan(&url)
+	return url.String, err
+}
+
+// SetAvatarURL returns sql.ErrNoRows if the user has no profile row yet.
+func SetAvatarURL(ctx context.Context, db *sql.DB, userID, url string) error {
+	res, err := db.ExecContext(ctx, `UPDATE users SET avatar_url=$1 WHERE id=$2`, url, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package avatar
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/storage"
+)
+
+// Upload handles POST /api/auth/avatar
+func Upload(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize+1<<20)
+		file, _, err := r.FormFile("avatar")
+		if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+			problem.Write(w, r, problem.PayloadTooLarge("The upload is larger than the avatar size limit."))
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("No file uploaded or file too large"))
+			return
+		}
+		defer file.Close()
+		oldURL, err := GetAvatarURL(r.Context(), db, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				problem.Write(w, r, problem.NotFound("Profile not found"))
+				return
+			}
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		url, err := Save(r.Context(), store, userID, file)
+		if err != nil {
+			if errors.Is(err, ErrUnsupportedType) || errors.Is(err, ErrTooLarge) {
+				problem.Write(w, r, problem.Validation(problem.FieldError{Field: "avatar", Code: "invalid_image", Message: err.Error()}))
+				return
+			}
+			log.Errorf("[avatar.Upload] Failed to store avatar: %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if err := SetAvatarURL(r.Context(), db, userID, url); err != nil {
+			log.Errorf("[avatar.Upload] Failed to update avatar_url: %v", err)
+			if url != oldURL {
+				Delete(r.Context(), db, store, url)
+			}
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if oldURL != "" && oldURL != url {
+			if err := Delete(r.Context(), db, store, oldURL); err != nil {
+				log.Warnf("[avatar.Upload] Failed to delete old avatar %s: %v", oldURL, err)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
+
+// Serve handles GET /avatars/{name}
+func Serve(store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		n := strings.TrimPrefix(r.URL.Path, URLPrefix)
+		if !nameRe.MatchString(n) {
+			problem.Write(w, r, problem.NotFound(""))
+			return
+		}
+		obj, err := store.Get(r.Context(), "avatars/"+n)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				problem.Write(w, r, problem.NotFound(""))
+				return
+			}
+			log.Errorf("[avatar.Serve] Failed to read %s: %v", n, err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		defer obj.Close()
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// Names are content hashes, so a given URL never changes
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		if r.Method == http.MethodHead {
+			return
+		}
+		io.Copy(w, obj)
+	}
+}
@@ -0,0 +1,113 @@
+package classes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrTeacher is returned by Join when the user teaches the class.
+var ErrTeacher = errors.New("you teach this class")
+
+const selectClass = `SELECT c.id, c.name, CASE WHEN c.teacher_id = $1 THEN 'teacher' ELSE 'student' END, c.code,
+	(SELECT COUNT(*) FROM class_members WHERE class_id = c.id), c.created_at
+FROM classes c`
+
+// scanClass reads a row selected by selectClass, hiding the code from students.
+func scanClass(row interface{ Scan(...any) error }) (*Class, error) {
+	var c Class
+	if err := row.Scan(&c.ID, &c.Name, &c.Role, &c.Code, &c.Members, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	if c.Role != "teacher" {
+		c.Code = ""
+	}
+	return &c, nil
+}
+
+// List returns the classes the user teaches or belongs to, by name.
+func List(ctx context.Context, db *sql.DB, userID string) ([]*Class, error) {
+	rows, err := db.QueryContext(ctx, selectClass+`
+WHERE c.teacher_id = $1 OR EXISTS (SELECT 1 FROM class_members WHERE class_id = c.id AND user_id = $1)
+ORDER BY lower(c.name), c.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []*Class{}
+	for rows.Next() {
+		c, err := scanClass(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// Create adds a class taught by teacherID with a new code.
+func Create(ctx context.Context, db *sql.DB, teacherID, name string, now int64) (*Class, error) {
+	c := &Class{ID: uuid.NewString(), Name: strings.TrimSpace(name), Role: "teacher", CreatedAt: now}
+	for attempt := 0; ; attempt++ {
+		c.Code = newCode()
+		_, err := db.ExecContext(ctx, `INSERT INTO classes (id, teacher_id, name, code, created_at) VALUES ($1, $2, $3, $4, $5)`,
+			c.ID, teacherID, c.Name, c.Code, now)
+		if pqErr := (*pq.Error)(nil); errors.As(err, &pqErr) && pqErr.Code == "23505" && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+// Join adds the user to the class with code. Joining a class twice is not an error. It
+// returns sql.ErrNoRows if no class has the code, and ErrTeacher for the class's teacher.
+func Join(ctx context.Context, db *sql.DB, userID, code string, now int64) (*Class, error) {
+	var id, teacherID string
+	err := db.QueryRowContext(ctx, `SELECT id, teacher_id FROM classes WHERE code=$1`, normalizeCode(code)).Scan(&id, &teacherID)
+	if err != nil {
+		return nil, err
+	}
+	if teacherID == userID {
+		return nil, ErrTeacher
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO class_members (class_id, user_id, joined_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		id, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	return scanClass(db.QueryRowContext(ctx, selectClass+` WHERE c.id = $2`, userID, id))
+}
+
+// Leave deletes the class if the user teaches it, or otherwise takes them out of it.
+// It returns sql.ErrNoRows if they are in no such class.
+func Leave(ctx context.Context, db *sql.DB, userID, id string) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM classes WHERE id=$1 AND teacher_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	res, err = db.ExecContext(ctx, `DELETE FROM class_members WHERE class_id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Teaches reports whether the user is the teacher of the class.
+func Teaches(ctx context.Context, db *sql.DB, userID, id string) (bool, error) {
+	var ok bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM classes WHERE id=$1 AND teacher_id=$2)`, id, userID).Scan(&ok)
+	return ok, err
+}
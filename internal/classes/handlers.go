@@ -0,0 +1,117 @@
+package classes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
+)
+
+// ListClasses handles GET /api/classes
+func ListClasses(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		list, err := List(r.Context(), db, userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ListClasses] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+// CreateClass handles POST /api/classes. Only teachers can create classes.
+func CreateClass(db *sql.DB, roles auth.Roles) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		if !roles.IsTeacher(r) {
+			problem.Write(w, r, problem.Forbidden("Only teachers can create classes."))
+			return
+		}
+		var req CreateRequest
+		if err := validate.DecodeJSON(w, r, 4<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		c, err := Create(r.Context(), db, userID, req.Name, time.Now().Unix())
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[CreateClass] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeJSON(w, http.StatusCreated, c)
+	}
+}
+
+// JoinClass handles POST /api/classes/join
+func JoinClass(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req JoinRequest
+		if err := validate.DecodeJSON(w, r, 4<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		switch c, err := Join(r.Context(), db, userID, req.Code, time.Now().Unix()); {
+		case errors.Is(err, sql.ErrNoRows):
+			problem.Write(w, r, problem.Validation(problem.FieldError{Field: "code", Code: "not_found", Message: "does not match a class"}))
+		case errors.Is(err, ErrTeacher):
+			problem.Write(w, r, problem.Conflict("You teach this class."))
+		case err != nil:
+			logging.FromContext(r.Context()).Errorf("[JoinClass] %v", err)
+			problem.Write(w, r, problem.Internal())
+		default:
+			writeJSON(w, http.StatusOK, c)
+		}
+	}
+}
+
+// LeaveClass handles DELETE /api/classes/{id}: the teacher deletes the class, and a
+// student leaves it.
+func LeaveClass(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		switch err := Leave(r.Context(), db, userID, r.PathValue("id")); {
+		case errors.Is(err, sql.ErrNoRows):
+			problem.Write(w, r, problem.NotFound("Class not found"))
+		case err != nil:
+			logging.FromContext(r.Context()).Errorf("[LeaveClass] %v", err)
+			problem.Write(w, r, problem.Internal())
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,48 @@
+// Package classes groups students under a teacher. A teacher creates a class and shares
+// its code; students join with the code and then see what the teacher publishes to the
+// class in the library.
+package classes
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// Class is a class as seen by one of its teacher or students.
+type Class struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`           // "teacher" or "student"
+	Code      string `json:"code,omitempty"` // only shown to the teacher
+	Members   int    `json:"members"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// CreateRequest is the body of POST /api/classes.
+type CreateRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// JoinRequest is the body of POST /api/classes/join.
+type JoinRequest struct {
+	Code string `json:"code" validate:"required,max=20"`
+}
+
+// codeAlphabet leaves out letters and digits that are easily confused when a code is
+// read out in class.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newCode returns a random 8 character class code.
+func newCode() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b)
+}
+
+// normalizeCode makes codes typed in lower case or with spaces match.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(code), ""))
+}
@@ -0,0 +1,340 @@
+// Package config loads and validates all server settings once at startup.
+//
+// Every setting is read from the environment first and then from the optional KEY=VALUE
+// file named by CONFIG_FILE. For any key, KEY_FILE may instead name a file holding the
+// value, which is how Docker and Kubernetes secrets are mounted.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config holds every setting the server reads.
+type Config struct {
+	Env                        string // GO_ENV: "development" or "production"
+	Port                       string
+	AppURL                     string
+	DatabaseURL                string
+	AdminPermission            string
+	TeacherPermission          string
+	TrustedProxies             []string
+	AccountDeletionGracePeriod time.Duration
+	RateLimits                 map[string]RateLimit // by rule name, such as "quiz_attempt"
+	Auth0                      Auth0
+	HTTP                       HTTP
+	Storage                    Storage
+	Log                        Log
+	Tracing                    Tracing
+}
+
+// Auth0 holds the tenant settings used for logins and Management API calls.
+type Auth0 struct {
+	Domain           string
+	ClientID         string
+	ManagementDomain string // defaults to Domain
+	ManagementToken  string
+	WebhookSecret    string
+	DefaultRoleID    string
+}
+
+// HTTP holds the server's timeouts and listen addresses.
+type HTTP struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	MetricsAddr       string
+}
+
+// RateLimit overrides a route's rate limit: Burst requests at once, refilled with one
+// every Every.
+type RateLimit struct {
+	Burst int
+	Every time.Duration
+}
+
+// Storage selects where uploads are kept.
+type Storage struct {
+	Backend string // "local" or "s3"
+	Dir     string
+	S3      S3
+}
+
+// S3 holds the settings for any S3-compatible backend.
+type S3 struct {
+	Endpoint  string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+}
+
+// Log holds the logrus level and output format.
+type Log struct {
+	Level  log.Level
+	Format string // "json" or "text"
+}
+
+// Tracing is enabled when an OTLP endpoint is configured; the exporter reads the
+// remaining standard OTEL_EXPORTER_OTLP_* variables (headers, timeout) itself.
+type Tracing struct {
+	Endpoint    string // full OTLP/HTTP traces URL
+	ServiceName string
+}
+
+// Production reports whether GO_ENV is "production".
+func (c *Config) Production() bool {
+	return c.Env == "production"
+}
+
+// Load reads and validates the configuration, reporting every problem at once.
+func Load() (*Config, error) {
+	s := &source{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := s.readFile(path); err != nil {
+			return nil, fmt.Errorf("reading CONFIG_FILE: %w", err)
+		}
+	}
+
+	c := &Config{
+		Env:                        s.oneOf("GO_ENV", "development", "development", "production"),
+		Port:                       s.str("PORT", "8090"),
+		AppURL:                     s.str("APP_URL", ""),
+		DatabaseURL:                s.required("POSTGRES_DATABASE_URL"),
+		AdminPermission:            s.str("ADMIN_PERMISSION", ""),
+		TeacherPermission:          s.str("TEACHER_PERMISSION", ""),
+		TrustedProxies:             s.list("TRUSTED_PROXIES"),
+		AccountDeletionGracePeriod: s.duration("ACCOUNT_DELETION_GRACE_PERIOD", 7*24*time.Hour),
+		RateLimits:                 s.rateLimits("RATE_LIMIT_"),
+		Auth0: Auth0{
+			Domain:          s.required("AUTH0_DOMAIN"),
+			ClientID:        s.required("AUTH0_CLIENT_ID"),
+			ManagementToken: s.str("AUTH0_MANAGEMENT_TOKEN", ""),
+			WebhookSecret:   s.str("AUTH0_WEBHOOK_SECRET", ""),
+			DefaultRoleID:   s.str("AUTH0_DEFAULT_ROLE_ID", ""),
+		},
+		HTTP: HTTP{
+			ReadHeaderTimeout: s.duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+			ReadTimeout:       s.duration("HTTP_READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:      s.duration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:       s.duration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+			ShutdownTimeout:   s.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+			MetricsAddr:       s.str("METRICS_ADDR", ""),
+		},
+		Storage: Storage{
+			Backend: s.str("STORAGE_BACKEND", "local"),
+			Dir:     s.str("STORAGE_DIR", "./data"),
+			S3: S3{
+				Endpoint:  s.str("S3_ENDPOINT", ""),
+				Bucket:    s.str("S3_BUCKET", ""),
+				AccessKey: s.str("S3_ACCESS_KEY", ""),
+				SecretKey: s.str("S3_SECRET_KEY", ""),
+				Region:    s.str("S3_REGION", ""),
+				UseSSL:    s.boolean("S3_USE_SSL", true),
+			},
+		},
+		Tracing: Tracing{
+			Endpoint:    s.str("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""),
+			ServiceName: s.str("OTEL_SERVICE_NAME", "kdnsite"),
+		},
+	}
+	c.Auth0.ManagementDomain = s.str("AUTH0_MANAGEMENT_DOMAIN", c.Auth0.Domain)
+	if base := s.str("OTEL_EXPORTER_OTLP_ENDPOINT", ""); c.Tracing.Endpoint == "" && base != "" {
+		c.Tracing.Endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+	}
+
+	defaultFormat := "text"
+	if c.Production() {
+		defaultFormat = "json"
+	}
+	c.Log.Format = s.oneOf("LOG_FORMAT", defaultFormat, "json", "text")
+	if level, err := log.ParseLevel(s.str("LOG_LEVEL", "info")); err != nil {
+		s.errs = append(s.errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	} else {
+		c.Log.Level = level
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" {
+			s.errs = append(s.errs, errors.New("S3_ENDPOINT and S3_BUCKET are required when STORAGE_BACKEND=s3"))
+		}
+	default:
+		s.errs = append(s.errs, fmt.Errorf("STORAGE_BACKEND must be local or s3, got %q", c.Storage.Backend))
+	}
+
+	if err := errors.Join(s.errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// source looks settings up and collects validation errors.
+type source struct {
+	file map[string]string
+	errs []error
+}
+
+func (s *source) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s.file = map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("invalid line %q", line)
+		}
+		s.file[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	return scanner.Err()
+}
+
+// lookup returns the raw value of key: the environment wins over the config file, and
+// a value wins over a KEY_FILE reference in the same place.
+func (s *source) lookup(key string) (string, bool) {
+	if v := os.Getenv(key); v != "" {
+		return v, true
+	}
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		return s.secret(key, path)
+	}
+	if v := s.file[key]; v != "" {
+		return v, true
+	}
+	if path := s.file[key+"_FILE"]; path != "" {
+		return s.secret(key, path)
+	}
+	return "", false
+}
+
+func (s *source) secret(key, path string) (string, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s_FILE: %w", key, err))
+		return "", false
+	}
+	return strings.TrimRight(string(b), "\r\n"), true
+}
+
+func (s *source) str(key, def string) string {
+	if v, ok := s.lookup(key); ok {
+		return v
+	}
+	return def
+}
+
+func (s *source) required(key string) string {
+	v, ok := s.lookup(key)
+	if !ok {
+		s.errs = append(s.errs, fmt.Errorf("%s is required", key))
+	}
+	return v
+}
+
+func (s *source) duration(key string, def time.Duration) time.Duration {
+	v, ok := s.lookup(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		s.errs = append(s.errs, fmt.Errorf("%s must be a non-negative duration such as 30s, got %q", key, v))
+		return def
+	}
+	return d
+}
+
+func (s *source) boolean(key string, def bool) bool {
+	v, ok := s.lookup(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s must be true or false, got %q", key, v))
+		return def
+	}
+	return b
+}
+
+func (s *source) list(key string) []string {
+	var out []string
+	for _, v := range strings.Split(s.str(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// keys returns every key set with prefix, in the environment or the config file,
+// directly or as a KEY_FILE reference.
+func (s *source) keys(prefix string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	add := func(key string) {
+		key = strings.TrimSuffix(key, "_FILE")
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		add(key)
+	}
+	for key := range s.file {
+		add(key)
+	}
+	return keys
+}
+
+// rateLimits reads every PREFIX<NAME>="<burst>/<interval>", keyed by the lower-case name.
+func (s *source) rateLimits(prefix string) map[string]RateLimit {
+	limits := map[string]RateLimit{}
+	for _, key := range s.keys(prefix) {
+		v, ok := s.lookup(key)
+		if !ok {
+			continue
+		}
+		burstStr, everyStr, ok := strings.Cut(v, "/")
+		burst, err1 := strconv.Atoi(burstStr)
+		every, err2 := time.ParseDuration(everyStr)
+		if !ok || err1 != nil || err2 != nil || burst <= 0 || every <= 0 {
+			s.errs = append(s.errs, fmt.Errorf("%s must be <burst>/<interval> such as 10/6s, got %q", key, v))
+			continue
+		}
+		limits[strings.ToLower(strings.TrimPrefix(key, prefix))] = RateLimit{Burst: burst, Every: every}
+	}
+	return limits
+}
+
+func (s *source) oneOf(key, def string, allowed ...string) string {
+	v := s.str(key, def)
+	for _, a := range allowed {
+		if v == a {
+			return v
+		}
+	}
+	s.errs = append(s.errs, fmt.Errorf("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), v))
+	return def
+}
@@ -0,0 +1,109 @@
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/problem"
+	"KdnSite/internal/session"
+)
+
+const (
+	// CookieName holds the double-submit token. It is readable by scripts on purpose.
+	CookieName = "csrf_token"
+	// HeaderName is the request header the token must be echoed in.
+	HeaderName = "X-CSRF-Token"
+	// FormField is accepted for plain urlencoded HTML form posts.
+	FormField = "csrf_token"
+)
+
+type contextKey string
+
+const tokenContextKey contextKey = "csrf_token"
+
+// Protect implements double-submit CSRF protection for every state-changing request.
+// Safe methods get a token cookie issued if they do not already carry one. Other
+// methods must echo the cookie value in the X-CSRF-Token header (or csrf_token form
+// field). Requests with a Bearer Authorization header and no auth cookies cannot be
+// forged cross-site and are exempt. secure marks the cookie Secure and should be set
+// in production.
+func Protect(secure bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(CookieName); err == nil && c.Value != "" {
+			token = c.Value
+		}
+		if token == "" {
+			token = newToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    token,
+				Path:     "/",
+				Secure:   secure,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		r = r.WithContext(context.WithValue(r.Context(), tokenContextKey, token))
+
+		if isSafeMethod(r.Method) || hasBearer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		provided := r.Header.Get(HeaderName)
+		if provided == "" && isURLEncodedForm(r) {
+			provided = r.PostFormValue(FormField)
+		}
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			log.Warnf("[csrf.Protect] Rejected %s %s from %s: missing or invalid CSRF token", r.Method, r.URL.Path, r.RemoteAddr)
+			problem.Write(w, r, problem.New(http.StatusForbidden, problem.CodeCSRF, "Missing or invalid CSRF token. Reload the page and try again."))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Token returns the CSRF token for the current request, for embedding in pages.
+func Token(ctx context.Context) string {
+	token, _ := ctx.Value(tokenContextKey).(string)
+	return token
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("csrf: failed to read random bytes: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// hasBearer reports whether r authenticates only with a Bearer token. A browser sends
+// the auth cookies along with any header a page adds, so those requests still need a token.
+func hasBearer(r *http.Request) bool {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return false
+	}
+	for _, name := range []string{"auth_token", session.CookieName} {
+		if _, err := r.Cookie(name); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func isURLEncodedForm(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
@@ -0,0 +1,232 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"KdnSite/internal/avatar"
+	"KdnSite/internal/storage"
+)
+
+// dataset is one file pair in the archive. Every query takes the user ID as $1.
+type dataset struct {
+	name   string
+	query  string
+	csv    bool
+	single bool // exported as one JSON object rather than a list
+}
+
+var datasets = []dataset{
+	{name: "profile", query: `SELECT id, email, username, created_at, avatar_url FROM users WHERE id=$1`, single: true},
+	{name: "projects", query: `SELECT id, title, created_at, updated_at, data FROM projects WHERE owner_id=$1 ORDER BY created_at`, csv: true},
+	{name: "revision_resources", query: `SELECT id, type, tag_names AS tags, (SELECT string_agg(point_id, ', ') FROM revision_resource_spec_points WHERE item_id = revision_resources.id) AS spec_points, content, card, source_id, created_at, updated_at FROM revision_resources WHERE owner_id=$1 ORDER BY created_at`, csv: true},
+	{name: "flashcards", query: `SELECT id, note_id, ord, front, back, media, occlusion, created_at, updated_at FROM flashcards WHERE owner_id=$1 ORDER BY created_at, ord`, csv: true},
+	{name: "resources", query: `SELECT id, type, title, tag_names AS tags, (SELECT string_agg(point_id, ', ') FROM resource_spec_points WHERE item_id = resources.id) AS spec_points, content, visibility, class_id, exam_board, array_to_string(spec_codes, ', ') AS spec_codes, status, moderation_note, published_at, created_at, updated_at FROM resources WHERE owner_id=$1 ORDER BY created_at`, csv: true},
+	{name: "classes", query: `SELECT c.id, c.name, 'teacher' AS role, c.created_at AS joined_at FROM classes c WHERE c.teacher_id=$1
+UNION ALL SELECT c.id, c.name, 'student', m.joined_at FROM class_members m JOIN classes c ON c.id = m.class_id WHERE m.user_id=$1 ORDER BY joined_at`, csv: true},
+	{name: "quiz_attempts", query: `SELECT id, quiz_id, answers, score, timestamp FROM user_quiz_attempts WHERE user_id=$1 ORDER BY timestamp`, csv: true},
+	{name: "question_attempts", query: `SELECT attempt_id, quiz_id, question_id, correct, answered_at FROM question_attempts WHERE user_id=$1 ORDER BY answered_at`, csv: true},
+	{name: "quiz_results", query: `SELECT id, quiz_id, score, started_at, ended_at, answers FROM quiz_results WHERE user_id=$1 ORDER BY started_at`, csv: true},
+	{name: "achievements", query: `SELECT id, name, "desc", earned_at FROM achievements WHERE user_id=$1 ORDER BY earned_at`, csv: true},
+	{name: "leaderboard", query: `SELECT username, score, streak, rank FROM (SELECT *, RANK() OVER (ORDER BY score DESC) AS rank FROM leaderboard) l WHERE user_id=$1`, single: true},
+	{name: "anki_decks", query: `SELECT id, name, created_at, updated_at FROM anki_decks WHERE owner_id=$1 ORDER BY created_at`, csv: true},
+	{name: "anki_cards", query: `SELECT id, deck_id, front, back, media, created_at, updated_at FROM anki_cards WHERE owner_id=$1 ORDER BY created_at`, csv: true},
+	{name: "card_schedules", query: `SELECT card_id, ease, interval_days, repetitions, lapses, due_at, reviewed_at FROM card_schedules WHERE owner_id=$1 ORDER BY due_at`, csv: true},
+	{name: "card_reviews", query: `SELECT id, card_id, grade, interval_days, reviewed_at FROM card_reviews WHERE owner_id=$1 ORDER BY reviewed_at`, csv: true},
+	{name: "exams", query: `SELECT id, title, spec_id, array_to_string(topics, ', ') AS topics, starts_at, created_at, updated_at FROM exams WHERE user_id=$1 ORDER BY starts_at`, csv: true},
+	{name: "study_availability", query: `SELECT timezone, session_minutes, slots, updated_at FROM study_availability WHERE user_id=$1`, csv: true},
+	{name: "plan_sessions", query: `SELECT id, exam_id, area_id, area_title, starts_at, minutes, status, updated_at FROM plan_sessions WHERE user_id=$1 ORDER BY starts_at`, csv: true},
+	{name: "study_sessions", query: `SELECT s.id, s.topic, t.name AS tag, s.planned_minutes, s.status, s.focus_seconds, s.pauses, s.timezone, to_char(s.day, 'YYYY-MM-DD') AS day, s.started_at, s.ended_at FROM study_sessions s LEFT JOIN tags t ON t.id = s.tag_id WHERE s.user_id=$1 ORDER BY s.started_at`, csv: true},
+	{name: "tags", query: `SELECT id, name, slug, created_at FROM tags WHERE owner_id=$1 ORDER BY created_at`, csv: true},
+	{name: "sessions", query: `SELECT device, ip, user_agent, created_at, last_seen_at, expires_at, revoked_at FROM sessions WHERE user_id=$1 ORDER BY created_at`, csv: true},
+}
+
+const readme = `KdnSite data export
+===================
+
+This archive contains everything KdnSite stores about your account, generated %s.
+
+Each dataset is provided as JSON, and tabular datasets also as CSV:
+
+  profile.json             your account profile
+  projects.*               your projects
+  revision_resources.*     your revision flashcards, notes and summaries
+  flashcards.*             cards generated from your flashcard notes
+  resources.*              your general resources, and where you published them
+  classes.*                classes you teach or have joined
+  quiz_attempts.*          quizzes you have taken and your answers
+  question_attempts.*      whether you answered each question in an attempt correctly
+  quiz_results.*           timed quiz results
+  achievements.*           achievements you have earned
+  leaderboard.json         your leaderboard entry
+  tags.*                   the tags you have created
+  anki_decks.*, anki_cards.*  imported Anki decks and cards
+  card_schedules.*         when each flashcard you have studied is next due
+  card_reviews.*           every flashcard review and how you graded it
+  exams.*                  exams you are revising for
+  study_availability.*     the weekly times you can revise
+  plan_sessions.*          your revision timetable and which sessions you did
+  study_sessions.*         your timed study sessions and how long you studied
+  sessions.*               devices you have signed in from
+  avatar.png               your profile picture, if you uploaded one
+
+Timestamps are Unix seconds unless stated otherwise. Your login credentials are held
+by our identity provider (Auth0) and are not part of this export.
+`
+
+// writeArchive writes the user's export zip to w.
+func writeArchive(ctx context.Context, db *sql.DB, store storage.Storage, userID string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("README.txt")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, readme, time.Now().UTC().Format(time.RFC1123))
+
+	var profile map[string]any
+	for _, ds := range datasets {
+		columns, rows, err := queryRows(ctx, db, ds.query, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ds.name, err)
+		}
+		var data any = rows
+		if ds.single {
+			data = nil
+			if len(rows) > 0 {
+				data = rows[0]
+			}
+		}
+		if ds.name == "profile" && len(rows) > 0 {
+			profile = rows[0]
+		}
+		if err := writeJSON(zw, ds.name+".json", data); err != nil {
+			return err
+		}
+		if ds.csv {
+			if err := writeCSV(zw, ds.name+".csv", columns, rows); err != nil {
+				return err
+			}
+		}
+	}
+
+	if url, _ := profile["avatar_url"].(string); url != "" {
+		img, err := avatar.Open(ctx, store, url)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("avatar: %w", err)
+		}
+		if err == nil {
+			defer img.Close()
+			f, err := zw.Create("avatar.png")
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, img); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// queryRows runs query and returns each row as a column-name map with JSON-friendly values.
+func queryRows(ctx context.Context, db *sql.DB, query string, args ...any) ([]string, []map[string]any, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	result := []map[string]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		row := make(map[string]any, len(columns))
+		for i, col := range columns {
+			row[col] = normalize(values[i])
+		}
+		result = append(result, row)
+	}
+	return columns, result, rows.Err()
+}
+
+// normalize turns driver values into types that marshal cleanly: JSON columns stay
+// JSON, other byte slices (e.g. Postgres arrays) become strings.
+func normalize(v any) any {
+	switch t := v.(type) {
+	case []byte:
+		if json.Valid(t) {
+			return json.RawMessage(t)
+		}
+		return string(t)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+func writeJSON(zw *zip.Writer, name string, data any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+func writeCSV(zw *zip.Writer, name string, columns []string, rows []map[string]any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			record[i] = csvValue(row[col])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.RawMessage:
+		return string(t)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,106 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const jobColumns = `id, user_id, status, created_at, COALESCE(completed_at, 0), COALESCE(expires_at, 0), COALESCE(error, ''), COALESCE(object_key, '')`
+
+func CreateJob(ctx context.Context, db *sql.DB, j *Job) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO export_jobs (id, user_id, status, created_at) VALUES ($1, $2, $3, $4)`,
+		j.ID, j.UserID, j.Status, j.CreatedAt)
+	return err
+}
+
+func GetJob(ctx context.Context, db *sql.DB, id, userID string) (*Job, error) {
+	row := db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM export_jobs WHERE id=$1 AND user_id=$2`, id, userID)
+	return scanJob(row)
+}
+
+// LatestJob returns the user's most recent job, or sql.ErrNoRows.
+func LatestJob(ctx context.Context, db *sql.DB, userID string) (*Job, error) {
+	row := db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM export_jobs WHERE user_id=$1 ORDER BY created_at DESC LIMIT 1`, userID)
+	return scanJob(row)
+}
+
+// ClaimJob moves a pending job to running and returns it, or sql.ErrNoRows if another worker got it first.
+func ClaimJob(ctx context.Context, db *sql.DB, id string) (*Job, error) {
+	row := db.QueryRowContext(ctx, `UPDATE export_jobs SET status=$1 WHERE id=$2 AND status=$3 RETURNING `+jobColumns, StatusRunning, id, StatusPending)
+	return scanJob(row)
+}
+
+func CompleteJob(ctx context.Context, db *sql.DB, id, objectKey string, expiresAt int64) error {
+	_, err := db.ExecContext(ctx, `UPDATE export_jobs SET status=$1, object_key=$2, completed_at=$3, expires_at=$4 WHERE id=$5`,
+		StatusReady, objectKey, time.Now().Unix(), expiresAt, id)
+	return err
+}
+
+func FailJob(ctx context.Context, db *sql.DB, id, msg string) error {
+	_, err := db.ExecContext(ctx, `UPDATE export_jobs SET status=$1, error=$2, completed_at=$3 WHERE id=$4`,
+		StatusFailed, msg, time.Now().Unix(), id)
+	return err
+}
+
+// RequeueInterruptedJobs resets jobs left running by a previous process and returns every pending job ID.
+func RequeueInterruptedJobs(ctx context.Context, db *sql.DB) ([]string, error) {
+	if _, err := db.ExecContext(ctx, `UPDATE export_jobs SET status=$1 WHERE status=$2`, StatusPending, StatusRunning); err != nil {
+		return nil, err
+	}
+	return ListPendingJobs(ctx, db, time.Now().Unix()+1)
+}
+
+// ListPendingJobs returns the IDs of pending jobs created before before, oldest first.
+func ListPendingJobs(ctx context.Context, db *sql.DB, before int64) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM export_jobs WHERE status=$1 AND created_at < $2 ORDER BY created_at`, StatusPending, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListExpiredJobs returns ready jobs whose download has expired.
+func ListExpiredJobs(ctx context.Context, db *sql.DB) ([]*Job, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+jobColumns+` FROM export_jobs WHERE status=$1 AND expires_at < $2`, StatusReady, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []*Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func DeleteJob(ctx context.Context, db *sql.DB, id string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM export_jobs WHERE id=$1`, id)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var j Job
+	err := row.Scan(&j.ID, &j.UserID, &j.Status, &j.CreatedAt, &j.CompletedAt, &j.ExpiresAt, &j.Error, &j.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/storage"
+)
+
+// RequestExport handles GET /api/user/export. It returns the user's current export if
+// one is in progress or still downloadable, and otherwise starts a new one.
+func RequestExport(db *sql.DB, worker *Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		job, err := LatestJob(r.Context(), db, userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if job == nil || !reusable(job) {
+			job = &Job{ID: uuid.NewString(), UserID: userID, Status: StatusPending, CreatedAt: time.Now().Unix()}
+			if err := CreateJob(r.Context(), db, job); err != nil {
+				problem.Write(w, r, problem.Internal())
+				return
+			}
+			worker.Enqueue(job.ID)
+		}
+		writeJob(w, job)
+	}
+}
+
+// GetExportStatus handles GET /api/user/export/status?id=
+func GetExportStatus(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		job, err := GetJob(r.Context(), db, r.URL.Query().Get("id"), userID)
+		if err != nil {
+			problem.Write(w, r, problem.NotFound(""))
+			return
+		}
+		writeJob(w, job)
+	}
+}
+
+// DownloadExport handles GET /api/user/export/download?id=
+func DownloadExport(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		job, err := GetJob(r.Context(), db, r.URL.Query().Get("id"), userID)
+		if err != nil || job.Status != StatusReady || job.ExpiresAt < time.Now().Unix() {
+			problem.Write(w, r, problem.NotFound(""))
+			return
+		}
+		obj, err := store.Get(r.Context(), job.ObjectKey)
+		if err != nil {
+			log.Errorf("[export.DownloadExport] Failed to open %s: %v", job.ObjectKey, err)
+			problem.Write(w, r, problem.NotFound(""))
+			return
+		}
+		defer obj.Close()
+		// Archives can take longer to send than the server's write timeout allows
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(10 * time.Minute))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="kdnsite-export-`+time.Unix(job.CompletedAt, 0).UTC().Format("2006-01-02")+`.zip"`)
+		w.Header().Set("Cache-Control", "private, no-store")
+		io.Copy(w, obj)
+	}
+}
+
+// reusable reports whether a new export request should return job instead of starting another.
+func reusable(job *Job) bool {
+	switch job.Status {
+	case StatusPending, StatusRunning:
+		return true
+	case StatusReady:
+		return job.ExpiresAt > time.Now().Unix()
+	}
+	return false
+}
+
+func writeJob(w http.ResponseWriter, job *Job) {
+	status := http.StatusAccepted
+	if job.Status == StatusReady {
+		job.DownloadURL = "/api/user/export/download?id=" + job.ID
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/user/export/status?id="+job.ID)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
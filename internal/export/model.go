@@ -0,0 +1,21 @@
+package export
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// Job is a background export of everything stored about one user.
+type Job struct {
+	ID          string `json:"id"`
+	UserID      string `json:"-"`
+	Status      string `json:"status"`
+	CreatedAt   int64  `json:"created_at"`
+	CompletedAt int64  `json:"completed_at,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ObjectKey   string `json:"-"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
@@ -0,0 +1,161 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/storage"
+)
+
+const (
+	// downloadTTL is how long a finished export can be downloaded before it is deleted.
+	downloadTTL = 7 * 24 * time.Hour
+	// sweepInterval is how often expired archives are removed from storage.
+	sweepInterval = time.Hour
+	// requeueInterval is how often pending jobs that never made it into the queue, or
+	// were dropped from it, are queued again.
+	requeueInterval = time.Minute
+	// jobTimeout bounds the time spent building a single archive.
+	jobTimeout = 10 * time.Minute
+)
+
+// Worker builds export archives in the background, one job at a time.
+type Worker struct {
+	db    *sql.DB
+	store storage.Storage
+	queue chan string
+}
+
+func NewWorker(db *sql.DB, store storage.Storage) *Worker {
+	return &Worker{db: db, store: store, queue: make(chan string, 100)}
+}
+
+// Start requeues jobs interrupted by a restart and processes the queue until ctx is cancelled.
+func (w *Worker) Start(ctx context.Context) {
+	ids, err := RequeueInterruptedJobs(ctx, w.db)
+	if err != nil {
+		log.Errorf("[export.Worker] Failed to requeue interrupted jobs: %v", err)
+	}
+	go func() {
+		for _, id := range ids {
+			w.Enqueue(id)
+		}
+	}()
+	go w.run(ctx)
+}
+
+// Enqueue schedules a pending job. Jobs that do not fit in the queue stay pending
+// in the database and are queued again within a minute or two.
+func (w *Worker) Enqueue(id string) {
+	select {
+	case w.queue <- id:
+	default:
+		log.Warnf("[export.Worker] Queue full, job %s will be queued again later", id)
+	}
+}
+
+func (w *Worker) run(ctx context.Context) {
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+	requeue := time.NewTicker(requeueInterval)
+	defer requeue.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-w.queue:
+			w.process(ctx, id)
+		case <-sweep.C:
+			w.sweepExpired(ctx)
+		case <-requeue.C:
+			w.requeueStale(ctx)
+		}
+	}
+}
+
+// requeueStale queues pending jobs older than requeueInterval again. A job that is
+// still in the queue as well is only built once, as ClaimJob lets one copy through.
+func (w *Worker) requeueStale(ctx context.Context) {
+	ids, err := ListPendingJobs(ctx, w.db, time.Now().Add(-requeueInterval).Unix())
+	if err != nil {
+		log.Errorf("[export.Worker] Failed to list pending jobs: %v", err)
+		return
+	}
+	for _, id := range ids {
+		w.Enqueue(id)
+	}
+}
+
+func (w *Worker) process(ctx context.Context, id string) {
+	shutdown := ctx
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	job, err := ClaimJob(ctx, w.db, id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Errorf("[export.Worker] Failed to claim job %s: %v", id, err)
+		}
+		return
+	}
+	key := "exports/" + job.ID + ".zip"
+	if err := w.build(ctx, job.UserID, key); err != nil {
+		// A job cut short by shutdown stays running, and the next start requeues it
+		if shutdown.Err() != nil {
+			log.Warnf("[export.Worker] Job %s interrupted by shutdown", id)
+			return
+		}
+		log.Errorf("[export.Worker] Job %s failed: %v", id, err)
+		if err := FailJob(context.Background(), w.db, id, "Export failed, please try again later"); err != nil {
+			log.Errorf("[export.Worker] Failed to mark job %s failed: %v", id, err)
+		}
+		return
+	}
+	if err := CompleteJob(ctx, w.db, id, key, time.Now().Add(downloadTTL).Unix()); err != nil {
+		log.Errorf("[export.Worker] Failed to complete job %s: %v", id, err)
+		return
+	}
+	log.Infof("[export.Worker] Job %s ready", id)
+}
+
+// build writes the archive to a temporary file first so its size is known for storage.
+func (w *Worker) build(ctx context.Context, userID, key string) error {
+	tmp, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := writeArchive(ctx, w.db, w.store, userID, tmp); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, 1)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, 0); err != nil {
+		return err
+	}
+	return w.store.Put(ctx, key, tmp, size, "application/zip")
+}
+
+func (w *Worker) sweepExpired(ctx context.Context) {
+	jobs, err := ListExpiredJobs(ctx, w.db)
+	if err != nil {
+		log.Errorf("[export.Worker] Failed to list expired jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if err := w.store.Delete(ctx, job.ObjectKey); err != nil {
+			log.Warnf("[export.Worker] Failed to delete %s: %v", job.ObjectKey, err)
+			continue
+		}
+		if err := DeleteJob(ctx, w.db, job.ID); err != nil {
+			log.Warnf("[export.Worker] Failed to delete job %s: %v", job.ID, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package flashcards
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"KdnSite/internal/markdown"
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
+)
+
+// cards is every card the student can study: those generated from their notes and
+// those imported from Anki, in one shape, with when each is next due for review. Native
+// cards are Markdown and Anki cards HTML; scanCards renders both to sanitised HTML.
+const cards = `SELECT id, source, note_id, deck_id, ord, front, back, media, occlusion, due_at, created_at, updated_at FROM (
+	SELECT c.*, s.due_at FROM (
+		SELECT id, 'native' AS source, note_id, ''::text AS deck_id, ord, front, back, media, occlusion, created_at, updated_at, owner_id
+		FROM flashcards
+		UNION ALL
+		SELECT id, 'anki', '', COALESCE(deck_id, ''), 0, front, back, media, NULL::jsonb, created_at, updated_at, owner_id
+		FROM anki_cards
+	) c LEFT JOIN card_schedules s ON s.owner_id = c.owner_id AND s.card_id = c.id
+) cards WHERE owner_id=$1`
+
+// ReplaceCards stores the cards generated for a note, replacing any it had before. A
+// card keeps its ID, and so its review schedule, while the note still generates a card
+// with its key.
+func ReplaceCards(ctx context.Context, tx *sql.Tx, ownerID, noteID string, generated []Generated, now int64) error {
+	rows, err := tx.QueryContext(ctx, `DELETE FROM flashcards WHERE note_id=$1 RETURNING card_key, id`, noteID)
+	if err != nil {
+		return err
+	}
+	previous := map[string]string{}
+	for rows.Next() {
+		var key, id string
+		if err := rows.Scan(&key, &id); err != nil {
+			rows.Close()
+			return err
+		}
+		previous[key] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, g := range generated {
+		media, err := json.Marshal(g.Media)
+		if err != nil {
+			return err
+		}
+		var occlusion []byte
+		if g.Occlusion != nil {
+			if occlusion, err = json.Marshal(g.Occlusion); err != nil {
+				return err
+			}
+		}
+		id, ok := previous[g.Key]
+		if !ok {
+			id = uuid.NewString()
+		}
+		delete(previous, g.Key)
+		_, err = tx.ExecContext(ctx, `INSERT INTO flashcards (id, note_id, owner_id, ord, card_key, front, back, media, occlusion, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			id, noteID, ownerID, g.Ord, g.Key, g.Front, g.Back, media, occlusion, now, now)
+		if err != nil {
+			return err
+		}
+	}
+	removed := make([]string, 0, len(previous))
+	for _, id := range previous {
+		removed = append(removed, id)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return forgetCards(ctx, tx, ownerID, removed)
+}
+
+// DeleteNoteCards deletes the cards generated from the owner's notes, with their
+// review schedules and history. Call it before deleting the notes.
+func DeleteNoteCards(ctx context.Context, tx *sql.Tx, ownerID string, noteIDs []string) error {
+	var ids pq.StringArray
+	err := tx.QueryRowContext(ctx, `WITH deleted AS (DELETE FROM flashcards WHERE owner_id=$1 AND note_id = ANY($2) RETURNING id)
+SELECT COALESCE(array_agg(id), '{}') FROM deleted`, ownerID, pq.Array(noteIDs)).Scan(&ids)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return forgetCards(ctx, tx, ownerID, ids)
+}
+
+// forgetCards deletes the review schedules and history of cards that no longer exist.
+// Card IDs are not foreign keys there, since they may be native or Anki cards.
+func forgetCards(ctx context.Context, tx *sql.Tx, ownerID string, ids []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM card_schedules WHERE owner_id=$1 AND card_id = ANY($2)`, ownerID, pq.Array(ids)); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM card_reviews WHERE owner_id=$1 AND card_id = ANY($2)`, ownerID, pq.Array(ids))
+	return err
+}
+
+// ListCards returns a page of the user's cards.
+func ListCards(ctx context.Context, db *sql.DB, userID string, q *pagination.Query) ([]*Card, error) {
+	query, args := q.SQL(cards, userID)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*Card
+	for rows.Next() {
+		var (
+			c                Card
+			media, occlusion []byte
+			due              sql.NullInt64
+		)
+		if err := rows.Scan(&c.ID, &c.Source, &c.NoteID, &c.DeckID, &c.Ord, &c.Front, &c.Back, &media, &occlusion, &due, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if due.Valid {
+			c.DueAt = &due.Int64
+		}
+		if c.Source == SourceNative {
+			c.Front, c.Back = markdown.Render(c.Front), markdown.Render(c.Back)
+		} else {
+			c.Front, c.Back = markdown.Sanitize(c.Front), markdown.Sanitize(c.Back)
+		}
+		// Imported media may predate this format; anything unreadable is left out
+		c.Media = []Media{}
+		if len(media) > 0 {
+			var parsed []Media
+			if json.Unmarshal(media, &parsed) == nil {
+				for _, m := range parsed {
+					if validMedia(m) {
+						c.Media = append(c.Media, m)
+					}
+				}
+			}
+		}
+		if len(occlusion) > 0 {
+			c.Occlusion = &Occlusion{}
+			if err := json.Unmarshal(occlusion, c.Occlusion); err != nil {
+				return nil, err
+			}
+		}
+		list = append(list, &c)
+	}
+	return list, rows.Err()
+}
+
+// RecordMedia notes that ownerID uploaded the named attachment. It returns
+// ErrMediaQuota, recording nothing, if a new attachment would take the owner's
+// attachments past MediaQuota.
+func RecordMedia(ctx context.Context, db *sql.DB, name, ownerID, contentType string, size, now int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Uploads by the same student take turns, so two at once cannot both fit the quota
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('flashcard_media:' || $1))`, ownerID); err != nil {
+		return err
+	}
+	var exists bool
+	var used int64
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM flashcard_media WHERE name=$1),
+	COALESCE((SELECT SUM(size) FROM flashcard_media WHERE owner_id=$2), 0)`, name, ownerID).Scan(&exists, &used); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if used+size > MediaQuota {
+		return ErrMediaQuota
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO flashcard_media (name, owner_id, content_type, size, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		name, ownerID, contentType, size, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckMedia returns a validation problem, reported against fields under prefix, if
+// the note uses an attachment that ownerID did not upload.
+func CheckMedia(ctx context.Context, tx *sql.Tx, ownerID string, n *Note, prefix string) error {
+	fields := map[string]string{}
+	if n.Image != nil {
+		fields[mediaName(*n.Image)] = "image"
+	}
+	for i, m := range n.Media {
+		fields[mediaName(m)] = fmt.Sprintf("media[%d]", i)
+	}
+	delete(fields, "")
+	if len(fields) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM flashcard_media WHERE owner_id=$1 AND name = ANY($2)`, ownerID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		delete(fields, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var errs []problem.FieldError
+	for _, field := range fields {
+		errs = append(errs, problem.FieldError{Field: prefix + field, Code: "invalid_media", Message: "must be a file you uploaded to /api/flashcards/media"})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	slices.SortFunc(errs, func(a, b problem.FieldError) int { return strings.Compare(a.Field, b.Field) })
+	return problem.Validation(errs...)
+}
+
+// deleteUnusedMedia forgets the attachments uploaded before before that none of their
+// owner's notes or cards mention, returning their names so the files can be removed.
+func deleteUnusedMedia(ctx context.Context, db *sql.DB, before int64) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `DELETE FROM flashcard_media m WHERE m.created_at < $1
+	AND NOT EXISTS (SELECT 1 FROM revision_resources r WHERE r.owner_id = m.owner_id
+		AND strpos(COALESCE(r.card::text, '') || COALESCE(r.content, ''), m.name) > 0)
+	AND NOT EXISTS (SELECT 1 FROM anki_cards a WHERE a.owner_id = m.owner_id
+		AND strpos(COALESCE(a.media::text, '') || a.front || a.back, m.name) > 0)
+RETURNING m.name`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// ListMediaNames returns the names of every attachment the user uploaded.
+func ListMediaNames(ctx context.Context, db *sql.DB, userID string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM flashcard_media WHERE owner_id=$1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,137 @@
+package flashcards
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Generated is a card produced from a note, before it is stored. Front and Back are
+// Markdown. Key identifies what the card asks about, so it keeps its ID, and its
+// review schedule, across edits that reorder the note.
+type Generated struct {
+	Ord       int
+	Key       string
+	Front     string
+	Back      string
+	Media     []Media
+	Occlusion *Occlusion
+}
+
+// clozeRe matches Anki's cloze syntax, {{c1::answer}} or {{c1::answer::hint}}.
+var clozeRe = regexp.MustCompile(`(?s)\{\{c(\d{1,3})::(.+?)(?:::([^{}]*?))?\}\}`)
+
+// Generate returns the cards for a valid note. Ords order the cards: 1 and 2 for a
+// basic card and its reverse, the cloze number for cloze cards, and the region's
+// position for image occlusion cards. Keys stay the same while the card asks the same
+// thing: the side for basic cards, the region's ID for image occlusion cards, and for
+// cloze cards the number with its answers, so changing an answer starts a new card.
+func Generate(n *Note) []Generated {
+	var cards []Generated
+	switch n.Kind {
+	case KindBasic:
+		cards = append(cards, Generated{Ord: 1, Key: "front", Front: n.Front, Back: withExtra(n.Back, n.Extra)})
+		if n.Reverse {
+			cards = append(cards, Generated{Ord: 2, Key: "reverse", Front: n.Back, Back: withExtra(n.Front, n.Extra)})
+		}
+	case KindCloze:
+		for _, num := range clozeNumbers(n.Text) {
+			cards = append(cards, Generated{
+				Ord:   num,
+				Key:   clozeKey(n.Text, num),
+				Front: renderCloze(n.Text, num, true),
+				Back:  withExtra(renderCloze(n.Text, num, false), n.Extra),
+			})
+		}
+	case KindImageOcclusion:
+		mode := n.Mode
+		if mode == "" {
+			mode = ModeHideAll
+		}
+		header := n.Header
+		if strings.TrimSpace(header) == "" {
+			header = "Name the highlighted structure."
+		}
+		// The masks go out with the front of the card, so they must not carry the answers
+		masks := make([]Region, len(n.Regions))
+		for i, reg := range n.Regions {
+			masks[i] = reg
+			masks[i].Label = ""
+		}
+		for i, reg := range n.Regions {
+			cards = append(cards, Generated{
+				Ord:       i + 1,
+				Key:       "region:" + reg.ID,
+				Front:     header,
+				Back:      withExtra("**"+reg.Label+"**", n.Extra),
+				Occlusion: &Occlusion{Image: *n.Image, Regions: masks, Target: reg.ID, Mode: mode},
+			})
+		}
+	}
+	for i := range cards {
+		cards[i].Media = n.Media
+	}
+	return cards
+}
+
+func withExtra(back, extra string) string {
+	if strings.TrimSpace(extra) == "" {
+		return back
+	}
+	return back + "\n\n" + extra
+}
+
+// clozeNumbers returns the distinct cloze numbers in text, in ascending order.
+func clozeNumbers(text string) []int {
+	var nums []int
+	for _, m := range clozeRe.FindAllStringSubmatch(text, -1) {
+		num, _ := strconv.Atoi(m[1])
+		if num > 0 && !slices.Contains(nums, num) {
+			nums = append(nums, num)
+		}
+	}
+	slices.Sort(nums)
+	return nums
+}
+
+// clozeKey returns the key of the card for cloze number num: the number and a hash of
+// its answers.
+func clozeKey(text string, num int) string {
+	h := sha256.New()
+	for _, m := range clozeRe.FindAllStringSubmatch(text, -1) {
+		if m[1] == strconv.Itoa(num) {
+			h.Write([]byte(m[2]))
+			h.Write([]byte{0})
+		}
+	}
+	return "c" + strconv.Itoa(num) + ":" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// renderCloze returns text for the card asking about cloze number target. On the
+// front, target's deletions are replaced by [...] or their hint; on the back they are
+// shown in bold. Other deletions show their answer as plain text.
+func renderCloze(text string, target int, front bool) string {
+	return clozeRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := clozeRe.FindStringSubmatch(s)
+		num, _ := strconv.Atoi(m[1])
+		answer, hint := m[2], m[3]
+		switch {
+		case num != target:
+			return answer
+		case !front:
+			return "**" + answer + "**"
+		case hint != "":
+			return "**[" + hint + "]**"
+		default:
+			return "**[...]**"
+		}
+	})
+}
+
+// revealCloze returns text with every deletion replaced by its answer.
+func revealCloze(text string) string {
+	return renderCloze(text, 0, false)
+}
@@ -0,0 +1,158 @@
+package flashcards
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/storage"
+)
+
+// listSpec is what GET /api/flashcards can sort and filter by.
+var listSpec = pagination.Spec{
+	IDColumn: "id",
+	Sorts: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Numeric: true},
+		"updated_at": {Column: "updated_at", Numeric: true},
+	},
+	DefaultSort: "created_at",
+	Filters:     map[string]string{"source": "source", "note": "note_id", "deck": "deck_id"},
+	Conditions: map[string]string{
+		// Native cards cover the spec points of the note they were generated from
+		"spec_point": specs.RevisionResources.FilterOn("cards.note_id"),
+		// due=true lists the cards due for review now, and due=false the rest
+		"due": "COALESCE(due_at <= EXTRACT(EPOCH FROM now())::bigint, false) = %s::boolean",
+	},
+	DateColumn: "created_at",
+}
+
+// ListFlashcards handles GET /api/flashcards
+func ListFlashcards(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		q, err := pagination.Parse(r, listSpec)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		list, err := ListCards(r.Context(), db, userID, q)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ListFlashcards] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		pagination.Write(w, pagination.NewPage(q, list, (*Card).cursor))
+	}
+}
+
+// UploadMedia handles POST /api/flashcards/media
+func UploadMedia(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxMediaSize+1<<20)
+		file, header, err := r.FormFile("file")
+		if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+			problem.Write(w, r, problem.PayloadTooLarge("The upload is larger than the attachment size limit."))
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("No file uploaded"))
+			return
+		}
+		defer file.Close()
+		m, size, err := SaveMedia(r.Context(), store, userID, file)
+		if err != nil {
+			if errors.Is(err, ErrUnsupportedMedia) || errors.Is(err, ErrMediaTooLarge) {
+				problem.Write(w, r, problem.Validation(problem.FieldError{Field: "file", Code: "invalid_media", Message: err.Error()}))
+				return
+			}
+			logging.FromContext(r.Context()).Errorf("[flashcards.UploadMedia] Failed to store attachment: %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		name := path.Base(m.URL)
+		if err := RecordMedia(r.Context(), db, name, userID, mediaContentType(name), size, time.Now().Unix()); err != nil {
+			if errors.Is(err, ErrMediaQuota) {
+				DeleteMedia(r.Context(), store, name)
+				problem.Write(w, r, problem.Validation(problem.FieldError{Field: "file", Code: "quota_exceeded", Message: err.Error()}))
+				return
+			}
+			logging.FromContext(r.Context()).Errorf("[flashcards.UploadMedia] Failed to record attachment: %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		m.Name = displayName(header.Filename)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(m)
+	}
+}
+
+// displayName keeps the client's filename only as a label, without any directory.
+func displayName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == "/" || !utf8.ValidString(name) {
+		return ""
+	}
+	if r := []rune(name); len(r) > 100 {
+		name = string(r[:100])
+	}
+	return name
+}
+
+// ServeMedia handles GET /flashcard-media/{name}
+func ServeMedia(store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		n := strings.TrimPrefix(r.URL.Path, MediaURLPrefix)
+		if !mediaNameRe.MatchString(n) {
+			problem.Write(w, r, problem.NotFound(""))
+			return
+		}
+		obj, err := store.Get(r.Context(), mediaKey(n))
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				problem.Write(w, r, problem.NotFound(""))
+				return
+			}
+			logging.FromContext(r.Context()).Errorf("[flashcards.ServeMedia] Failed to read %s: %v", n, err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		defer obj.Close()
+		w.Header().Set("Content-Type", mediaContentType(n))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// Names are content hashes, so a given URL never changes
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		if r.Method == http.MethodHead {
+			return
+		}
+		io.Copy(w, obj)
+	}
+}
@@ -0,0 +1,170 @@
+package flashcards
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	_ "golang.org/x/image/webp"
+
+	"KdnSite/internal/storage"
+)
+
+const (
+	// MaxMediaSize bounds a single uploaded attachment.
+	MaxMediaSize = 10 << 20
+	// maxPixels guards against decompression bombs in uploaded images.
+	maxPixels = 8192 * 8192
+	// MediaQuota bounds the total size of the attachments one student may store.
+	MediaQuota = 200 << 20
+	// MediaURLPrefix is the route attachments are served from.
+	MediaURLPrefix = "/flashcard-media/"
+	// mediaGrace is how long an uploaded attachment is kept before it must be used by a
+	// note, so one uploaded while a note is being written is not swept away.
+	mediaGrace = 24 * time.Hour
+	// mediaSweepInterval is how often unused attachments are removed.
+	mediaSweepInterval = time.Hour
+)
+
+var (
+	ErrUnsupportedMedia = errors.New("unsupported file type, use PNG, JPEG, GIF or WebP images, or MP3, Ogg or WAV audio")
+	ErrMediaTooLarge    = errors.New("file is too large")
+	ErrMediaQuota       = errors.New("attachment storage is full, remove some attachments from your notes first")
+
+	// mediaTypes maps each sniffed content type that may be uploaded to its extension.
+	mediaTypes = map[string]string{
+		"image/png":       "png",
+		"image/jpeg":      "jpg",
+		"image/gif":       "gif",
+		"image/webp":      "webp",
+		"audio/mpeg":      "mp3",
+		"application/ogg": "ogg",
+		"audio/wave":      "wav",
+	}
+	// mediaNameRe matches the object names generated by SaveMedia
+	mediaNameRe = regexp.MustCompile(`^[a-f0-9]{64}\.(png|jpg|gif|webp|mp3|ogg|wav)$`)
+)
+
+// SaveMedia validates and stores an uploaded attachment for ownerID. The type is
+// sniffed from the content, and images are checked to decode within the pixel limit.
+// Objects are named by the SHA-256 of the owner and the content, so one student
+// re-uploading a file reuses it while their files are never shared with another
+// account, and can be removed with it. It returns the stored Media and its size.
+func SaveMedia(ctx context.Context, store storage.Storage, ownerID string, r io.Reader) (Media, int64, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, MaxMediaSize+1))
+	if err != nil {
+		return Media{}, 0, err
+	}
+	if len(raw) > MaxMediaSize {
+		return Media{}, 0, ErrMediaTooLarge
+	}
+	contentType := http.DetectContentType(raw)
+	ext, ok := mediaTypes[contentType]
+	if !ok {
+		return Media{}, 0, ErrUnsupportedMedia
+	}
+	kind := "audio"
+	if strings.HasPrefix(contentType, "image/") {
+		kind = "image"
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+		if err != nil {
+			return Media{}, 0, ErrUnsupportedMedia
+		}
+		if cfg.Width*cfg.Height > maxPixels {
+			return Media{}, 0, ErrMediaTooLarge
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte(ownerID))
+	h.Write([]byte{0})
+	h.Write(raw)
+	name := hex.EncodeToString(h.Sum(nil)) + "." + ext
+	if err := store.Put(ctx, mediaKey(name), bytes.NewReader(raw), int64(len(raw)), contentType); err != nil {
+		return Media{}, 0, err
+	}
+	return Media{URL: MediaURLPrefix + name, Type: kind}, int64(len(raw)), nil
+}
+
+// DeleteMedia removes a stored attachment by name.
+func DeleteMedia(ctx context.Context, store storage.Storage, name string) error {
+	if !mediaNameRe.MatchString(name) {
+		return nil
+	}
+	return store.Delete(ctx, mediaKey(name))
+}
+
+// validMedia reports whether m points at an attachment stored by SaveMedia.
+func validMedia(m Media) bool {
+	if m.Type != "image" && m.Type != "audio" {
+		return false
+	}
+	name := strings.TrimPrefix(m.URL, MediaURLPrefix)
+	return name != m.URL && mediaNameRe.MatchString(name)
+}
+
+// mediaName returns the object name behind a URL returned by the media upload, or ""
+// for anything else.
+func mediaName(m Media) string {
+	if !validMedia(m) {
+		return ""
+	}
+	return strings.TrimPrefix(m.URL, MediaURLPrefix)
+}
+
+// StartMediaSweep removes attachments no note uses any more, every hour until ctx is
+// cancelled.
+func StartMediaSweep(ctx context.Context, db *sql.DB, store storage.Storage) {
+	go func() {
+		ticker := time.NewTicker(mediaSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepMedia(ctx, db, store)
+			}
+		}
+	}()
+}
+
+func sweepMedia(ctx context.Context, db *sql.DB, store storage.Storage) {
+	names, err := deleteUnusedMedia(ctx, db, time.Now().Add(-mediaGrace).Unix())
+	if err != nil {
+		log.Errorf("[flashcards.sweepMedia] Failed to delete unused attachments: %v", err)
+		return
+	}
+	for _, name := range names {
+		if err := DeleteMedia(ctx, store, name); err != nil {
+			log.Warnf("[flashcards.sweepMedia] Failed to delete %s: %v", name, err)
+		}
+	}
+}
+
+// mediaContentType returns the content type an attachment is served with.
+func mediaContentType(name string) string {
+	ext := name[strings.LastIndexByte(name, '.')+1:]
+	for ct, e := range mediaTypes {
+		if e == ext {
+			return ct
+		}
+	}
+	return "application/octet-stream"
+}
+
+func mediaKey(name string) string {
+	return "flashcards/" + name
+}
@@ -0,0 +1,227 @@
+// Package flashcards turns structured flashcard notes into the cards a student
+// studies. A note is written once and may produce several cards: a basic note gives a
+// front and back (and optionally the reverse), a cloze note gives one card per cloze
+// number, and an image occlusion note gives one card per labelled region of a diagram.
+//
+// Generated cards are stored with the same front/back/media shape as imported Anki
+// cards, and both are listed together by GET /api/flashcards.
+package flashcards
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"KdnSite/internal/problem"
+)
+
+// Note kinds.
+const (
+	KindBasic          = "basic"
+	KindCloze          = "cloze"
+	KindImageOcclusion = "image_occlusion"
+)
+
+// Occlusion modes: hide every region and ask about one, or hide only the one asked about.
+const (
+	ModeHideAll = "hide_all"
+	ModeHideOne = "hide_one"
+)
+
+// Card sources.
+const (
+	SourceNative = "native"
+	SourceAnki   = "anki"
+)
+
+const (
+	maxTextLength = 20000
+	maxRegions    = 50
+	maxMedia      = 20
+	// maxCards bounds how many cards one note may generate.
+	maxCards = 100
+)
+
+// Note is the structured content of a flashcard revision resource. Text fields are
+// Markdown, so they may use maths, chemistry and images like any other note.
+type Note struct {
+	Kind string `json:"kind"`
+	// Front and Back are used by basic notes. Reverse adds a second card from back to front.
+	Front   string `json:"front,omitempty"`
+	Back    string `json:"back,omitempty"`
+	Reverse bool   `json:"reverse,omitempty"`
+	// Text is a cloze note, with deletions written {{c1::answer}} or {{c1::answer::hint}}.
+	Text string `json:"text,omitempty"`
+	// Image, Regions and Mode make up an image occlusion note. Header is an optional
+	// question shown on every card, such as "Label the heart".
+	Image   *Media   `json:"image,omitempty"`
+	Regions []Region `json:"regions,omitempty"`
+	Mode    string   `json:"mode,omitempty"`
+	Header  string   `json:"header,omitempty"`
+	// Extra is shown on the back of every card the note generates.
+	Extra string `json:"extra,omitempty"`
+	// Media are attachments, such as pronunciation audio, shown with every card.
+	Media []Media `json:"media,omitempty"`
+}
+
+// Region is a labelled area of an occlusion image. Coordinates are fractions of the
+// image's width and height, so they do not depend on the size it is shown at.
+type Region struct {
+	ID     string  `json:"id"`
+	Label  string  `json:"label,omitempty"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Media is an uploaded attachment. URL is always one returned by the media upload.
+type Media struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+	Type string `json:"type"` // image or audio
+}
+
+// Occlusion is what an image occlusion card needs to draw its masks: the image, every
+// region without its label, and which region the card asks about.
+type Occlusion struct {
+	Image   Media    `json:"image"`
+	Regions []Region `json:"regions"`
+	Target  string   `json:"target"`
+	Mode    string   `json:"mode"`
+}
+
+// Card is a single card to study, generated from a note or imported from Anki. Front
+// and Back are sanitised HTML, safe to insert into a page.
+type Card struct {
+	ID        string     `json:"id"`
+	Source    string     `json:"source"`
+	NoteID    string     `json:"note_id,omitempty"`
+	DeckID    string     `json:"deck_id,omitempty"`
+	Ord       int        `json:"ord"`
+	Front     string     `json:"front"`
+	Back      string     `json:"back"`
+	Media     []Media    `json:"media"`
+	Occlusion *Occlusion `json:"occlusion,omitempty"`
+	// DueAt is when the card is next due for review, or nil if it has never been reviewed.
+	DueAt     *int64 `json:"due_at"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// cursor returns the card's value for a list sort key, and its ID.
+func (c *Card) cursor(sortKey string) (string, string) {
+	if sortKey == "updated_at" {
+		return strconv.FormatInt(c.UpdatedAt, 10), c.ID
+	}
+	return strconv.FormatInt(c.CreatedAt, 10), c.ID
+}
+
+// Validate checks the note for its kind and reports problems against fields under
+// prefix, such as "card.front".
+func (n *Note) Validate(prefix string) []problem.FieldError {
+	var errs []problem.FieldError
+	fail := func(field, code, msg string) {
+		errs = append(errs, problem.FieldError{Field: prefix + field, Code: code, Message: msg})
+	}
+	required := func(field, value string) {
+		if strings.TrimSpace(value) == "" {
+			fail(field, "required", "is required")
+		}
+	}
+	for _, f := range []struct{ field, value string }{
+		{"front", n.Front}, {"back", n.Back}, {"text", n.Text}, {"header", n.Header}, {"extra", n.Extra},
+	} {
+		if utf8.RuneCountInString(f.value) > maxTextLength {
+			fail(f.field, "too_long", fmt.Sprintf("must be at most %d characters", maxTextLength))
+		}
+	}
+	switch n.Kind {
+	case KindBasic:
+		required("front", n.Front)
+		required("back", n.Back)
+	case KindCloze:
+		required("text", n.Text)
+		if strings.TrimSpace(n.Text) != "" {
+			switch nums := clozeNumbers(n.Text); {
+			case len(nums) == 0:
+				fail("text", "no_cloze", "must contain at least one deletion such as {{c1::answer}}")
+			case len(nums) > maxCards:
+				fail("text", "too_many_cards", fmt.Sprintf("must number at most %d deletions", maxCards))
+			}
+		}
+	case KindImageOcclusion:
+		if n.Image == nil {
+			fail("image", "required", "is required")
+		} else if !validMedia(*n.Image) || n.Image.Type != "image" {
+			fail("image", "invalid_media", "must be an image uploaded to /api/flashcards/media")
+		}
+		if n.Mode != "" && n.Mode != ModeHideAll && n.Mode != ModeHideOne {
+			fail("mode", "invalid_choice", "must be one of "+ModeHideAll+", "+ModeHideOne)
+		}
+		switch {
+		case len(n.Regions) == 0:
+			fail("regions", "required", "is required")
+		case len(n.Regions) > maxRegions:
+			fail("regions", "too_long", fmt.Sprintf("must be at most %d items", maxRegions))
+		}
+		seen := map[string]bool{}
+		for i, reg := range n.Regions {
+			field := fmt.Sprintf("regions[%d]", i)
+			switch {
+			case reg.ID == "" || len(reg.ID) > 64:
+				fail(field+".id", "required", "is required and at most 64 characters")
+			case seen[reg.ID]:
+				fail(field+".id", "duplicate", "must be unique")
+			}
+			seen[reg.ID] = true
+			required(field+".label", reg.Label)
+			if !inUnit(reg.X, reg.Width) || !inUnit(reg.Y, reg.Height) || reg.Width <= 0 || reg.Height <= 0 {
+				fail(field, "out_of_bounds", "must lie within the image, as fractions from 0 to 1")
+			}
+		}
+	default:
+		fail("kind", "invalid_choice", "must be one of "+KindBasic+", "+KindCloze+", "+KindImageOcclusion)
+	}
+	if len(n.Media) > maxMedia {
+		fail("media", "too_long", fmt.Sprintf("must be at most %d items", maxMedia))
+	}
+	for i, m := range n.Media {
+		if !validMedia(m) {
+			fail(fmt.Sprintf("media[%d]", i), "invalid_media", "must be a file uploaded to /api/flashcards/media")
+		}
+	}
+	return errs
+}
+
+func inUnit(start, length float64) bool {
+	return start >= 0 && length >= 0 && start+length <= 1+1e-9
+}
+
+// Summary returns the note as plain Markdown, stored as the revision resource's
+// content so it is searchable and readable without the card view.
+func (n *Note) Summary() string {
+	var parts []string
+	switch n.Kind {
+	case KindBasic:
+		parts = append(parts, n.Front, n.Back)
+	case KindCloze:
+		parts = append(parts, revealCloze(n.Text))
+	case KindImageOcclusion:
+		parts = append(parts, n.Header)
+		labels := make([]string, len(n.Regions))
+		for i, reg := range n.Regions {
+			labels[i] = "- " + reg.Label
+		}
+		parts = append(parts, strings.Join(labels, "\n"))
+	}
+	parts = append(parts, n.Extra)
+	var out []string
+	for _, p := range parts {
+		if strings.TrimSpace(p) != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, "\n\n")
+}
@@ -0,0 +1,182 @@
+package flashcards
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
+)
+
+// Review grades, from forgotten to effortless.
+const (
+	GradeAgain = "again"
+	GradeHard  = "hard"
+	GradeGood  = "good"
+	GradeEasy  = "easy"
+)
+
+const (
+	startEase = 2.5
+	minEase   = 1.3
+	// relearnDelay is how soon a forgotten card comes back.
+	relearnDelay = 10 * time.Minute
+)
+
+// Schedule is when a card is next due, worked out with a variant of SM-2: each
+// successful review multiplies the interval by the card's ease, and forgetting a card
+// starts it again and makes it harder.
+type Schedule struct {
+	CardID       string  `json:"card_id"`
+	Ease         float64 `json:"ease"`
+	IntervalDays float64 `json:"interval_days"`
+	Repetitions  int     `json:"repetitions"`
+	Lapses       int     `json:"lapses"`
+	DueAt        int64   `json:"due_at"`
+	ReviewedAt   int64   `json:"reviewed_at"`
+}
+
+// ReviewRequest is the body of POST /api/flashcards/{id}/review.
+type ReviewRequest struct {
+	Grade string `json:"grade" validate:"required,oneof=again hard good easy"`
+}
+
+// Review updates the schedule for a review with grade at now. A card never reviewed
+// before has a zero Schedule.
+func (s *Schedule) Review(grade string, now time.Time) {
+	if s.Ease == 0 {
+		s.Ease = startEase
+	}
+	due := now
+	switch grade {
+	case GradeAgain:
+		s.Lapses++
+		s.Repetitions = 0
+		s.Ease = math.Max(minEase, s.Ease-0.2)
+		s.IntervalDays = relearnDelay.Hours() / 24
+		due = now.Add(relearnDelay)
+	default:
+		switch {
+		case grade == GradeHard:
+			s.Ease = math.Max(minEase, s.Ease-0.15)
+			s.IntervalDays = math.Max(1, s.IntervalDays*1.2)
+		case s.Repetitions == 0:
+			s.IntervalDays = 1
+		case s.Repetitions == 1:
+			s.IntervalDays = 3
+		default:
+			s.IntervalDays *= s.Ease
+		}
+		if grade == GradeEasy {
+			s.Ease += 0.15
+			s.IntervalDays = math.Max(4, s.IntervalDays*1.3)
+		}
+		s.Repetitions++
+		due = now.Add(time.Duration(s.IntervalDays * 24 * float64(time.Hour)))
+	}
+	s.DueAt = due.Unix()
+	s.ReviewedAt = now.Unix()
+}
+
+// Retention estimates the chance that a card reviewed on this schedule is still
+// remembered at now. Intervals are chosen so that it falls to 90% when the card is due.
+func (s *Schedule) Retention(now int64) float64 {
+	interval := math.Max(s.IntervalDays, relearnDelay.Hours()/24) * 86400
+	elapsed := math.Max(0, float64(now-s.ReviewedAt))
+	return math.Pow(0.9, elapsed/interval)
+}
+
+// getSchedule returns the user's schedule for a card, or sql.ErrNoRows if the card is
+// not theirs. A card never reviewed has a zero schedule.
+func getSchedule(ctx context.Context, db *sql.DB, userID, cardID string) (*Schedule, error) {
+	var (
+		ease, interval              sql.NullFloat64
+		reps, lapses, due, reviewed sql.NullInt64
+	)
+	err := db.QueryRowContext(ctx, `SELECT s.ease, s.interval_days, s.repetitions, s.lapses, s.due_at, s.reviewed_at
+FROM (SELECT id, owner_id FROM flashcards UNION ALL SELECT id, owner_id FROM anki_cards) c
+LEFT JOIN card_schedules s ON s.owner_id = c.owner_id AND s.card_id = c.id
+WHERE c.id=$1 AND c.owner_id=$2`, cardID, userID).Scan(&ease, &interval, &reps, &lapses, &due, &reviewed)
+	if err != nil {
+		return nil, err
+	}
+	return &Schedule{
+		CardID:       cardID,
+		Ease:         ease.Float64,
+		IntervalDays: interval.Float64,
+		Repetitions:  int(reps.Int64),
+		Lapses:       int(lapses.Int64),
+		DueAt:        due.Int64,
+		ReviewedAt:   reviewed.Int64,
+	}, nil
+}
+
+// saveReview stores the schedule after a review, and the review itself.
+func saveReview(ctx context.Context, db *sql.DB, userID, grade string, s *Schedule) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO card_schedules (owner_id, card_id, ease, interval_days, repetitions, lapses, due_at, reviewed_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (owner_id, card_id) DO UPDATE SET ease=EXCLUDED.ease, interval_days=EXCLUDED.interval_days,
+	repetitions=EXCLUDED.repetitions, lapses=EXCLUDED.lapses, due_at=EXCLUDED.due_at, reviewed_at=EXCLUDED.reviewed_at`,
+		userID, s.CardID, s.Ease, s.IntervalDays, s.Repetitions, s.Lapses, s.DueAt, s.ReviewedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO card_reviews (id, owner_id, card_id, grade, interval_days, reviewed_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		uuid.NewString(), userID, s.CardID, grade, s.IntervalDays, s.ReviewedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReviewCard handles POST /api/flashcards/{id}/review
+func ReviewCard(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req ReviewRequest
+		if err := validate.DecodeJSON(w, r, 1<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		s, err := getSchedule(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Card not found"))
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ReviewCard] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		s.Review(req.Grade, time.Now())
+		if err := saveReview(r.Context(), db, userID, req.Grade, s); err != nil {
+			logging.FromContext(r.Context()).Errorf("[ReviewCard] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+	}
+}
@@ -2,17 +2,20 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
-	"os"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"KdnSite/internal/account"
 	"KdnSite/internal/auth"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/session"
+	"KdnSite/internal/validate"
 )
 
 type AuthCallbackRequest struct {
@@ -24,14 +27,13 @@ func HandleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	log.Infof("[HandleAuthCallback] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 	if r.Method != http.MethodPost {
 		log.Warnf("[HandleAuthCallback] Method not allowed: %s", r.Method)
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Write(w, r, problem.MethodNotAllowed())
 		return
 	}
 	var req AuthCallbackRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
-		log.Warnf("[HandleAuthCallback] Invalid token in request: err=%v, body=%v", err, r.Body)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid token"))
+		log.Warnf("[HandleAuthCallback] Invalid token in request: %v", err)
+		problem.Write(w, r, problem.BadRequest("invalid token"))
 		return
 	}
 	// Detect method used for token (if client provides a hint)
@@ -41,9 +43,21 @@ func HandleAuthCallback(w http.ResponseWriter, r *http.Request) {
 		method = "unknown"
 	}
 	log.Infof("[HandleAuthCallback] Token received via: %s", method)
-	secure := true
-	if os.Getenv("GO_ENV") != "production" {
-		secure = false
+	secure := appConfig.Production()
+	claims, err := auth.ValidateAndParseJWT(req.Token)
+	if err == nil {
+		revoked, err := session.TokenRevoked(r.Context(), appDB, session.HashToken(req.Token))
+		if err != nil {
+			log.Errorf("[HandleAuthCallback] Failed to check session: %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if revoked {
+			log.Warnf("[HandleAuthCallback] Revoked token replayed from %s", r.RemoteAddr)
+			clearAuthCookies(w)
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
 	}
 	cookie := &http.Cookie{
 		Name:     "auth_token",
@@ -56,18 +70,41 @@ func HandleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	}
 	http.SetCookie(w, cookie)
 	log.Infof("[HandleAuthCallback] Set auth_token cookie for remote=%s, secure=%v, path=%s, expires=%v", r.RemoteAddr, secure, cookie.Path, cookie.Expires)
-	claims, err := auth.ValidateAndParseJWT(req.Token)
 	if err == nil {
-		domain := os.Getenv("AUTH0_DOMAIN")
+		userID, _ := claims["sub"].(string)
+		// A token that already has a session keeps it rather than starting another
+		s, err := session.GetSessionByTokenHash(r.Context(), appDB, session.HashToken(req.Token))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Errorf("[HandleAuthCallback] Failed to look up session: %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if s == nil || !s.Valid(userID, req.Token) {
+			s = session.New(r, userID, req.Token)
+			if err := session.CreateSession(r.Context(), appDB, s); err != nil {
+				log.Errorf("[HandleAuthCallback] Failed to create session: %v", err)
+				problem.Write(w, r, problem.Internal())
+				return
+			}
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     session.CookieName,
+			Value:    s.ID,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   secure,
+			SameSite: http.SameSiteLaxMode,
+			Expires:  cookie.Expires,
+		})
+		domain := appConfig.Auth0.Domain
 		connClaim := "https://" + domain + "/connection"
 		if conn, ok := claims[connClaim].(string); ok && conn == "Username-Password-Authentication" {
 			emailVerified, _ := claims["email_verified"].(bool)
 			if !emailVerified {
-				userID, _ := claims["sub"].(string)
-				err := SendVerificationEmail(userID)
+				err := SendVerificationEmail(r.Context(), userID)
 				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					w.Write([]byte("Failed to send verification email: " + err.Error()))
+					log.Errorf("[HandleAuthCallback] Failed to send verification email: %v", err)
+					problem.Write(w, r, problem.Upstream("Failed to send verification email"))
 					return
 				}
 				// Redirect user to verify email page
@@ -82,103 +119,138 @@ func HandleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ok"))
 }
 
-// POST /api/auth/logout - clears the auth_token cookie
+// POST /api/auth/logout - revokes the current session and clears the auth cookies
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Write(w, r, problem.MethodNotAllowed())
 		return
 	}
-	cookie := &http.Cookie{
-		Name:     "auth_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
+	if userID, err := getUserIDFromJWT(r); err == nil {
+		if c, err := r.Cookie(session.CookieName); err == nil {
+			if err := session.RevokeSession(r.Context(), appDB, c.Value, userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Errorf("[LogoutHandler] Failed to revoke session: %v", err)
+			}
+		}
 	}
-	http.SetCookie(w, cookie)
+	clearAuthCookies(w)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("logged out"))
 }
 
-// POST /api/auth/delete - deletes the user from Auth0
-func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-	userID, err := getUserIDFromJWT(r)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
+// clearAuthCookies expires the auth_token and session cookies
+func clearAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{"auth_token", session.CookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+		})
 	}
-	// Remove all user data from DB
-	dbURL := os.Getenv("POSTGRES_DATABASE_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err == nil {
-		defer db.Close()
-		db.Exec(`DELETE FROM anki_cards WHERE owner_id = $1`, userID)
-		db.Exec(`DELETE FROM anki_decks WHERE owner_id = $1`, userID)
-		db.Exec(`DELETE FROM revision_resources WHERE owner_id = $1`, userID)
-		db.Exec(`DELETE FROM resources WHERE owner_id = $1`, userID)
-		db.Exec(`DELETE FROM leaderboard WHERE user_id = $1`, userID)
-		db.Exec(`DELETE FROM projects WHERE owner_id = $1`, userID)
-		db.Exec(`DELETE FROM users WHERE id = $1`, userID)
-	}
-	domain := os.Getenv("AUTH0_DOMAIN")
-	apiToken := os.Getenv("AUTH0_MANAGEMENT_TOKEN")
-	if domain == "" || apiToken == "" {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Auth0 config missing"))
-		return
+}
+
+// POST /api/auth/delete - schedules the account for deletion after the grace period and signs out
+func DeleteAccountHandler(svc *account.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := getUserIDFromJWT(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		d, err := svc.Schedule(r.Context(), userID)
+		if err != nil {
+			log.Errorf("[DeleteAccountHandler] Failed to schedule deletion: %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		clearAuthCookies(w)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(d)
 	}
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("DELETE", "https://"+domain+"/api/v2/users/"+userID, nil)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+}
+
+// GET /api/auth/delete/status - returns the user's pending deletion, if any
+func AccountDeletionStatusHandler(svc *account.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := getUserIDFromJWT(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		d, err := svc.Status(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound(""))
+			return
+		} else if err != nil {
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
 	}
-	req.Header.Set("Authorization", "Bearer "+apiToken)
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode >= 400 {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to delete user in Auth0"))
-		return
+}
+
+// POST /api/auth/delete/cancel - cancels a pending account deletion
+func CancelAccountDeletionHandler(svc *account.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := getUserIDFromJWT(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		if err := svc.Cancel(r.Context(), userID); errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound(""))
+			return
+		} else if err != nil {
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 	}
-	LogoutHandler(w, r)
 }
 
 // POST /api/auth/change-password - triggers Auth0 password change email
 func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Write(w, r, problem.MethodNotAllowed())
 		return
 	}
 	var req struct {
-		Email string `json:"email"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Missing email"))
-		return
+		Email string `json:"email" validate:"required,max=254"`
 	}
-	domain := os.Getenv("AUTH0_DOMAIN")
-	clientID := os.Getenv("AUTH0_CLIENT_ID")
-	if domain == "" || clientID == "" {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Auth0 config missing"))
+	if err := validate.DecodeJSON(w, r, 4<<10, &req); err != nil {
+		problem.Error(w, r, err)
 		return
 	}
+	domain := appConfig.Auth0.Domain
+	clientID := appConfig.Auth0.ClientID
 	payload := map[string]string{
 		"client_id":  clientID,
 		"email":      req.Email,
 		"connection": "Username-Password-Authentication",
 	}
 	body, _ := json.Marshal(payload)
-	resp, err := http.Post("https://"+domain+"/dbconnections/change_password", "application/json", bytes.NewReader(body))
+	reqAPI, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, "https://"+domain+"/dbconnections/change_password", bytes.NewReader(body))
+	reqAPI.Header.Set("Content-Type", "application/json")
+	resp, err := auth.Client.Do(reqAPI)
 	if err != nil || resp.StatusCode >= 400 {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to trigger password change"))
+		log.Errorf("[ChangePasswordHandler] Auth0 password change failed: err=%v", err)
+		problem.Write(w, r, problem.Upstream("Failed to trigger password change"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -188,184 +260,108 @@ func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 // POST /api/auth/resend-verification - triggers Auth0 verification email
 func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Write(w, r, problem.MethodNotAllowed())
 		return
 	}
 	userID, err := getUserIDFromJWT(r)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		problem.Write(w, r, problem.Unauthorized())
 		return
 	}
-	err = SendVerificationEmail(userID)
+	err = SendVerificationEmail(r.Context(), userID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to send verification email: " + err.Error()))
+		log.Errorf("[ResendVerificationHandler] Failed to send verification email: %v", err)
+		problem.Write(w, r, problem.Upstream("Failed to send verification email"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Verification email sent"))
 }
 
-// POST /api/auth/logout-all - logs out user from all sessions (Auth0 global logout)
+// POST /api/auth/logout-all - revokes every session of the user, then redirects to the Auth0 global logout
 func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Write(w, r, problem.MethodNotAllowed())
 		return
 	}
-	// Just clear the cookie and redirect to Auth0 logout endpoint
-	cookie := &http.Cookie{
-		Name:     "auth_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
+	userID, err := getUserIDFromJWT(r)
+	if err != nil {
+		problem.Write(w, r, problem.Unauthorized())
+		return
 	}
-	http.SetCookie(w, cookie)
-	domain := os.Getenv("AUTH0_DOMAIN")
-	clientID := os.Getenv("AUTH0_CLIENT_ID")
-	if domain == "" || clientID == "" {
-		w.WriteHeader(http.StatusOK)
+	if err := session.RevokeAllSessions(r.Context(), appDB, userID); err != nil {
+		log.Errorf("[LogoutAllHandler] Failed to revoke sessions: %v", err)
+		problem.Write(w, r, problem.Internal())
 		return
 	}
-	logoutURL := "https://" + domain + "/v2/logout?client_id=" + clientID + "&returnTo=" + os.Getenv("APP_URL")
+	clearAuthCookies(w)
+	domain := appConfig.Auth0.Domain
+	clientID := appConfig.Auth0.ClientID
+	logoutURL := "https://" + domain + "/v2/logout?client_id=" + clientID + "&returnTo=" + appConfig.AppURL
 	w.Header().Set("HX-Redirect", logoutURL)
 	w.WriteHeader(http.StatusOK)
 }
 
-// GET /api/auth/sessions - (stub) returns active sessions (requires Auth0 Enterprise for full support)
-func SessionsHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("Session listing not supported on free Auth0 tier."))
-}
-
 // POST /api/auth/change-username - changes the user's username in Auth0
 func ChangeUsernameHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Write(w, r, problem.MethodNotAllowed())
 		return
 	}
 	var req struct {
-		Username string `json:"username"`
+		Username string `json:"username" validate:"required,max=50"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
-		log.Errorf("[ChangeUsernameHandler] Bad request: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Missing username"))
+	if err := validate.DecodeJSON(w, r, 4<<10, &req); err != nil {
+		problem.Error(w, r, err)
 		return
 	}
 	userID, err := getUserIDFromJWT(r)
 	if err != nil {
 		log.Errorf("[ChangeUsernameHandler] Unauthorized: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("Unauthorized"))
+		problem.Write(w, r, problem.Unauthorized())
 		return
 	}
-	domain := os.Getenv("AUTH0_DOMAIN")
-	apiToken := os.Getenv("AUTH0_MANAGEMENT_TOKEN")
+	domain := appConfig.Auth0.Domain
+	apiToken := appConfig.Auth0.ManagementToken
 	if domain == "" || apiToken == "" {
 		log.Errorf("[ChangeUsernameHandler] Auth0 config missing: domain=%v, token=%v", domain, apiToken != "")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Auth0 config missing"))
+		problem.Write(w, r, problem.Internal())
 		return
 	}
-	client := &http.Client{Timeout: 10 * time.Second}
 	payload := map[string]interface{}{
 		"nickname": req.Username, // Auth0 uses "nickname" for display name
 	}
 	body, _ := json.Marshal(payload)
 	url := "https://" + domain + "/api/v2/users/" + userID
-	reqAPI, _ := http.NewRequest("PATCH", url, bytes.NewReader(body))
+	reqAPI, _ := http.NewRequestWithContext(r.Context(), "PATCH", url, bytes.NewReader(body))
 	reqAPI.Header.Set("Authorization", "Bearer "+apiToken)
 	reqAPI.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(reqAPI)
+	resp, err := auth.Client.Do(reqAPI)
 	if err != nil {
 		log.Errorf("[ChangeUsernameHandler] HTTP error: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to update username in Auth0 (HTTP error)"))
+		problem.Write(w, r, problem.Upstream("Failed to update username"))
 		return
 	}
 	if resp.StatusCode >= 400 {
 		log.Errorf("[ChangeUsernameHandler] Auth0 error: status=%d", resp.StatusCode)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to update username in Auth0 (bad status)"))
+		problem.Write(w, r, problem.Upstream("Failed to update username"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Username updated in Auth0"))
 }
 
-// POST /api/auth/avatar - upload and update user avatar
-func AvatarUploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-	userID, err := getUserIDFromJWT(r)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-	err = r.ParseMultipartForm(10 << 20) // 10MB max
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid form data"))
-		return
-	}
-	file, handler, err := r.FormFile("avatar")
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("No file uploaded"))
-		return
-	}
-	defer file.Close()
-	// Save file to local disk (or S3, etc.)
-	avatarDir := "./assets/avatars/"
-	os.MkdirAll(avatarDir, 0755)
-	filename := userID + "_" + time.Now().Format("20060102150405") + "_" + handler.Filename
-	avatarPath := avatarDir + filename
-	out, err := os.Create(avatarPath)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to save avatar"))
-		return
-	}
-	defer out.Close()
-	_, err = io.Copy(out, file)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to save avatar"))
-		return
-	}
-	// Update user profile in DB
-	dbURL := os.Getenv("POSTGRES_DATABASE_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err == nil {
-		defer db.Close()
-		db.Exec(`UPDATE users SET avatar_url = $1 WHERE id = $2`, "/assets/avatars/"+filename, userID)
-	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("ok"))
-}
-
 // GET /api/auth/email - returns the current user's email
 func GetCurrentUserEmailHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromJWT(r)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		problem.Write(w, r, problem.Unauthorized())
 		return
 	}
-	dbURL := os.Getenv("POSTGRES_DATABASE_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
 	var email string
-	err = db.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	err = appDB.QueryRowContext(r.Context(), `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
 	if err != nil || email == "" {
-		w.WriteHeader(http.StatusNotFound)
+		problem.Write(w, r, problem.NotFound(""))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -414,23 +410,22 @@ func getUserClaimsFromJWT(r *http.Request) (userID string, emailVerified bool, r
 }
 
 // Helper: Assign default role to user (call from callback or user provisioning)
-func AssignDefaultRole(userID string) error {
-	domain := os.Getenv("AUTH0_DOMAIN")
-	apiToken := os.Getenv("AUTH0_MANAGEMENT_TOKEN")
+func AssignDefaultRole(ctx context.Context, userID string) error {
+	domain := appConfig.Auth0.Domain
+	apiToken := appConfig.Auth0.ManagementToken
 	if domain == "" || apiToken == "" {
 		return errors.New("Auth0 config missing")
 	}
-	roleID := os.Getenv("AUTH0_DEFAULT_ROLE_ID") // set this in env
+	roleID := appConfig.Auth0.DefaultRoleID // set this in env
 	if roleID == "" {
 		return errors.New("default role ID not set")
 	}
-	client := &http.Client{Timeout: 10 * time.Second}
 	payload := map[string][]string{"roles": {roleID}}
 	body, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", "https://"+domain+"/api/v2/users/"+userID+"/roles", bytes.NewReader(body))
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://"+domain+"/api/v2/users/"+userID+"/roles", bytes.NewReader(body))
 	req.Header.Set("Authorization", "Bearer "+apiToken)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
+	resp, err := auth.Client.Do(req)
 	if err != nil || resp.StatusCode >= 400 {
 		return errors.New("failed to assign role")
 	}
@@ -438,23 +433,18 @@ func AssignDefaultRole(userID string) error {
 }
 
 // Helper to trigger verification email (calls Auth0 Management API)
-func SendVerificationEmail(userID string) error {
-	domain := os.Getenv("AUTH0_DOMAIN")
-	mgmtDomain := os.Getenv("AUTH0_MANAGEMENT_DOMAIN")
-	if mgmtDomain == "" {
-		mgmtDomain = domain
-	}
-	apiToken := os.Getenv("AUTH0_MANAGEMENT_TOKEN")
+func SendVerificationEmail(ctx context.Context, userID string) error {
+	mgmtDomain := appConfig.Auth0.ManagementDomain
+	apiToken := appConfig.Auth0.ManagementToken
 	if mgmtDomain == "" || apiToken == "" || userID == "" {
 		return errors.New("missing Auth0 config or userID")
 	}
-	payload := map[string]string{"user_id": userID, "client_id": os.Getenv("AUTH0_CLIENT_ID")}
+	payload := map[string]string{"user_id": userID, "client_id": appConfig.Auth0.ClientID}
 	body, _ := json.Marshal(payload)
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, _ := http.NewRequest("POST", "https://"+mgmtDomain+"/api/v2/jobs/verification-email", bytes.NewReader(body))
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://"+mgmtDomain+"/api/v2/jobs/verification-email", bytes.NewReader(body))
 	req.Header.Set("Authorization", "Bearer "+apiToken)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
+	resp, err := auth.Client.Do(req)
 	if err != nil {
 		log.Errorf("[SendVerificationEmail] Request error: %v", err)
 		return err
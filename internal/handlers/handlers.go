@@ -4,9 +4,26 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
-	"os"
+
+	"KdnSite/internal/config"
 )
 
+// appDB is the shared connection pool, set once at startup by SetDB
+var appDB *sql.DB
+
+// SetDB gives the handlers package access to the application's connection pool
+func SetDB(db *sql.DB) {
+	appDB = db
+}
+
+// appConfig is the validated server configuration, set once at startup by SetConfig
+var appConfig *config.Config
+
+// SetConfig gives the handlers package access to the application's configuration
+func SetConfig(cfg *config.Config) {
+	appConfig = cfg
+}
+
 // AuthCheckHandler returns the user's authentication status and basic info (if logged in)
 func AuthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value("user").(map[string]interface{})
@@ -26,15 +43,10 @@ func AuthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	// Fetch avatar_url from DB and inject as user.picture if present
 	userID, _ := user["sub"].(string)
 	if userID != "" {
-		dbURL := os.Getenv("POSTGRES_DATABASE_URL")
-		db, err := sql.Open("postgres", dbURL)
-		if err == nil {
-			defer db.Close()
-			var avatarURL string
-			db.QueryRow(`SELECT avatar_url FROM users WHERE id = $1`, userID).Scan(&avatarURL)
-			if avatarURL != "" {
-				user["picture"] = avatarURL
-			}
+		var avatarURL string
+		appDB.QueryRowContext(r.Context(), `SELECT avatar_url FROM users WHERE id = $1`, userID).Scan(&avatarURL)
+		if avatarURL != "" {
+			user["picture"] = avatarURL
 		}
 	}
 	resp := map[string]interface{}{
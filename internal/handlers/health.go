@@ -1,19 +1,102 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/migrate"
 )
 
+// readinessCheckTimeout bounds each dependency check so a hung dependency fails the probe instead of stalling it.
+const readinessCheckTimeout = 2 * time.Second
+
+// DependencyStatus is the result of one readiness check.
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthStatus is the body returned by /healthz and /readyz.
+type HealthStatus struct {
+	Status       string                       `json:"status"`
+	Dependencies map[string]*DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// GET /healthz - liveness: the process is up and serving requests
 func HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	log.Infof("[HandleHealthCheck] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("ok"))
+	log.Debugf("[HandleHealthCheck] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	writeHealth(w, &HealthStatus{Status: "ok"})
 }
 
+// GET /ping
 func HandlePing(w http.ResponseWriter, r *http.Request) {
-	log.Infof("[HandlePing] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	log.Debugf("[HandlePing] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("pong"))
 }
+
+// GET /readyz - readiness: Postgres answers, the Auth0 JWKS is loaded and the schema is up to date.
+// Responds 503 if any dependency is down.
+func HandleReadiness(db *sql.DB) http.HandlerFunc {
+	checks := map[string]func(ctx context.Context) error{
+		"postgres": db.PingContext,
+		"jwks":     func(context.Context) error { return auth.CheckJWKS() },
+		"migrations": func(ctx context.Context) error {
+			pending, err := migrate.Pending(ctx, db)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("%d pending, next is %s", len(pending), pending[0])
+			}
+			return nil
+		},
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := &HealthStatus{Status: "ok", Dependencies: map[string]*DependencyStatus{}}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for name, check := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+				defer cancel()
+				start := time.Now()
+				err := check(ctx)
+				dep := &DependencyStatus{Status: "ok", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+				if err != nil {
+					dep.Status = "error"
+					dep.Error = err.Error()
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				status.Dependencies[name] = dep
+				if err != nil {
+					status.Status = "unavailable"
+					log.Warnf("[HandleReadiness] %s not ready: %v", name, err)
+				}
+			}()
+		}
+		wg.Wait()
+		writeHealth(w, status)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status *HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -2,50 +2,85 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 
 	"KdnSite/internal/auth"
-
-	log "github.com/sirupsen/logrus"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/session"
 )
 
 // Auth middleware for all user related routes
 func RequireAuth(next http.Handler) http.Handler {
+	return requireAuth(next, false)
+}
+
+// RequireAuthUnverified is RequireAuth for the routes a user needs while their email
+// is still unverified, such as waiting for the verification to arrive.
+func RequireAuthUnverified(next http.Handler) http.Handler {
+	return requireAuth(next, true)
+}
+
+func requireAuth(next http.Handler, allowUnverified bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
 		tokenStr := auth.GetJWTFromRequest(r)
 		if tokenStr == "" {
-			log.Warnf("[RequireAuth] No auth_token found, remote=%s, path=%s, cookie=%v", r.RemoteAddr, r.URL.Path, r.Header.Get("Cookie"))
+			logger.Infof("[RequireAuth] No auth_token found, remote=%s", r.RemoteAddr)
 			http.Redirect(w, r, "/", http.StatusFound)
 			return
 		}
 		claims, err := auth.ValidateAndParseJWT(tokenStr)
 		if err != nil {
-			log.Warnf("[RequireAuth] Invalid JWT: %v, remote=%s, path=%s", err, r.RemoteAddr, r.URL.Path)
+			logger.Warnf("[RequireAuth] Invalid JWT: %v, remote=%s", err, r.RemoteAddr)
 			http.Redirect(w, r, "/", http.StatusFound)
 			return
 		}
 		emailVerified, ok := claims["email_verified"].(bool)
-		if !ok || !emailVerified {
-			log.Warnf("[RequireAuth] Email not verified for user: %v, remote=%s, path=%s", claims["sub"], r.RemoteAddr, r.URL.Path)
+		if (!ok || !emailVerified) && !allowUnverified {
+			logger.WithField("user_id", claims["sub"]).Info("[RequireAuth] Email not verified")
 			// Optionally: trigger verification email here if you have an API for it
 			http.Redirect(w, r, "/error/verifyemail", http.StatusFound)
 			return
 		}
+		userID, _ := claims["sub"].(string)
+		s, err := lookupSession(r, tokenStr)
+		if err != nil || !s.Valid(userID, tokenStr) {
+			logger.WithField("user_id", userID).Warnf("[RequireAuth] No active session, remote=%s, err=%v", r.RemoteAddr, err)
+			clearAuthCookies(w)
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		if err := session.TouchSession(r.Context(), appDB, s.ID); err != nil {
+			logger.Warnf("[RequireAuth] Failed to update session last seen: %v", err)
+		}
 		// Set user info in context for downstream handlers
 		type contextKey string
 		const userContextKey contextKey = "user"
 		ctx := context.WithValue(r.Context(), userContextKey, claims)
-		log.Infof("[RequireAuth] Authenticated user: %v, remote=%s, path=%s", claims["sub"], r.RemoteAddr, r.URL.Path)
+		ctx = session.WithSession(ctx, s)
+		ctx = logging.WithUser(ctx, userID)
+		logging.FromContext(ctx).Debug("[RequireAuth] Authenticated")
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// lookupSession finds the server-side session for a request: by the session cookie
+// when present, otherwise by the hash of the bearer token
+func lookupSession(r *http.Request, tokenStr string) (*session.Session, error) {
+	if c, err := r.Cookie(session.CookieName); err == nil && c.Value != "" {
+		return session.GetSession(r.Context(), appDB, c.Value)
+	}
+	return session.GetSessionByTokenHash(r.Context(), appDB, session.HashToken(tokenStr))
+}
+
 // RequireRole middleware for admin endpoints
 func RequireRole(role string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, _, roles, err := getUserClaimsFromJWT(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
 		for _, userRole := range roles {
@@ -54,7 +89,7 @@ func RequireRole(role string, next http.Handler) http.Handler {
 				return
 			}
 		}
-		w.WriteHeader(http.StatusForbidden)
+		problem.Write(w, r, problem.Forbidden(""))
 	})
 }
 
@@ -62,10 +97,12 @@ func RequireRole(role string, next http.Handler) http.Handler {
 func AuthStatusHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := auth.GetUserIDFromRequest(r)
 	if err != nil || userID == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"authenticated": false}`))
+		problem.Write(w, r, problem.Unauthorized())
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"authenticated": true, "userID": "` + userID + `"}`))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Authenticated bool   `json:"authenticated"`
+		UserID        string `json:"userID"`
+	}{true, userID})
 }
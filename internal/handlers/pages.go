@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/mastery"
+	"KdnSite/internal/planner"
+	"KdnSite/internal/problem"
 	"KdnSite/internal/user"
 	userpages "KdnSite/ui/pages/user"
 	"context"
 	"database/sql"
-	"log"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 )
 
 // getDisplayName returns the best display name for the user
@@ -31,26 +34,32 @@ func getDisplayName(ctx context.Context, db *sql.DB, claims map[string]interface
 	return "Student"
 }
 
-// DashPageHandler renders the dashboard with the user's display name
+// DashPageHandler renders the dashboard with the user's display name, progress and
+// today's revision sessions
 func DashPageHandler(w http.ResponseWriter, r *http.Request) {
-	dbURL := os.Getenv("POSTGRES_DATABASE_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		log.Printf("[DashPageHandler] DB open error: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
+	logger := logging.FromContext(r.Context())
 	tokenStr := auth.GetJWTFromRequest(r)
 	claims, err := auth.ValidateAndParseJWT(tokenStr)
 	if err != nil {
-		log.Printf("[DashPageHandler] JWT error: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		logger.Warnf("[DashPageHandler] JWT error: %v", err)
+		problem.Write(w, r, problem.Unauthorized())
 		return
 	}
-	displayName := getDisplayName(r.Context(), db, claims)
-	if err := userpages.Dash(displayName).Render(r.Context(), w); err != nil {
-		log.Printf("[DashPageHandler] Render error: %v", err)
+	displayName := getDisplayName(r.Context(), appDB, claims)
+	var (
+		progress *mastery.Progress
+		today    []*planner.Session
+	)
+	if userID, _ := claims["sub"].(string); userID != "" {
+		now := time.Now()
+		if progress, err = mastery.Compute(r.Context(), appDB, userID, now); err != nil {
+			logger.Errorf("[DashPageHandler] Progress error: %v", err)
+		}
+		if today, err = planner.Today(r.Context(), appDB, userID, now); err != nil {
+			logger.Errorf("[DashPageHandler] Planner error: %v", err)
+		}
+	}
+	if err := userpages.Dash(displayName, progress, today).Render(r.Context(), w); err != nil {
+		logger.Errorf("[DashPageHandler] Render error: %v", err)
 	}
 }
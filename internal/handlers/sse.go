@@ -1,68 +1,226 @@
 package handlers
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/r3labs/sse/v2"
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/metrics"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/session"
 )
 
 var sseServer = sse.New()
 
 func init() {
 	sseServer.AutoReplay = false
+	// Streams are created for the first subscriber and removed after the last one leaves
+	sseServer.AutoStream = true
 }
 
+const (
+	// verificationPollInterval is how often the watcher wakes up; at most one
+	// Management API lookup is made per wake-up, shared across all connections.
+	verificationPollInterval = 2 * time.Second
+	// verificationRecheckInterval is the minimum time between lookups for the same user.
+	verificationRecheckInterval = 15 * time.Second
+)
+
 // SSE endpoint for email verification status
 type EmailStatus struct {
 	Verified bool `json:"verified"`
 }
 
+var emailWatcher = &verificationWatcher{users: map[string]*watchedUser{}}
+
+// emailVerifiedStream returns the SSE stream ID carrying a user's verification events.
+func emailVerifiedStream(userID string) string {
+	return "email-verified:" + userID
+}
+
+// GET /api/sse/email-verified - streams {"verified": true} once the user's email is verified.
+// It is served behind RequireAuthUnverified, so a revoked session cannot keep it open.
 func EmailVerificationSSE(w http.ResponseWriter, r *http.Request) {
-	userID, err := getUserIDFromJWT(r)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+	s, ok := session.FromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized())
 		return
 	}
-	ch := make(chan bool, 1)
-	// Simulate polling for demo; in production, trigger on actual verification event
-	go func() {
-		for {
-			verified := checkEmailVerified(userID)
-			if verified {
-				ch <- true
-				return
-			}
-			time.Sleep(3 * time.Second)
-		}
-	}()
-	sseServer.CreateStream(userID)
-	defer sseServer.RemoveStream(userID)
-	flusher, ok := w.(http.Flusher)
+	userID := s.UserID
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	emailWatcher.subscribe(userID)
+	defer emailWatcher.unsubscribe(userID)
+	metrics.SSEConnections.Inc()
+	defer metrics.SSEConnections.Dec()
+
+	// The shared server picks the stream from the query string and returns once the client disconnects
+	q := r.URL.Query()
+	q.Set("stream", emailVerifiedStream(userID))
+	r.URL.RawQuery = q.Encode()
+	sseServer.ServeHTTP(w, r)
+}
+
+// CloseStreams ends every open SSE connection. It is called when the server shuts down.
+func CloseStreams() {
+	sseServer.Close()
+}
+
+// POST /api/auth/webhook/email-verified - receives post-verification events from an Auth0 Action.
+// The Action must send "Authorization: Bearer $AUTH0_WEBHOOK_SECRET" and a body of {"user_id": "..."}.
+func EmailVerifiedWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Write(w, r, problem.MethodNotAllowed())
+		return
+	}
+	secret := appConfig.Auth0.WebhookSecret
+	if secret == "" {
+		log.Warn("[EmailVerifiedWebhookHandler] AUTH0_WEBHOOK_SECRET not set, rejecting webhook")
+		problem.Write(w, r, problem.NotFound(""))
+		return
+	}
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+		problem.Write(w, r, problem.Unauthorized())
+		return
+	}
+	var req struct {
+		UserID        string `json:"user_id"`
+		EmailVerified *bool  `json:"email_verified"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		problem.Write(w, r, problem.BadRequest("Missing user_id"))
+		return
+	}
+	if req.EmailVerified != nil && !*req.EmailVerified {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	log.Infof("[EmailVerifiedWebhookHandler] Email verified for user: %s", req.UserID)
+	emailWatcher.markVerified(req.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishEmailVerified pushes a verified event to every connection the user has open.
+func publishEmailVerified(userID string) {
+	data, _ := json.Marshal(EmailStatus{Verified: true})
+	sseServer.Publish(emailVerifiedStream(userID), &sse.Event{Data: data})
+}
+
+type watchedUser struct {
+	subscribers int
+	lastChecked time.Time
+	verified    bool
+}
+
+// verificationWatcher checks the verification status of every user with an open
+// SSE connection. A single goroutine runs while there is at least one subscriber.
+type verificationWatcher struct {
+	mu      sync.Mutex
+	users   map[string]*watchedUser
+	running bool
+}
+
+func (v *verificationWatcher) subscribe(userID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	u, ok := v.users[userID]
+	if !ok {
+		u = &watchedUser{}
+		v.users[userID] = u
+	}
+	u.subscribers++
+	if !v.running {
+		v.running = true
+		go v.run()
+	}
+}
+
+func (v *verificationWatcher) unsubscribe(userID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	u, ok := v.users[userID]
 	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.WriteHeader(http.StatusOK)
-	enc := json.NewEncoder(w)
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case <-ch:
-			enc.Encode(EmailStatus{Verified: true})
-			flusher.Flush()
+	u.subscribers--
+	if u.subscribers <= 0 {
+		delete(v.users, userID)
+	}
+}
+
+// markVerified records a verification reported by the webhook and pushes it immediately.
+// Watched users keep receiving the event on each tick in case a connection had not
+// finished subscribing when it was first published.
+func (v *verificationWatcher) markVerified(userID string) {
+	v.mu.Lock()
+	if u, ok := v.users[userID]; ok {
+		u.verified = true
+	}
+	v.mu.Unlock()
+	publishEmailVerified(userID)
+}
+
+func (v *verificationWatcher) run() {
+	ticker := time.NewTicker(verificationPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		verified, due, ok := v.next()
+		if !ok {
 			return
 		}
+		for _, userID := range verified {
+			publishEmailVerified(userID)
+		}
+		if due == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		isVerified, err := auth.FetchEmailVerified(ctx, due)
+		cancel()
+		if err != nil {
+			log.Warnf("[verificationWatcher] Lookup failed for user %s: %v", due, err)
+			continue
+		}
+		if isVerified {
+			v.markVerified(due)
+		}
 	}
 }
 
-// Dummy function, replace with real DB/Auth0 check
-func checkEmailVerified(userID string) bool {
-	// TODO: Implement real check
-	return false
+// next returns the verified users to notify and the user most overdue for a lookup.
+// ok is false once nobody is subscribed, which stops the watcher.
+func (v *verificationWatcher) next() (verified []string, due string, ok bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.users) == 0 {
+		v.running = false
+		return nil, "", false
+	}
+	now := time.Now()
+	var oldest time.Time
+	for userID, u := range v.users {
+		if u.verified {
+			verified = append(verified, userID)
+			continue
+		}
+		if now.Sub(u.lastChecked) < verificationRecheckInterval {
+			continue
+		}
+		if due == "" || u.lastChecked.Before(oldest) {
+			due, oldest = userID, u.lastChecked
+		}
+	}
+	if due != "" {
+		v.users[due].lastChecked = now
+	}
+	return verified, due, true
 }
@@ -1 +1,18 @@
 package leaderboard
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Record sets the user's score, the minutes they have studied, and their streak. Ranks
+// are worked out when the leaderboard is read. studiedOn is the last day, "YYYY-MM-DD"
+// in timezone, that counted towards the streak, or empty if none has.
+func Record(ctx context.Context, db *sql.DB, userID string, score, streak int, studiedOn, timezone string) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO leaderboard (user_id, username, score, streak, studied_on, timezone)
+SELECT id, username, $2::int, $3::int, $4::date, $5::text FROM users WHERE id=$1
+ON CONFLICT (user_id) DO UPDATE SET username=EXCLUDED.username, score=EXCLUDED.score, streak=EXCLUDED.streak,
+	studied_on=EXCLUDED.studied_on, timezone=EXCLUDED.timezone`,
+		userID, score, streak, sql.NullString{String: studiedOn, Valid: studiedOn != ""}, timezone)
+	return err
+}
@@ -4,14 +4,20 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+
+	"KdnSite/internal/problem"
 )
 
 // ListLeaderboard handles GET /api/leaderboard
 func ListLeaderboard(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := db.QueryContext(r.Context(), `SELECT user_id, username, score, streak, rank FROM leaderboard ORDER BY score DESC, streak DESC LIMIT 50`)
+		// A streak lapses once a whole day passes, in the user's timezone, without study
+		rows, err := db.QueryContext(r.Context(), `SELECT user_id, username, score,
+	CASE WHEN studied_on IS NULL OR studied_on >= (now() AT TIME ZONE timezone)::date - 1 THEN streak ELSE 0 END AS streak,
+	RANK() OVER (ORDER BY score DESC) AS rank
+FROM leaderboard ORDER BY score DESC, streak DESC LIMIT 50`)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Write(w, r, problem.Internal())
 			return
 		}
 		defer rows.Close()
@@ -19,7 +25,7 @@ func ListLeaderboard(db *sql.DB) http.HandlerFunc {
 		for rows.Next() {
 			var e LeaderboardEntry
 			if err := rows.Scan(&e.UserID, &e.Username, &e.Score, &e.Streak, &e.Rank); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				problem.Write(w, r, problem.Internal())
 				return
 			}
 			entries = append(entries, &e)
@@ -0,0 +1,134 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"KdnSite/internal/markdown"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+)
+
+// selectItem reads resources as library items for the viewer, who is $1. The table is
+// not aliased so tags.Resources.Filter works.
+const selectItem = `SELECT id, owner_id, COALESCE((SELECT username FROM users WHERE users.id = resources.owner_id), ''),
+	type, title, content, visibility, COALESCE(class_id, ''),
+	COALESCE((SELECT name FROM classes WHERE classes.id = resources.class_id), ''),
+	exam_board, spec_codes, status, moderation_note, COALESCE(published_at, 0), updated_at,
+	EXISTS (SELECT 1 FROM revision_resources rr WHERE rr.owner_id = $1 AND rr.source_id = resources.id)
+FROM resources`
+
+const (
+	// visible matches the items the viewer can see: their own published items, and
+	// approved items that are public or published to one of their classes.
+	visible = ` WHERE visibility <> 'private' AND (owner_id = $1 OR (status = 'approved' AND (visibility = 'public'
+	OR EXISTS (SELECT 1 FROM class_members m WHERE m.class_id = resources.class_id AND m.user_id = $1))))`
+	// visibleToAdmin matches every published item, whatever its status.
+	visibleToAdmin = ` WHERE visibility <> 'private'`
+)
+
+// where returns the condition matching what the viewer can see.
+func where(admin bool) string {
+	if admin {
+		return visibleToAdmin
+	}
+	return visible
+}
+
+// scanItem reads a row selected by selectItem, hiding the moderation note from
+// everyone but the author and admins.
+func scanItem(row interface{ Scan(...any) error }, viewerID string, admin bool) (*Item, error) {
+	var (
+		it    Item
+		codes pq.StringArray
+	)
+	err := row.Scan(&it.ID, &it.AuthorID, &it.Author, &it.Type, &it.Title, &it.Content, &it.Visibility, &it.ClassID,
+		&it.ClassName, &it.ExamBoard, &codes, &it.Status, &it.ModerationNote, &it.PublishedAt, &it.UpdatedAt, &it.Copied)
+	if err != nil {
+		return nil, err
+	}
+	it.SpecCodes = codes
+	if it.SpecCodes == nil {
+		it.SpecCodes = []string{}
+	}
+	if it.AuthorID != viewerID && !admin {
+		it.ModerationNote = ""
+	}
+	it.ContentHTML = markdown.Render(it.Content)
+	return &it, nil
+}
+
+// loadLinks fills in the author's tags and the spec points of each item.
+func loadLinks(ctx context.Context, db *sql.DB, list []*Item) error {
+	ids := make([]string, len(list))
+	for i, it := range list {
+		ids[i] = it.ID
+	}
+	byID, err := tags.Load(ctx, db, tags.Resources, ids)
+	if err != nil {
+		return err
+	}
+	points, err := specs.Load(ctx, db, specs.Resources, ids)
+	if err != nil {
+		return err
+	}
+	for _, it := range list {
+		it.Tags = byID[it.ID]
+		if it.Tags == nil {
+			it.Tags = []string{}
+		}
+		it.SpecPoints = points[it.ID]
+		if it.SpecPoints == nil {
+			it.SpecPoints = []string{}
+		}
+	}
+	return nil
+}
+
+// get returns the item with id if the viewer can see it, or sql.ErrNoRows.
+func get(ctx context.Context, db *sql.DB, viewerID, id string, admin bool) (*Item, error) {
+	it, err := scanItem(db.QueryRowContext(ctx, selectItem+where(admin)+` AND id = $2`, viewerID, id), viewerID, admin)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadLinks(ctx, db, []*Item{it}); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// publish sets where one of the owner's resources is published, with the given status.
+// reviewerID is the admin who approved it, if it was published by one. Publishing as
+// private clears the class and publication time. It returns sql.ErrNoRows if the owner
+// has no such resource.
+func publish(ctx context.Context, db *sql.DB, ownerID, id string, req *PublishRequest, status, reviewerID string, now int64) error {
+	res, err := db.ExecContext(ctx, `UPDATE resources SET visibility=$1, class_id=NULLIF($2, ''), exam_board=$3, spec_codes=$4,
+	status=$5, moderation_note='', reviewed_by=NULLIF($6, ''),
+	reviewed_at = CASE WHEN $6 = '' THEN NULL ELSE $7::BIGINT END,
+	published_at = CASE WHEN $1 = 'private' THEN NULL ELSE COALESCE(published_at, $7::BIGINT) END
+WHERE id=$8 AND owner_id=$9`,
+		req.Visibility, req.ClassID, req.ExamBoard, pq.Array(req.SpecCodes), status, reviewerID, now, id, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// moderate records an admin's decision on a published item. It returns sql.ErrNoRows
+// if there is no such item.
+func moderate(ctx context.Context, db *sql.DB, adminID, id, status, note string, now int64) error {
+	res, err := db.ExecContext(ctx, `UPDATE resources SET status=$1, moderation_note=$2, reviewed_by=$3, reviewed_at=$4
+WHERE id=$5 AND visibility <> 'private'`, status, note, adminID, now, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
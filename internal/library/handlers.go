@@ -0,0 +1,308 @@
+package library
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/classes"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/markdown"
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/revision"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+	"KdnSite/internal/validate"
+)
+
+// listSpec is what GET /api/library can sort and filter by.
+var listSpec = pagination.Spec{
+	IDColumn: "id",
+	Sorts: map[string]pagination.SortField{
+		"published_at": {Column: "COALESCE(published_at, 0)", Numeric: true},
+		"updated_at":   {Column: "updated_at", Numeric: true},
+		"title":        {Column: "title"},
+	},
+	DefaultSort: "-published_at",
+	Filters: map[string]string{
+		"type":       "type",
+		"exam_board": "exam_board",
+		"visibility": "visibility",
+		"status":     "status",
+		"class":      "class_id",
+	},
+	Conditions: map[string]string{
+		"tag":        tags.Resources.Filter(),
+		"spec":       "%s = ANY(spec_codes)",
+		"spec_point": specs.Resources.Filter(),
+	},
+	DateColumn: "published_at",
+}
+
+// ListLibrary handles GET /api/library. Admins see every published item, so they can
+// filter by status=pending to work through the moderation queue.
+func ListLibrary(db *sql.DB, roles auth.Roles) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		q, err := pagination.Parse(r, listSpec)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		admin := roles.IsAdmin(r)
+		query, args := q.SQL(selectItem+where(admin), userID)
+		rows, err := db.QueryContext(r.Context(), query, args...)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ListLibrary] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		defer rows.Close()
+		var items []*Item
+		for rows.Next() {
+			it, err := scanItem(rows, userID, admin)
+			if err != nil {
+				problem.Write(w, r, problem.Internal())
+				return
+			}
+			items = append(items, it)
+		}
+		if err := loadLinks(r.Context(), db, items); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		pagination.Write(w, pagination.NewPage(q, items, (*Item).cursor))
+	}
+}
+
+// GetLibraryItem handles GET /api/library/{id}
+func GetLibraryItem(db *sql.DB, roles auth.Roles) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		it, err := get(r.Context(), db, userID, r.PathValue("id"), roles.IsAdmin(r))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Library item not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, it)
+	}
+}
+
+// PublishResource handles POST /api/library/{id}/publish, where id is one of the
+// teacher's resources. Class items can only go to a class the teacher teaches. Public
+// items from teachers wait for moderation; an admin's are approved at once.
+func PublishResource(db *sql.DB, roles auth.Roles) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		if !roles.IsTeacher(r) {
+			problem.Write(w, r, problem.Forbidden("Only teachers can publish to the library."))
+			return
+		}
+		var req PublishRequest
+		if err := validate.DecodeJSON(w, r, 16<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if req.Visibility == Class {
+			teaches, err := classes.Teaches(r.Context(), db, userID, req.ClassID)
+			if err != nil {
+				problem.Error(w, r, err)
+				return
+			}
+			if !teaches {
+				problem.Write(w, r, problem.Validation(problem.FieldError{Field: "class_id", Code: "not_found", Message: "is not a class you teach"}))
+				return
+			}
+		}
+		status, reviewer := Approved, ""
+		if req.Visibility == Public {
+			if roles.IsAdmin(r) {
+				reviewer = userID
+			} else {
+				status = Pending
+			}
+		}
+		id := r.PathValue("id")
+		err = publish(r.Context(), db, userID, id, &req, status, reviewer, time.Now().Unix())
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Resource not found"))
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[PublishResource] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if req.Visibility == Private {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		it, err := get(r.Context(), db, userID, id, false)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, it)
+	}
+}
+
+// ModerateItem handles POST /api/library/{id}/moderation, for admins only.
+func ModerateItem(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req ModerateRequest
+		if err := validate.DecodeJSON(w, r, 8<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		status := Approved
+		if req.Decision == "reject" {
+			status = Rejected
+		}
+		id := r.PathValue("id")
+		err = moderate(r.Context(), db, userID, id, status, req.Note, time.Now().Unix())
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Library item not found"))
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ModerateItem] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		it, err := get(r.Context(), db, userID, id, true)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, it)
+	}
+}
+
+// CopyLibraryItem handles POST /api/library/{id}/copy. The item becomes a note (or a
+// summary) in the user's revision, headed by its title, tagged with its tags and exam
+// board, and linked to its spec points. Each item can be copied once.
+func CopyLibraryItem(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		it, err := get(r.Context(), db, userID, r.PathValue("id"), false)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Library item not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if it.Copied {
+			problem.Write(w, r, problem.Conflict("This item is already in your revision."))
+			return
+		}
+		t := time.Now().Unix()
+		res := revision.RevisionResource{
+			ID:         uuid.NewString(),
+			OwnerID:    userID,
+			Type:       revisionType(it.Type),
+			Tags:       copyTags(it),
+			SpecPoints: it.SpecPoints,
+			Content:    "# " + it.Title + "\n\n" + it.Content,
+			SourceID:   it.ID,
+			CreatedAt:  t,
+			UpdatedAt:  t,
+		}
+		err = revision.Create(r.Context(), db, &res)
+		if pqErr := (*pq.Error)(nil); errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			problem.Write(w, r, problem.Conflict("This item is already in your revision."))
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[CopyLibraryItem] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		res.ContentHTML = markdown.Render(res.Content)
+		writeJSON(w, http.StatusCreated, &res)
+	}
+}
+
+// revisionType maps a resource type onto the revision types. Library flashcards are
+// plain text, so they are copied as notes rather than structured cards.
+func revisionType(typ string) string {
+	if typ == "summary" {
+		return "summary"
+	}
+	return "note"
+}
+
+// copyTags returns the tags a copy of it starts with.
+func copyTags(it *Item) []string {
+	names := it.Tags
+	if it.ExamBoard != "" {
+		names = append([]string{it.ExamBoard}, names...)
+	}
+	names, _ = tags.Normalize("tags", names)
+	if len(names) > tags.MaxPerItem {
+		names = names[:tags.MaxPerItem]
+	}
+	if names == nil {
+		names = []string{}
+	}
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
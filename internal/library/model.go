@@ -0,0 +1,124 @@
+// Package library is the curated collection of resources that teachers and admins
+// publish for students to browse and copy into their revision. A published resource
+// is seen by the members of one class or by everyone; a teacher's public resources
+// wait for an admin to approve them, and go back to the queue when edited.
+package library
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"KdnSite/internal/problem"
+)
+
+// Visibility levels.
+const (
+	Private = "private" // only the owner, through /api/resources
+	Class   = "class"   // members of the class it is published to
+	Public  = "public"  // every signed in user
+)
+
+// Moderation statuses.
+const (
+	Pending  = "pending"
+	Approved = "approved"
+	Rejected = "rejected"
+)
+
+// MaxSpecCodes bounds how many specification points one item may be tagged with.
+const MaxSpecCodes = 20
+
+// Item is a published resource as seen in the library.
+type Item struct {
+	ID          string   `json:"id"`
+	AuthorID    string   `json:"author_id"`
+	Author      string   `json:"author"`
+	Type        string   `json:"type"`
+	Title       string   `json:"title"`
+	Content     string   `json:"content"`
+	ContentHTML string   `json:"content_html"`
+	Tags        []string `json:"tags"`
+	Visibility  string   `json:"visibility"`
+	ClassID     string   `json:"class_id,omitempty"`
+	ClassName   string   `json:"class_name,omitempty"`
+	ExamBoard   string   `json:"exam_board,omitempty"`
+	SpecCodes   []string `json:"spec_codes"`
+	SpecPoints  []string `json:"spec_points"`
+	Status      string   `json:"status"`
+	// ModerationNote is the admin's reason for a decision. Only the author and admins
+	// see it.
+	ModerationNote string `json:"moderation_note,omitempty"`
+	PublishedAt    int64  `json:"published_at,omitempty"`
+	UpdatedAt      int64  `json:"updated_at"`
+	// Copied reports whether the viewer already has the item in their revision.
+	Copied bool `json:"copied"`
+}
+
+// cursor returns the item's value for a list sort key, and its ID.
+func (it *Item) cursor(sortKey string) (string, string) {
+	switch sortKey {
+	case "title":
+		return it.Title, it.ID
+	case "updated_at":
+		return strconv.FormatInt(it.UpdatedAt, 10), it.ID
+	default:
+		return strconv.FormatInt(it.PublishedAt, 10), it.ID
+	}
+}
+
+// PublishRequest is the body of POST /api/library/{id}/publish. Publishing as private
+// takes the resource out of the library.
+type PublishRequest struct {
+	Visibility string   `json:"visibility" validate:"required,oneof=private class public"`
+	ClassID    string   `json:"class_id" validate:"max=64"`
+	ExamBoard  string   `json:"exam_board" validate:"max=50"`
+	SpecCodes  []string `json:"spec_codes"`
+}
+
+// Validate checks that a class is named only for class visibility, and trims and
+// de-duplicates the specification codes.
+func (req *PublishRequest) Validate() []problem.FieldError {
+	var errs []problem.FieldError
+	switch {
+	case req.Visibility == Class && req.ClassID == "":
+		errs = append(errs, problem.FieldError{Field: "class_id", Code: "required", Message: "is required for class visibility"})
+	case req.Visibility != Class && req.ClassID != "":
+		errs = append(errs, problem.FieldError{Field: "class_id", Code: "not_allowed", Message: "is only used by class visibility"})
+	}
+	req.ExamBoard = strings.Join(strings.Fields(req.ExamBoard), " ")
+	codes := []string{}
+	seen := map[string]bool{}
+	for i, code := range req.SpecCodes {
+		code = strings.TrimSpace(code)
+		switch {
+		case code == "":
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("spec_codes[%d]", i), Code: "required", Message: "must not be blank"})
+		case len(code) > 30:
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("spec_codes[%d]", i), Code: "too_long", Message: "must be at most 30 characters"})
+		case !seen[code]:
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) > MaxSpecCodes {
+		errs = append(errs, problem.FieldError{Field: "spec_codes", Code: "too_long", Message: fmt.Sprintf("must be at most %d items", MaxSpecCodes)})
+	}
+	req.SpecCodes = codes
+	return errs
+}
+
+// ModerateRequest is the body of POST /api/library/{id}/moderation.
+type ModerateRequest struct {
+	Decision string `json:"decision" validate:"required,oneof=approve reject"`
+	Note     string `json:"note" validate:"max=1000"`
+}
+
+// Validate requires a note explaining a rejection to the author.
+func (req *ModerateRequest) Validate() []problem.FieldError {
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Decision == "reject" && req.Note == "" {
+		return []problem.FieldError{{Field: "note", Code: "required", Message: "is required when rejecting"}}
+	}
+	return nil
+}
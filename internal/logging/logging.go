@@ -0,0 +1,119 @@
+// Package logging configures logrus for the server, tags each request with an ID and
+// scrubs credentials and email addresses from every log line.
+package logging
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+
+	"KdnSite/internal/config"
+)
+
+// RequestIDHeader carries the request ID in from a proxy and back out to the client.
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey struct{}
+
+// Setup applies the configured level and format and installs the redaction hook.
+func Setup(cfg config.Log) {
+	if cfg.Format == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	}
+	log.SetLevel(cfg.Level)
+	log.AddHook(redactHook{})
+}
+
+// Middleware gives every request an ID, taken from X-Request-ID when a proxy set a
+// sensible one, echoes it in the response and attaches a logger carrying it to the context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		entry := log.WithFields(log.Fields{"request_id": id, "method": r.Method, "path": r.URL.Path})
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			entry = entry.WithField("trace_id", sc.TraceID().String())
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, entry)))
+	})
+}
+
+// FromContext returns the request's logger, or the standard logger outside a request.
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithUser returns ctx with the user ID added to its logger.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, FromContext(ctx).WithField("user_id", userID))
+}
+
+// RequestID returns the ID assigned by Middleware, or "".
+func RequestID(ctx context.Context) string {
+	if entry, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		id, _ := entry.Data["request_id"].(string)
+		return id
+	}
+	return ""
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+var redactions = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	// JWTs: three base64url segments, the first always starting "eyJ"
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), "[REDACTED_JWT]"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[^\s,;"]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`((?:auth_token|session_id|csrf_token)=)[^\s;,"]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[REDACTED_EMAIL]"},
+}
+
+// Redact removes tokens, cookie values and email addresses from s.
+func Redact(s string) string {
+	for _, r := range redactions {
+		s = r.re.ReplaceAllString(s, r.with)
+	}
+	return s
+}
+
+// redactHook scrubs the message and string fields of every entry before it is written.
+type redactHook struct{}
+
+func (redactHook) Levels() []log.Level { return log.AllLevels }
+
+func (redactHook) Fire(e *log.Entry) error {
+	e.Message = Redact(e.Message)
+	for k, v := range e.Data {
+		switch v := v.(type) {
+		case string:
+			e.Data[k] = Redact(v)
+		case error:
+			e.Data[k] = Redact(v.Error())
+		}
+	}
+	return nil
+}
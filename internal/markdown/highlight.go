@@ -0,0 +1,76 @@
+package markdown
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// highlightStyle colours code blocks. Tokens are marked with classes, so the colours
+// live in the stylesheet served by StyleHandler rather than in each rendered note.
+const highlightStyle = "github-dark"
+
+var formatter = chromahtml.New(chromahtml.WithClasses(true))
+
+// codeRenderer highlights fenced code blocks, falling back to plain text for
+// unknown languages.
+type codeRenderer struct{}
+
+func (codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, renderFencedCode)
+}
+
+func renderFencedCode(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	block := n.(*ast.FencedCodeBlock)
+	var code bytes.Buffer
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		code.Write(seg.Value(source))
+	}
+
+	lexer := lexers.Fallback
+	if lang := block.Language(source); lang != nil {
+		if l := lexers.Get(string(lang)); l != nil {
+			lexer = l
+		}
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err == nil {
+		err = formatter.Format(w, styles.Get(highlightStyle), iterator)
+	}
+	if err != nil {
+		w.WriteString("<pre><code>")
+		w.Write(util.EscapeHTML(code.Bytes()))
+		w.WriteString("</code></pre>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+var (
+	styleOnce sync.Once
+	styleCSS  []byte
+)
+
+// StyleHandler serves the stylesheet for highlighted code blocks.
+func StyleHandler(w http.ResponseWriter, r *http.Request) {
+	styleOnce.Do(func() {
+		var buf bytes.Buffer
+		formatter.WriteCSS(&buf, styles.Get(highlightStyle))
+		styleCSS = buf.Bytes()
+	})
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(styleCSS)
+}
@@ -0,0 +1,109 @@
+// Package markdown renders user-written notes to safe HTML: CommonMark with GitHub
+// extensions, maths and chemistry delimited for KaTeX, and highlighted code. Raw HTML
+// in the source is dropped and the output is sanitised again before it is returned,
+// so it can be inserted into a page as-is.
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	log "github.com/sirupsen/logrus"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, mathExtension{}),
+	goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(codeRenderer{}, 200))),
+)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// Highlighted code and maths are styled by class
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w\- ]+$`)).OnElements("span", "div", "pre", "code")
+	// GFM task lists
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// cacheSize is how many rendered versions are kept. Notes are keyed by a hash of
+// their content, so an edited note is simply a new entry.
+const cacheSize = 2048
+
+var cache = newLRU(cacheSize)
+
+// Render returns the sanitised HTML for src, from the cache when this exact content
+// has been rendered before.
+func Render(src string) string {
+	key := sha256.Sum256([]byte(src))
+	if html, ok := cache.get(key); ok {
+		return html
+	}
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		log.Errorf("[markdown.Render] %v", err)
+		return policy.Sanitize("<p>" + bluemonday.StrictPolicy().Sanitize(src) + "</p>")
+	}
+	html := policy.SanitizeReader(&buf).String()
+	cache.add(key, html)
+	return html
+}
+
+// Sanitize cleans HTML written elsewhere, such as imported Anki cards, with the same
+// policy as rendered Markdown.
+func Sanitize(html string) string {
+	return policy.Sanitize(html)
+}
+
+// lru is a fixed-size least-recently-used cache of rendered HTML.
+type lru struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[[32]byte]*list.Element
+}
+
+type lruEntry struct {
+	key  [32]byte
+	html string
+}
+
+func newLRU(max int) *lru {
+	return &lru{max: max, order: list.New(), entries: map[[32]byte]*list.Element{}}
+}
+
+func (c *lru) get(key [32]byte) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).html, true
+}
+
+func (c *lru) add(key [32]byte, html string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, html: html})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
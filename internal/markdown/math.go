@@ -0,0 +1,211 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Maths is delimited here and typeset in the browser by KaTeX with its mhchem
+// extension. The TeX is written out HTML-escaped inside an element with class "math",
+// so it is inert until KaTeX renders it (with trust disabled).
+//
+//	$x^2$            inline maths ($ must hug the formula, so "$5 and $10" stays text)
+//	$$\frac{a}{b}$$  display maths, inline or as a block spanning several lines
+//	\ce{H2O}         chemistry, shorthand for $\ce{H2O}$
+
+var (
+	kindMathInline = ast.NewNodeKind("MathInline")
+	kindMathBlock  = ast.NewNodeKind("MathBlock")
+)
+
+type mathInline struct {
+	ast.BaseInline
+	tex     []byte
+	display bool
+}
+
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": string(n.tex)}, nil)
+}
+
+type mathBlock struct {
+	ast.BaseBlock
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+func (n *mathBlock) IsRaw() bool        { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathExtension adds the maths and chemistry syntax to goldmark.
+type mathExtension struct{}
+
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			util.Prioritized(dollarParser{}, 150),
+			util.Prioritized(chemParser{}, 150),
+		),
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 650)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 200)))
+}
+
+// dollarParser reads $...$ and $$...$$ within a line.
+type dollarParser struct{}
+
+func (dollarParser) Trigger() []byte { return []byte{'$'} }
+
+func (dollarParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if bytes.HasPrefix(line, []byte("$$")) {
+		end := bytes.Index(line[2:], []byte("$$"))
+		if end <= 0 {
+			return nil
+		}
+		block.Advance(end + 4)
+		return &mathInline{tex: bytes.TrimSpace(line[2 : end+2]), display: true}
+	}
+	if len(line) < 3 || isSpace(line[1]) {
+		return nil
+	}
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++ // skip the escaped character, including \$
+		case '\n':
+			return nil
+		case '$':
+			if isSpace(line[i-1]) || (i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9') {
+				return nil
+			}
+			block.Advance(i + 1)
+			return &mathInline{tex: line[1:i]}
+		}
+	}
+	return nil
+}
+
+// chemParser reads \ce{...} with balanced braces.
+type chemParser struct{}
+
+func (chemParser) Trigger() []byte { return []byte{'\\'} }
+
+func (chemParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte(`\ce{`)) {
+		return nil
+	}
+	depth := 0
+	for i := 3; i < len(line); i++ {
+		switch line[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				block.Advance(i + 1)
+				return &mathInline{tex: line[:i+1]}
+			}
+		case '\n':
+			return nil
+		}
+	}
+	return nil
+}
+
+// mathBlockParser reads display maths between lines starting and ending with $$.
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	rest := bytes.TrimSpace(trimmed[2:])
+	if len(rest) > 0 && !bytes.HasSuffix(rest, []byte("$$")) {
+		return nil, parser.NoChildren // $$ followed by text is left to the inline parser
+	}
+	node := &mathBlock{}
+	start := segment.Start + bytes.Index(line, []byte("$$")) + 2
+	if bytes.HasSuffix(rest, []byte("$$")) {
+		end := segment.Start + bytes.LastIndex(line, []byte("$$"))
+		node.Lines().Append(text.NewSegment(start, end))
+		reader.AdvanceToEOL()
+		return node, parser.Close
+	}
+	reader.AdvanceToEOL()
+	return node, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+	if i := bytes.Index(line, []byte("$$")); i >= 0 && len(bytes.TrimSpace(line[i+2:])) == 0 {
+		node.Lines().Append(text.NewSegment(segment.Start, segment.Start+i))
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.AdvanceToEOL()
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+func (mathBlockParser) CanInterruptParagraph() bool                                { return true }
+func (mathBlockParser) CanAcceptIndentedLine() bool                                { return false }
+
+type mathRenderer struct{}
+
+func (mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMathInline, renderMathInline)
+	reg.Register(kindMathBlock, renderMathBlock)
+}
+
+func renderMathInline(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	m := n.(*mathInline)
+	if m.display {
+		w.WriteString(`<span class="math math-display">`)
+	} else {
+		w.WriteString(`<span class="math">`)
+	}
+	w.Write(util.EscapeHTML(m.tex))
+	w.WriteString("</span>")
+	return ast.WalkSkipChildren, nil
+}
+
+func renderMathBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	w.WriteString(`<div class="math math-display">`)
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		w.Write(util.EscapeHTML(seg.Value(source)))
+	}
+	w.WriteString("</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
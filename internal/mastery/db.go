@@ -0,0 +1,157 @@
+package mastery
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+)
+
+// answer is one quiz question the student answered.
+type answer struct {
+	questionID, quizID, quizTitle, topic string
+	correct                              bool
+	answeredAt                           int64
+}
+
+// review is one flashcard the student has reviewed, with its schedule. Native cards
+// have the note they were generated from; Anki cards have their deck's name.
+type review struct {
+	cardID, noteID, deck string
+	intervalDays         float64
+	dueAt, reviewedAt    int64
+}
+
+// point is a spec point's reference and title.
+type point struct{ ref, title string }
+
+// loadAnswers returns the quiz questions userID answered since since. Each is filed
+// under its quiz's topic, or its own if the quiz has none.
+func loadAnswers(ctx context.Context, db *sql.DB, userID string, since int64) ([]answer, error) {
+	rows, err := db.QueryContext(ctx, `SELECT qa.question_id, qa.quiz_id, qz.title, COALESCE(NULLIF(qz.topic, ''), q.topic, ''), qa.correct, qa.answered_at
+FROM question_attempts qa
+JOIN questions q ON q.id = qa.question_id
+JOIN quizzes qz ON qz.id = qa.quiz_id
+WHERE qa.user_id=$1 AND qa.answered_at >= $2`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []answer
+	for rows.Next() {
+		var a answer
+		if err := rows.Scan(&a.questionID, &a.quizID, &a.quizTitle, &a.topic, &a.correct, &a.answeredAt); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// loadReviews returns every card userID has reviewed that still exists.
+func loadReviews(ctx context.Context, db *sql.DB, userID string) ([]review, error) {
+	rows, err := db.QueryContext(ctx, `SELECT c.id, c.note_id, c.deck, s.interval_days, s.due_at, s.reviewed_at
+FROM (
+	SELECT id, note_id, ''::text AS deck, owner_id FROM flashcards
+	UNION ALL
+	SELECT a.id, '', COALESCE(d.name, ''), a.owner_id FROM anki_cards a LEFT JOIN anki_decks d ON d.id = a.deck_id
+) c JOIN card_schedules s ON s.owner_id = c.owner_id AND s.card_id = c.id
+WHERE c.owner_id=$1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []review
+	for rows.Next() {
+		var r review
+		if err := rows.Scan(&r.cardID, &r.noteID, &r.deck, &r.intervalDays, &r.dueAt, &r.reviewedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// links is what each answered question and reviewed card is about: the spec points
+// linked to it, or failing that to its quiz or note, and the tags of its note.
+type links struct {
+	questions, quizzes, notes, noteTags map[string][]string
+	points                              map[string]point
+}
+
+func loadLinks(ctx context.Context, db *sql.DB, answers []answer, reviews []review) (*links, error) {
+	var questionIDs, quizIDs, noteIDs []string
+	for _, a := range answers {
+		questionIDs = append(questionIDs, a.questionID)
+		quizIDs = append(quizIDs, a.quizID)
+	}
+	for _, r := range reviews {
+		if r.noteID != "" {
+			noteIDs = append(noteIDs, r.noteID)
+		}
+	}
+	questionIDs, quizIDs, noteIDs = unique(questionIDs), unique(quizIDs), unique(noteIDs)
+	var (
+		l   links
+		err error
+	)
+	if l.questions, err = specs.Load(ctx, db, specs.Questions, questionIDs); err != nil {
+		return nil, err
+	}
+	if l.quizzes, err = specs.Load(ctx, db, specs.Quizzes, quizIDs); err != nil {
+		return nil, err
+	}
+	if l.notes, err = specs.Load(ctx, db, specs.RevisionResources, noteIDs); err != nil {
+		return nil, err
+	}
+	if l.noteTags, err = tags.Load(ctx, db, tags.RevisionResources, noteIDs); err != nil {
+		return nil, err
+	}
+	var pointIDs []string
+	for _, m := range []map[string][]string{l.questions, l.quizzes, l.notes} {
+		for _, ids := range m {
+			pointIDs = append(pointIDs, ids...)
+		}
+	}
+	l.points, err = loadPoints(ctx, db, unique(pointIDs))
+	return &l, err
+}
+
+// loadPoints returns the reference and title of each of ids.
+func loadPoints(ctx context.Context, db *sql.DB, ids []string) (map[string]point, error) {
+	points := make(map[string]point, len(ids))
+	if len(ids) == 0 {
+		return points, nil
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, ref, title FROM spec_points WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id string
+			p  point
+		)
+		if err := rows.Scan(&id, &p.ref, &p.title); err != nil {
+			return nil, err
+		}
+		points[id] = p
+	}
+	return points, rows.Err()
+}
+
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+package mastery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+)
+
+// GetProgress handles GET /api/progress
+func GetProgress(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		progress, err := Compute(r.Context(), db, userID, time.Now())
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[GetProgress] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(progress)
+	}
+}
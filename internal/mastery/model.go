@@ -0,0 +1,133 @@
+// Package mastery works out how well a student knows each area they study, and what
+// they should do next. An area is a spec point, where quizzes, questions and notes are
+// linked to one, or otherwise a topic: a quiz's topic, a note's tags or an Anki deck.
+//
+// An area's score combines three things:
+//   - quiz accuracy: the share of its questions answered correctly, with each answer
+//     counting half as much for every 30 days since it was given;
+//   - retention: the chance, estimated from each card's review schedule, that its
+//     flashcards are still remembered today;
+//   - recency: the score fades towards half its value as the time since the area was
+//     last studied grows, so old mastery is not taken for granted.
+//
+// Progress also shows the time spent in study sessions, by day and by topic.
+package mastery
+
+import (
+	"math"
+	"strings"
+
+	"KdnSite/internal/study"
+)
+
+// Area kinds.
+const (
+	KindSpecPoint = "spec_point"
+	KindTopic     = "topic"
+)
+
+// Levels, from the score.
+const (
+	LevelLearning   = "learning"
+	LevelDeveloping = "developing"
+	LevelSecure     = "secure"
+)
+
+// Recommendation kinds.
+const (
+	ActionReview = "review"
+	ActionRetake = "retake"
+)
+
+const (
+	// accuracyHalfLife and recencyHalfLife are in days.
+	accuracyHalfLife = 30
+	recencyHalfLife  = 21
+	// accuracyWeight is the share of the score from quizzes when there are also cards.
+	accuracyWeight = 0.6
+	// history bounds how far back quiz answers are read, in days.
+	history = 365
+	// retakeBelow is the quiz accuracy below which retaking a quiz is recommended.
+	retakeBelow = 0.6
+	// maxRecommendations bounds how many next actions are suggested.
+	maxRecommendations = 5
+	// studyDays is how many days of study time progress shows, enough for a year's
+	// heatmap.
+	studyDays = 366
+)
+
+// Progress is the body of GET /api/progress.
+type Progress struct {
+	// Score is the mean score of every area, or nil if nothing has been studied yet.
+	Score           *int             `json:"score"`
+	DueCards        int              `json:"due_cards"`
+	Areas           []*Area          `json:"areas"`
+	Recommendations []Recommendation `json:"recommendations"`
+	// Study is the student's study time and streak, with the minutes of each day they
+	// studied in the last year.
+	Study *study.Summary `json:"study"`
+}
+
+// Area is the student's mastery of one spec point or topic. Accuracy and Retention are
+// fractions from 0 to 1, and nil when there are no quiz answers or reviewed cards.
+type Area struct {
+	ID            string   `json:"id"`
+	Kind          string   `json:"kind"`
+	Ref           string   `json:"ref,omitempty"`
+	Title         string   `json:"title"`
+	Score         int      `json:"score"`
+	Level         string   `json:"level"`
+	Accuracy      *float64 `json:"accuracy"`
+	Retention     *float64 `json:"retention"`
+	Answered      int      `json:"answered"`
+	Cards         int      `json:"cards"`
+	DueCards      int      `json:"due_cards"`
+	StudyMinutes  int      `json:"study_minutes"`
+	LastStudiedAt int64    `json:"last_studied_at"`
+}
+
+// Recommendation is a suggested next action, such as reviewing the cards due in an area
+// or retaking a quiz the student did badly in.
+type Recommendation struct {
+	Kind   string `json:"kind"`
+	Text   string `json:"text"`
+	AreaID string `json:"area_id"`
+	QuizID string `json:"quiz_id,omitempty"`
+	Cards  int    `json:"cards,omitempty"`
+	URL    string `json:"url"`
+}
+
+// TopicID returns the ID of the area for a topic, whether it is named by a quiz, a tag
+// or an Anki deck. Names match whatever their case.
+func TopicID(name string) string {
+	return "topic:" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// score works out Score and Level from the area's accuracy, retention and recency.
+func (a *Area) score(now int64) {
+	var base float64
+	switch {
+	case a.Accuracy != nil && a.Retention != nil:
+		base = accuracyWeight**a.Accuracy + (1-accuracyWeight)**a.Retention
+	case a.Accuracy != nil:
+		base = *a.Accuracy
+	case a.Retention != nil:
+		base = *a.Retention
+	}
+	days := math.Max(0, float64(now-a.LastStudiedAt)/86400)
+	recency := 0.5 + 0.5*math.Pow(0.5, days/recencyHalfLife)
+	a.Score = int(math.Round(100 * base * recency))
+	switch {
+	case a.Score >= 80:
+		a.Level = LevelSecure
+	case a.Score >= 50:
+		a.Level = LevelDeveloping
+	default:
+		a.Level = LevelLearning
+	}
+}
+
+// decay is how much an answer given at t counts at now.
+func decay(now, t int64) float64 {
+	return math.Pow(0.5, math.Max(0, float64(now-t)/86400)/accuracyHalfLife)
+}
@@ -0,0 +1,223 @@
+package mastery
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"KdnSite/internal/flashcards"
+	"KdnSite/internal/study"
+)
+
+// tally collects the evidence for one area as it is read.
+type tally struct {
+	area            *Area
+	correct, weight float64
+	retention       float64
+	quizzes         map[string]*quizTally
+}
+
+// quizTally is the decayed accuracy of one quiz's questions in an area.
+type quizTally struct {
+	id, title       string
+	correct, weight float64
+}
+
+// Compute returns userID's progress in every area they have studied, as of now.
+func Compute(ctx context.Context, db *sql.DB, userID string, now time.Time) (*Progress, error) {
+	t := now.Unix()
+	answers, err := loadAnswers(ctx, db, userID, now.AddDate(0, 0, -history).Unix())
+	if err != nil {
+		return nil, err
+	}
+	reviews, err := loadReviews(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	l, err := loadLinks(ctx, db, answers, reviews)
+	if err != nil {
+		return nil, err
+	}
+
+	tallies := map[string]*tally{}
+	// get returns the tally for each area the item is about, creating them as needed
+	get := func(pointIDs, topics []string) []*tally {
+		var out []*tally
+		for _, id := range pointIDs {
+			p, ok := l.points[id]
+			if !ok {
+				continue
+			}
+			if tallies[id] == nil {
+				tallies[id] = &tally{area: &Area{ID: id, Kind: KindSpecPoint, Ref: p.ref, Title: p.title}}
+			}
+			out = append(out, tallies[id])
+		}
+		if len(out) > 0 {
+			return out
+		}
+		for _, name := range topics {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			id := TopicID(name)
+			if tallies[id] == nil {
+				tallies[id] = &tally{area: &Area{ID: id, Kind: KindTopic, Title: name}}
+			}
+			out = append(out, tallies[id])
+		}
+		return out
+	}
+
+	for _, a := range answers {
+		points := l.questions[a.questionID]
+		if len(points) == 0 {
+			points = l.quizzes[a.quizID]
+		}
+		w := decay(t, a.answeredAt)
+		for _, ta := range get(points, []string{a.topic}) {
+			q := ta.quizzes[a.quizID]
+			if q == nil {
+				if ta.quizzes == nil {
+					ta.quizzes = map[string]*quizTally{}
+				}
+				q = &quizTally{id: a.quizID, title: a.quizTitle}
+				ta.quizzes[a.quizID] = q
+			}
+			q.weight += w
+			ta.weight += w
+			if a.correct {
+				q.correct += w
+				ta.correct += w
+			}
+			ta.area.Answered++
+			ta.area.LastStudiedAt = max(ta.area.LastStudiedAt, a.answeredAt)
+		}
+	}
+
+	progress := &Progress{Areas: []*Area{}, Recommendations: []Recommendation{}}
+	for _, r := range reviews {
+		due := r.dueAt <= t
+		if due {
+			progress.DueCards++
+		}
+		s := flashcards.Schedule{IntervalDays: r.intervalDays, ReviewedAt: r.reviewedAt}
+		retention := s.Retention(t)
+		topics := l.noteTags[r.noteID]
+		if r.deck != "" {
+			topics = []string{r.deck}
+		}
+		for _, ta := range get(l.notes[r.noteID], topics) {
+			ta.area.Cards++
+			ta.retention += retention
+			if due {
+				ta.area.DueCards++
+			}
+			ta.area.LastStudiedAt = max(ta.area.LastStudiedAt, r.reviewedAt)
+		}
+	}
+
+	// Study time shows against the topics it was spent on, but does not change their
+	// scores: only quizzes and reviews show what the student knows
+	minutes, err := study.TopicMinutes(ctx, db, userID, now.AddDate(0, 0, -history).Unix())
+	if err != nil {
+		return nil, err
+	}
+	for name, m := range minutes {
+		if ta := tallies[TopicID(name)]; ta != nil {
+			ta.area.StudyMinutes += m
+		}
+	}
+	if progress.Study, err = study.Summarise(ctx, db, userID, now, studyDays); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, ta := range tallies {
+		a := ta.area
+		if ta.weight > 0 {
+			acc := ta.correct / ta.weight
+			a.Accuracy = &acc
+		}
+		if a.Cards > 0 {
+			ret := ta.retention / float64(a.Cards)
+			a.Retention = &ret
+		}
+		a.score(t)
+		total += a.Score
+		progress.Areas = append(progress.Areas, a)
+	}
+	if len(progress.Areas) > 0 {
+		mean := (total + len(progress.Areas)/2) / len(progress.Areas)
+		progress.Score = &mean
+	}
+	slices.SortFunc(progress.Areas, func(a, b *Area) int {
+		return cmp.Or(cmp.Compare(b.Kind, a.Kind), cmp.Compare(a.Ref, b.Ref), cmp.Compare(a.Title, b.Title))
+	})
+	progress.Recommendations = recommend(tallies)
+	return progress, nil
+}
+
+// recommend suggests what to do next, starting with the weakest areas: review the cards
+// due in an area, then retake the quiz the student did worst in there.
+func recommend(tallies map[string]*tally) []Recommendation {
+	weakest := make([]*tally, 0, len(tallies))
+	for _, ta := range tallies {
+		weakest = append(weakest, ta)
+	}
+	slices.SortFunc(weakest, func(a, b *tally) int {
+		return cmp.Or(cmp.Compare(a.area.Score, b.area.Score), cmp.Compare(b.area.DueCards, a.area.DueCards), cmp.Compare(a.area.ID, b.area.ID))
+	})
+	recs := []Recommendation{}
+	retaken := map[string]bool{}
+	for _, ta := range weakest {
+		a := ta.area
+		if n := a.DueCards; n > 0 {
+			noun := "cards"
+			if n == 1 {
+				noun = "card"
+			}
+			recs = append(recs, Recommendation{
+				Kind:   ActionReview,
+				Text:   fmt.Sprintf("Review %d due %s on %s", n, noun, a.Title),
+				AreaID: a.ID,
+				Cards:  n,
+				URL:    "/user/revision",
+			})
+		}
+		var worst *quizTally
+		for _, q := range ta.quizzes {
+			if retaken[q.id] || q.correct/q.weight >= retakeBelow {
+				continue
+			}
+			if worst == nil || q.correct/q.weight < worst.correct/worst.weight ||
+				(q.correct/q.weight == worst.correct/worst.weight && q.id < worst.id) {
+				worst = q
+			}
+		}
+		if worst != nil {
+			retaken[worst.id] = true
+			title := worst.title
+			if !strings.HasSuffix(strings.ToLower(title), "quiz") {
+				title += " quiz"
+			}
+			recs = append(recs, Recommendation{
+				Kind:   ActionRetake,
+				Text:   "Retake " + title,
+				AreaID: a.ID,
+				QuizID: worst.id,
+				URL:    "/user/quiz/take?id=" + url.QueryEscape(worst.id),
+			})
+		}
+		if len(recs) >= maxRecommendations {
+			return recs[:maxRecommendations]
+		}
+	}
+	return recs
+}
@@ -0,0 +1,150 @@
+// Package metrics collects Prometheus metrics for HTTP traffic, the database pool,
+// SSE connections, rate limits and calls to Auth0.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric exposed on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// SSEConnections is the number of open server-sent event streams.
+	SSEConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sse_connections_open",
+		Help: "Open server-sent event connections.",
+	})
+
+	// JWKSRefreshFailures counts failed fetches of the Auth0 signing keys.
+	JWKSRefreshFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jwks_refresh_failures_total",
+		Help: "Failed fetches or refreshes of the Auth0 JWKS.",
+	})
+
+	// RateLimited counts requests checked by each rate limit rule, by whether they were
+	// allowed or limited.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ratelimit_requests_total",
+		Help: "Requests checked by a rate limit by rule and result (allowed or limited).",
+	}, []string{"rule", "result"})
+
+	auth0Duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "auth0_request_duration_seconds",
+		Help:    "Latency of outgoing Auth0 requests by endpoint and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "method", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, SSEConnections, JWKSRefreshFailures, RateLimited, auth0Duration,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB publishes the connection pool stats of db.
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// Middleware records each request against the mux pattern it matched, so that
+// paths with IDs in them don't each get their own series.
+func Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush lets SSE handlers that type-assert http.Flusher keep working.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Auth0Transport times requests made through base. User IDs in Management API
+// paths are replaced with {id} to keep the endpoint label bounded.
+func Auth0Transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := base.RoundTrip(req)
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(resp.StatusCode)
+		}
+		auth0Duration.WithLabelValues(auth0Endpoint(req.URL.Path), req.Method, status).Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+func auth0Endpoint(path string) string {
+	const users = "/api/v2/users/"
+	if rest, ok := strings.CutPrefix(path, users); ok {
+		if i := strings.Index(rest, "/"); i >= 0 {
+			return users + "{id}" + rest[i:]
+		}
+		return users + "{id}"
+	}
+	return path
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,138 @@
+// Package migrate applies the SQL files in migrations/ in filename order and records
+// each one in schema_migrations. Files are applied once, each in its own transaction;
+// never edit a file that has been released, add a new one instead.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+// lockID is the Postgres advisory lock key held while migrating, so replicas
+// starting together don't apply the same file twice.
+const lockID = 7_201_394_550
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version TEXT PRIMARY KEY,
+    applied_at BIGINT NOT NULL
+)`
+
+// Versions lists every embedded migration, oldest first.
+func Versions() ([]string, error) {
+	names, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(names))
+	for _, name := range names {
+		versions = append(versions, strings.TrimSuffix(path.Base(name), ".sql"))
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func Pending(ctx context.Context, db *sql.DB) ([]string, error) {
+	versions, err := Versions()
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]bool{}
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		// Nothing has been applied if the table doesn't exist yet
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "42P01" {
+			return versions, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, v := range versions {
+		if !applied[v] {
+			pending = append(pending, v)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies all pending migrations.
+func Up(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return err
+	}
+	pending, err := Pending(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, version := range pending {
+		if err := apply(ctx, conn, version); err != nil {
+			return err
+		}
+		log.Infof("[migrate.Up] Applied %s", version)
+	}
+	return nil
+}
+
+func apply(ctx context.Context, conn *sql.Conn, version string) error {
+	body, err := files.ReadFile("migrations/" + version + ".sql")
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, string(body)); err != nil {
+		return &Error{Version: version, Err: err}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, version, time.Now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Error reports which migration failed.
+type Error struct {
+	Version string
+	Err     error
+}
+
+func (e *Error) Error() string { return "migration " + e.Version + ": " + e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
@@ -49,6 +49,16 @@ CREATE TABLE IF NOT EXISTS quiz_results (
     answers INT[]
 );
 
+-- Quiz Attempts (answers submitted through /api/quiz/attempt)
+CREATE TABLE IF NOT EXISTS user_quiz_attempts (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id),
+    quiz_id TEXT REFERENCES quizzes(id),
+    answers JSONB NOT NULL,
+    score INT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 -- Revision/Resources
 CREATE TABLE IF NOT EXISTS revision_resources (
     id TEXT PRIMARY KEY,
@@ -81,6 +91,15 @@ CREATE TABLE IF NOT EXISTS leaderboard (
     PRIMARY KEY(user_id)
 );
 
+-- Achievements
+CREATE TABLE IF NOT EXISTS achievements (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id),
+    name TEXT NOT NULL,
+    "desc" TEXT NOT NULL,
+    earned_at BIGINT NOT NULL
+);
+
 -- Anki Decks (for imported Anki .apkg files)
 CREATE TABLE IF NOT EXISTS anki_decks (
     id TEXT PRIMARY KEY,
@@ -101,3 +120,51 @@ CREATE TABLE IF NOT EXISTS anki_cards (
     created_at BIGINT NOT NULL,
     updated_at BIGINT NOT NULL
 );
+
+-- Sessions (server-side record of each login, so devices can be listed and revoked)
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    device TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    last_seen_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    revoked_at BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_token_hash_idx ON sessions (token_hash);
+
+-- Data export jobs (GDPR downloads built in the background)
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    completed_at BIGINT,
+    expires_at BIGINT,
+    error TEXT,
+    object_key TEXT
+);
+
+CREATE INDEX IF NOT EXISTS export_jobs_user_id_idx ON export_jobs (user_id, created_at);
+
+-- Account deletions (grace period before erasure; kept as an audit log without the user ID once completed)
+CREATE TABLE IF NOT EXISTS account_deletions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT,
+    subject_hash TEXT NOT NULL,
+    status TEXT NOT NULL,
+    requested_at BIGINT NOT NULL,
+    scheduled_for BIGINT NOT NULL,
+    cancelled_at BIGINT,
+    completed_at BIGINT,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS account_deletions_user_id_idx ON account_deletions (user_id);
+CREATE INDEX IF NOT EXISTS account_deletions_due_idx ON account_deletions (status, scheduled_for);
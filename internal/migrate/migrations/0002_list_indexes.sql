@@ -0,0 +1,25 @@
+-- Quizzes are listed and filtered by topic
+ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS topic TEXT NOT NULL DEFAULT '';
+
+-- Keyset pagination: each index covers an owner's rows in a list sort order, with id as the tiebreaker
+CREATE INDEX IF NOT EXISTS projects_owner_updated_idx ON projects (owner_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS projects_owner_created_idx ON projects (owner_id, created_at, id);
+CREATE INDEX IF NOT EXISTS projects_owner_title_idx ON projects (owner_id, title, id);
+
+CREATE INDEX IF NOT EXISTS revision_resources_owner_created_idx ON revision_resources (owner_id, created_at, id);
+CREATE INDEX IF NOT EXISTS revision_resources_owner_updated_idx ON revision_resources (owner_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS revision_resources_owner_topic_idx ON revision_resources (owner_id, (COALESCE(topic, '')), id);
+CREATE INDEX IF NOT EXISTS revision_resources_owner_type_idx ON revision_resources (owner_id, type, created_at, id);
+
+CREATE INDEX IF NOT EXISTS resources_owner_created_idx ON resources (owner_id, created_at, id);
+CREATE INDEX IF NOT EXISTS resources_owner_updated_idx ON resources (owner_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS resources_owner_title_idx ON resources (owner_id, title, id);
+CREATE INDEX IF NOT EXISTS resources_owner_type_idx ON resources (owner_id, type, created_at, id);
+
+CREATE INDEX IF NOT EXISTS achievements_user_earned_idx ON achievements (user_id, earned_at, id);
+CREATE INDEX IF NOT EXISTS achievements_user_name_idx ON achievements (user_id, name, id);
+
+CREATE INDEX IF NOT EXISTS quizzes_title_idx ON quizzes (title, id);
+CREATE INDEX IF NOT EXISTS quizzes_created_idx ON quizzes (created_at, id);
+CREATE INDEX IF NOT EXISTS quizzes_topic_idx ON quizzes (topic, title, id);
@@ -0,0 +1,27 @@
+-- Full-text search: titles and topics weigh most (A), then body text (B), then project data (C)
+ALTER TABLE revision_resources ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(topic, '')), 'A') ||
+    setweight(to_tsvector('english', type), 'A') ||
+    setweight(to_tsvector('english', content), 'B')
+) STORED;
+
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', content), 'B')
+) STORED;
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', COALESCE(data, '{}'::jsonb)), 'C')
+) STORED;
+
+ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', topic), 'A') ||
+    setweight(to_tsvector('english', description), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS revision_resources_search_idx ON revision_resources USING GIN (search);
+CREATE INDEX IF NOT EXISTS resources_search_idx ON resources USING GIN (search);
+CREATE INDEX IF NOT EXISTS projects_search_idx ON projects USING GIN (search);
+CREATE INDEX IF NOT EXISTS quizzes_search_idx ON quizzes USING GIN (search);
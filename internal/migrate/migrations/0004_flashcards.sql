@@ -0,0 +1,38 @@
+-- Structured flashcard notes: the note as written (basic, cloze or image occlusion) is kept
+-- with the revision resource, and the cards generated from it live in flashcards
+ALTER TABLE revision_resources ADD COLUMN IF NOT EXISTS card JSONB;
+
+-- Generated cards share anki_cards' front/back/media columns so both are studied alike.
+-- Front and back are Markdown here (Anki's are HTML); occlusion holds the image and
+-- regions for image occlusion cards. card_key names what the card asks about, so an
+-- edited note keeps each card, and its review schedule, even if it reorders them.
+CREATE TABLE IF NOT EXISTS flashcards (
+    id TEXT PRIMARY KEY,
+    note_id TEXT NOT NULL REFERENCES revision_resources(id) ON DELETE CASCADE,
+    owner_id TEXT NOT NULL REFERENCES users(id),
+    ord INT NOT NULL,
+    card_key TEXT NOT NULL,
+    front TEXT NOT NULL,
+    back TEXT NOT NULL,
+    media JSONB,
+    occlusion JSONB,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL,
+    UNIQUE (note_id, ord)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS flashcards_note_key_idx ON flashcards (note_id, card_key);
+
+CREATE INDEX IF NOT EXISTS flashcards_owner_created_idx ON flashcards (owner_id, created_at, id);
+CREATE INDEX IF NOT EXISTS anki_cards_owner_created_idx ON anki_cards (owner_id, created_at, id);
+
+-- Uploaded images and audio, recorded so they can be removed with the account
+CREATE TABLE IF NOT EXISTS flashcard_media (
+    name TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL REFERENCES users(id),
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS flashcard_media_owner_idx ON flashcard_media (owner_id);
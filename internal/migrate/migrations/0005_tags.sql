@@ -0,0 +1,73 @@
+-- Tags: each user's own labels, shared by revision resources and resources
+CREATE TABLE IF NOT EXISTS tags (
+    id TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    UNIQUE (owner_id, slug)
+);
+
+CREATE TABLE IF NOT EXISTS revision_resource_tags (
+    resource_id TEXT NOT NULL REFERENCES revision_resources(id) ON DELETE CASCADE,
+    tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (resource_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_tags (
+    resource_id TEXT NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (resource_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS revision_resource_tags_tag_idx ON revision_resource_tags (tag_id);
+CREATE INDEX IF NOT EXISTS resource_tags_tag_idx ON resource_tags (tag_id);
+
+-- Every existing revision topic becomes a tag on the resources that had it
+INSERT INTO tags (id, owner_id, name, slug, created_at)
+SELECT gen_random_uuid()::text, owner_id, min(btrim(topic)), slug, min(created_at)
+FROM (
+    SELECT owner_id, topic, created_at,
+        btrim(regexp_replace(lower(btrim(topic)), '[^[:alnum:]]+', '-', 'g'), '-') AS slug
+    FROM revision_resources
+    WHERE owner_id IS NOT NULL AND btrim(COALESCE(topic, '')) <> ''
+) topics
+WHERE slug <> ''
+GROUP BY owner_id, slug
+ON CONFLICT (owner_id, slug) DO NOTHING;
+
+INSERT INTO revision_resource_tags (resource_id, tag_id)
+SELECT r.id, t.id
+FROM revision_resources r
+JOIN tags t ON t.owner_id = r.owner_id
+    AND t.slug = btrim(regexp_replace(lower(btrim(r.topic)), '[^[:alnum:]]+', '-', 'g'), '-')
+ON CONFLICT DO NOTHING;
+
+-- tag_names copies an item's tag names so full-text search can index them; the tags
+-- package keeps it up to date
+ALTER TABLE revision_resources ADD COLUMN IF NOT EXISTS tag_names TEXT NOT NULL DEFAULT '';
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS tag_names TEXT NOT NULL DEFAULT '';
+
+UPDATE revision_resources r SET tag_names = t.name
+FROM revision_resource_tags rt JOIN tags t ON t.id = rt.tag_id
+WHERE rt.resource_id = r.id;
+
+-- The free-text topic is replaced by tags
+ALTER TABLE revision_resources DROP COLUMN IF EXISTS search;
+ALTER TABLE revision_resources DROP COLUMN IF EXISTS topic;
+ALTER TABLE resources DROP COLUMN IF EXISTS search;
+
+ALTER TABLE revision_resources ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', tag_names), 'A') ||
+    setweight(to_tsvector('english', type), 'A') ||
+    setweight(to_tsvector('english', content), 'B')
+) STORED;
+
+ALTER TABLE resources ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', tag_names), 'A') ||
+    setweight(to_tsvector('english', content), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS revision_resources_search_idx ON revision_resources USING GIN (search);
+CREATE INDEX IF NOT EXISTS resources_search_idx ON resources USING GIN (search);
@@ -0,0 +1,46 @@
+-- Classes: a teacher's group of students, who join with the class code
+CREATE TABLE IF NOT EXISTS classes (
+    id TEXT PRIMARY KEY,
+    teacher_id TEXT NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    code TEXT NOT NULL UNIQUE,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS classes_teacher_idx ON classes (teacher_id);
+
+CREATE TABLE IF NOT EXISTS class_members (
+    class_id TEXT NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    joined_at BIGINT NOT NULL,
+    PRIMARY KEY (class_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS class_members_user_idx ON class_members (user_id);
+
+-- Library: teachers and admins publish resources to a class or to everyone. Existing
+-- resources stay private to their owner.
+ALTER TABLE resources
+    ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'private'
+        CHECK (visibility IN ('private', 'class', 'public')),
+    ADD COLUMN IF NOT EXISTS class_id TEXT REFERENCES classes(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS exam_board TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS spec_codes TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'approved'
+        CHECK (status IN ('pending', 'approved', 'rejected')),
+    ADD COLUMN IF NOT EXISTS moderation_note TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS reviewed_by TEXT,
+    ADD COLUMN IF NOT EXISTS reviewed_at BIGINT,
+    ADD COLUMN IF NOT EXISTS published_at BIGINT;
+
+CREATE INDEX IF NOT EXISTS resources_library_idx ON resources (visibility, status, published_at, id)
+    WHERE visibility <> 'private';
+CREATE INDEX IF NOT EXISTS resources_class_idx ON resources (class_id) WHERE class_id IS NOT NULL;
+
+-- A copy of a library item in a student's revision remembers where it came from, so
+-- the same item is not copied twice
+ALTER TABLE revision_resources
+    ADD COLUMN IF NOT EXISTS source_id TEXT REFERENCES resources(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS revision_resources_source_idx ON revision_resources (owner_id, source_id)
+    WHERE source_id IS NOT NULL;
@@ -0,0 +1,54 @@
+-- Exam specifications, loaded from the seed files in internal/specs at startup. A spec
+-- is one board's qualification in a subject; its points are topics and subtopics.
+CREATE TABLE IF NOT EXISTS specs (
+    id TEXT PRIMARY KEY,
+    board TEXT NOT NULL,
+    qualification TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    code TEXT NOT NULL,
+    title TEXT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS spec_points (
+    id TEXT PRIMARY KEY,
+    spec_id TEXT NOT NULL REFERENCES specs(id) ON DELETE CASCADE,
+    parent_id TEXT REFERENCES spec_points(id) ON DELETE CASCADE,
+    ref TEXT NOT NULL,
+    title TEXT NOT NULL,
+    level TEXT NOT NULL CHECK (level IN ('topic', 'subtopic')),
+    ord INT NOT NULL,
+    UNIQUE (spec_id, ref)
+);
+
+CREATE INDEX IF NOT EXISTS spec_points_spec_idx ON spec_points (spec_id, ord);
+
+-- Links from content to the spec points it covers
+CREATE TABLE IF NOT EXISTS quiz_spec_points (
+    item_id TEXT NOT NULL REFERENCES quizzes(id) ON DELETE CASCADE,
+    point_id TEXT NOT NULL REFERENCES spec_points(id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, point_id)
+);
+
+CREATE TABLE IF NOT EXISTS question_spec_points (
+    item_id TEXT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    point_id TEXT NOT NULL REFERENCES spec_points(id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, point_id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_spec_points (
+    item_id TEXT NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    point_id TEXT NOT NULL REFERENCES spec_points(id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, point_id)
+);
+
+CREATE TABLE IF NOT EXISTS revision_resource_spec_points (
+    item_id TEXT NOT NULL REFERENCES revision_resources(id) ON DELETE CASCADE,
+    point_id TEXT NOT NULL REFERENCES spec_points(id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, point_id)
+);
+
+CREATE INDEX IF NOT EXISTS quiz_spec_points_point_idx ON quiz_spec_points (point_id);
+CREATE INDEX IF NOT EXISTS question_spec_points_point_idx ON question_spec_points (point_id);
+CREATE INDEX IF NOT EXISTS resource_spec_points_point_idx ON resource_spec_points (point_id);
+CREATE INDEX IF NOT EXISTS revision_resource_spec_points_point_idx ON revision_resource_spec_points (point_id);
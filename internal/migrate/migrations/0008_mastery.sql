@@ -0,0 +1,41 @@
+-- Spaced repetition: when each card a student has studied is next due. Cards come from
+-- two tables (flashcards and anki_cards), so card_id is not a foreign key; the code
+-- deletes a card's schedule and reviews with the card.
+CREATE TABLE IF NOT EXISTS card_schedules (
+    owner_id TEXT NOT NULL REFERENCES users(id),
+    card_id TEXT NOT NULL,
+    ease REAL NOT NULL,
+    interval_days REAL NOT NULL,
+    repetitions INT NOT NULL DEFAULT 0,
+    lapses INT NOT NULL DEFAULT 0,
+    due_at BIGINT NOT NULL,
+    reviewed_at BIGINT NOT NULL,
+    PRIMARY KEY (owner_id, card_id)
+);
+
+CREATE INDEX IF NOT EXISTS card_schedules_due_idx ON card_schedules (owner_id, due_at);
+
+CREATE TABLE IF NOT EXISTS card_reviews (
+    id TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL REFERENCES users(id),
+    card_id TEXT NOT NULL,
+    grade TEXT NOT NULL CHECK (grade IN ('again', 'hard', 'good', 'easy')),
+    interval_days REAL NOT NULL,
+    reviewed_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS card_reviews_owner_idx ON card_reviews (owner_id, reviewed_at);
+
+-- Each question of a quiz attempt and whether it was answered correctly, so accuracy
+-- can be worked out per spec point and topic
+CREATE TABLE IF NOT EXISTS question_attempts (
+    attempt_id TEXT NOT NULL REFERENCES user_quiz_attempts(id) ON DELETE CASCADE,
+    question_id TEXT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    quiz_id TEXT NOT NULL REFERENCES quizzes(id) ON DELETE CASCADE,
+    correct BOOLEAN NOT NULL,
+    answered_at BIGINT NOT NULL,
+    PRIMARY KEY (attempt_id, question_id)
+);
+
+CREATE INDEX IF NOT EXISTS question_attempts_user_idx ON question_attempts (user_id, answered_at);
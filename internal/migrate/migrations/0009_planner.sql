@@ -0,0 +1,37 @@
+-- Revision planner: a student's exams, when they can study each week, and the sessions
+-- planned from them
+CREATE TABLE IF NOT EXISTS exams (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    title TEXT NOT NULL,
+    spec_id TEXT REFERENCES specs(id) ON DELETE SET NULL,
+    topics TEXT[] NOT NULL DEFAULT '{}',
+    starts_at BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS exams_user_idx ON exams (user_id, starts_at);
+
+-- slots is a list of weekly windows, {weekday, start, minutes}, in the user's timezone
+CREATE TABLE IF NOT EXISTS study_availability (
+    user_id TEXT PRIMARY KEY REFERENCES users(id),
+    timezone TEXT NOT NULL,
+    session_minutes INT NOT NULL,
+    slots JSONB NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS plan_sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    exam_id TEXT NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+    area_id TEXT NOT NULL,
+    area_title TEXT NOT NULL,
+    starts_at BIGINT NOT NULL,
+    minutes INT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'planned' CHECK (status IN ('planned', 'done', 'missed', 'skipped')),
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS plan_sessions_user_idx ON plan_sessions (user_id, starts_at);
@@ -0,0 +1,28 @@
+-- Timed study sessions. focus_seconds is the time spent studying before the session
+-- last paused; while it runs, the time since resumed_at counts too. day is the date the
+-- session started on in the student's timezone, which streaks and the heatmap count by.
+CREATE TABLE IF NOT EXISTS study_sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    topic TEXT NOT NULL DEFAULT '',
+    tag_id TEXT REFERENCES tags(id) ON DELETE SET NULL,
+    planned_minutes INT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('running', 'paused', 'finished')),
+    focus_seconds INT NOT NULL DEFAULT 0,
+    pauses INT NOT NULL DEFAULT 0,
+    resumed_at BIGINT,
+    timezone TEXT NOT NULL,
+    day DATE NOT NULL,
+    started_at BIGINT NOT NULL,
+    ended_at BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS study_sessions_user_idx ON study_sessions (user_id, day);
+
+-- A student has at most one session on the go
+CREATE UNIQUE INDEX IF NOT EXISTS study_sessions_active_idx ON study_sessions (user_id) WHERE status <> 'finished';
+
+-- The leaderboard's streak is only current while the student keeps studying, so it
+-- records the last day they studied and the timezone that day is in
+ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS studied_on DATE;
+ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,5 @@
+-- Leaderboard ranks are worked out when the leaderboard is read, so recording one
+-- student's study does not re-rank everyone.
+ALTER TABLE leaderboard DROP COLUMN IF EXISTS rank;
+
+CREATE INDEX IF NOT EXISTS leaderboard_score_idx ON leaderboard (score DESC, streak DESC);
@@ -0,0 +1,272 @@
+// Package pagination parses the shared list query parameters and turns them into
+// keyset-paginated SQL, so every list endpoint pages, sorts and filters the same way.
+//
+// Query parameters:
+//
+//	limit    page size, 1 to MaxLimit (default DefaultLimit)
+//	cursor   opaque value from the previous page's next_cursor
+//	sort     a sort key, prefixed with - for descending (e.g. -created_at)
+//	from,to  inclusive date range on the endpoint's date column, as YYYY-MM-DD,
+//	         RFC 3339 or Unix seconds
+//
+// plus any filters (type, tag, ...) the endpoint declares in its Spec.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"KdnSite/internal/problem"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// SortField is a column a list can be ordered by.
+type SortField struct {
+	Column  string // SQL expression; must be NOT NULL (wrap nullable columns in COALESCE)
+	Numeric bool   // cursor values are compared as BIGINT rather than text
+}
+
+// Spec declares what a list endpoint accepts. Column names come only from the Spec,
+// never from the request, so they are safe to interpolate.
+type Spec struct {
+	IDColumn    string               // unique tiebreaker, usually "id"
+	Sorts       map[string]SortField // sort key -> field
+	DefaultSort string               // e.g. "-created_at"
+	Filters     map[string]string    // query parameter -> column compared with =
+	Conditions  map[string]string    // query parameter -> SQL condition with %s for the value
+	DateColumn  string               // BIGINT Unix seconds column filtered by from/to; empty disables them
+}
+
+// Query is a parsed, validated list request.
+type Query struct {
+	spec    Spec
+	Limit   int
+	SortKey string
+	Desc    bool
+	after   *cursor
+	filters []filter
+	from    *int64
+	to      *int64
+}
+
+type filter struct {
+	column    string
+	condition string
+	value     string
+}
+
+// cursor marks the last row of the previous page. It records the sort so a cursor
+// cannot be replayed against a different ordering.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// Parse reads the list parameters from r. Invalid values produce a 422 problem.
+func Parse(r *http.Request, spec Spec) (*Query, error) {
+	values := r.URL.Query()
+	q := &Query{spec: spec, Limit: DefaultLimit}
+	var errs []problem.FieldError
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			errs = append(errs, problem.FieldError{Field: "limit", Code: "out_of_range", Message: fmt.Sprintf("must be a whole number from 1 to %d", MaxLimit)})
+		} else {
+			q.Limit = n
+		}
+	}
+
+	sort := values.Get("sort")
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	key := strings.TrimPrefix(sort, "-")
+	if _, ok := spec.Sorts[key]; ok {
+		q.SortKey, q.Desc = key, strings.HasPrefix(sort, "-")
+	} else {
+		errs = append(errs, problem.FieldError{Field: "sort", Code: "invalid_choice", Message: "must be one of " + strings.Join(sortChoices(spec), ", ")})
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err == nil && spec.Sorts[key].Numeric {
+			_, err = strconv.ParseInt(c.Value, 10, 64)
+		}
+		if err != nil || c.Sort != sort {
+			errs = append(errs, problem.FieldError{Field: "cursor", Code: "invalid", Message: "is not a cursor from this list and sort order"})
+		} else {
+			q.after = c
+		}
+	}
+
+	for _, param := range slices.Sorted(maps.Keys(spec.Filters)) {
+		if v := strings.TrimSpace(values.Get(param)); v != "" {
+			q.filters = append(q.filters, filter{column: spec.Filters[param], value: v})
+		}
+	}
+	for _, param := range slices.Sorted(maps.Keys(spec.Conditions)) {
+		if v := strings.TrimSpace(values.Get(param)); v != "" {
+			q.filters = append(q.filters, filter{condition: spec.Conditions[param], value: v})
+		}
+	}
+
+	if spec.DateColumn != "" {
+		for _, bound := range []struct {
+			param string
+			dst   **int64
+			end   bool
+		}{{"from", &q.from, false}, {"to", &q.to, true}} {
+			v := values.Get(bound.param)
+			if v == "" {
+				continue
+			}
+			t, err := parseTime(v, bound.end)
+			if err != nil {
+				errs = append(errs, problem.FieldError{Field: bound.param, Code: "invalid_date", Message: "must be a date (YYYY-MM-DD), an RFC 3339 time or Unix seconds"})
+				continue
+			}
+			*bound.dst = &t
+		}
+		if q.from != nil && q.to != nil && *q.from > *q.to {
+			errs = append(errs, problem.FieldError{Field: "to", Code: "invalid_range", Message: "must not be before from"})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, problem.Validation(errs...)
+	}
+	return q, nil
+}
+
+// SQL appends the filters, the keyset condition, the ordering and the limit to base,
+// a SELECT that already has a WHERE clause using args. It fetches one extra row so
+// NewPage can tell whether another page follows.
+func (q *Query) SQL(base string, args ...any) (string, []any) {
+	var b strings.Builder
+	b.WriteString(base)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	for _, f := range q.filters {
+		if f.condition != "" {
+			fmt.Fprintf(&b, " AND "+f.condition, arg(f.value))
+		} else {
+			fmt.Fprintf(&b, " AND %s = %s", f.column, arg(f.value))
+		}
+	}
+	if q.from != nil {
+		fmt.Fprintf(&b, " AND %s >= %s", q.spec.DateColumn, arg(*q.from))
+	}
+	if q.to != nil {
+		fmt.Fprintf(&b, " AND %s <= %s", q.spec.DateColumn, arg(*q.to))
+	}
+
+	field := q.spec.Sorts[q.SortKey]
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.after != nil {
+		var value any = q.after.Value
+		if field.Numeric {
+			value, _ = strconv.ParseInt(q.after.Value, 10, 64)
+		}
+		fmt.Fprintf(&b, " AND (%s, %s) %s (%s, %s)", field.Column, q.spec.IDColumn, cmp, arg(value), arg(q.after.ID))
+	}
+	fmt.Fprintf(&b, " ORDER BY %s %s, %s %s LIMIT %d", field.Column, dir, q.spec.IDColumn, dir, q.Limit+1)
+	return b.String(), args
+}
+
+// Page is the response body of every paginated list.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+}
+
+// NewPage trims the extra row fetched by SQL and builds the cursor for the next page.
+// key returns an item's value for the current sort key and its ID.
+func NewPage[T any](q *Query, items []T, key func(item T, sortKey string) (value, id string)) Page[T] {
+	sort := q.SortKey
+	if q.Desc {
+		sort = "-" + sort
+	}
+	page := Page[T]{Items: items, Limit: q.Limit, Sort: sort}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(items) > q.Limit {
+		page.Items = items[:q.Limit]
+		page.HasMore = true
+		value, id := key(page.Items[q.Limit-1], q.SortKey)
+		page.NextCursor = encodeCursor(cursor{Sort: sort, Value: value, ID: id})
+	}
+	return page
+}
+
+// Write sends page as JSON.
+func Write[T any](w http.ResponseWriter, page Page[T]) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func sortChoices(spec Spec) []string {
+	var out []string
+	for key := range spec.Sorts {
+		out = append(out, key, "-"+key)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// parseTime reads a from/to bound as Unix seconds. A bare date as the end of a range
+// covers that whole day.
+func parseTime(v string, end bool) (int64, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return 0, err
+	}
+	if end {
+		return t.AddDate(0, 0, 1).Unix() - 1, nil
+	}
+	return t.Unix(), nil
+}
@@ -0,0 +1,341 @@
+package planner
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"KdnSite/internal/mastery"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+)
+
+const selectExam = `SELECT id, title, COALESCE(spec_id, ''), topics, starts_at, created_at, updated_at FROM exams`
+
+func scanExam(row interface{ Scan(...any) error }) (*Exam, error) {
+	var e Exam
+	if err := row.Scan(&e.ID, &e.Title, &e.SpecID, pq.Array(&e.Topics), &e.StartsAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if e.Topics == nil {
+		e.Topics = []string{}
+	}
+	return &e, nil
+}
+
+// listExams returns the user's exams, soonest first. With upcoming set, only exams
+// that have not started by now are returned.
+func listExams(ctx context.Context, db *sql.DB, userID string, upcoming bool, now int64) ([]*Exam, error) {
+	query := selectExam + ` WHERE user_id=$1 ORDER BY starts_at, id`
+	args := []any{userID}
+	if upcoming {
+		query = selectExam + ` WHERE user_id=$1 AND starts_at > $2 ORDER BY starts_at, id`
+		args = append(args, now)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exams := []*Exam{}
+	for rows.Next() {
+		e, err := scanExam(rows)
+		if err != nil {
+			return nil, err
+		}
+		exams = append(exams, e)
+	}
+	return exams, rows.Err()
+}
+
+func getExam(ctx context.Context, db *sql.DB, userID, id string) (*Exam, error) {
+	return scanExam(db.QueryRowContext(ctx, selectExam+` WHERE id=$1 AND user_id=$2`, id, userID))
+}
+
+// checkSpec returns a validation problem if specID is set but not a spec.
+func checkSpec(ctx context.Context, db *sql.DB, specID string) error {
+	if specID == "" {
+		return nil
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM specs WHERE id=$1)`, specID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return problem.Validation(problem.FieldError{Field: "spec_id", Code: "not_found", Message: "is not a spec"})
+	}
+	return nil
+}
+
+func createExam(ctx context.Context, db *sql.DB, userID string, e *Exam) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO exams (id, user_id, title, spec_id, topics, starts_at, created_at, updated_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8)`,
+		e.ID, userID, e.Title, e.SpecID, pq.Array(e.Topics), e.StartsAt, e.CreatedAt, e.UpdatedAt)
+	return err
+}
+
+func updateExam(ctx context.Context, db *sql.DB, userID string, e *Exam) error {
+	_, err := db.ExecContext(ctx, `UPDATE exams SET title=$3, spec_id=NULLIF($4, ''), topics=$5, starts_at=$6, updated_at=$7 WHERE id=$1 AND user_id=$2`,
+		e.ID, userID, e.Title, e.SpecID, pq.Array(e.Topics), e.StartsAt, e.UpdatedAt)
+	return err
+}
+
+func deleteExam(ctx context.Context, db *sql.DB, userID, id string) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM exams WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// getAvailability returns the user's weekly availability, or nil if they have not set it.
+func getAvailability(ctx context.Context, db *sql.DB, userID string) (*Availability, error) {
+	var (
+		a     Availability
+		slots []byte
+	)
+	err := db.QueryRowContext(ctx, `SELECT timezone, session_minutes, slots FROM study_availability WHERE user_id=$1`, userID).
+		Scan(&a.Timezone, &a.SessionMinutes, &slots)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(slots, &a.Slots); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func putAvailability(ctx context.Context, db *sql.DB, userID string, a *Availability, now int64) error {
+	slots, err := json.Marshal(a.Slots)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO study_availability (user_id, timezone, session_minutes, slots, updated_at) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE SET timezone=EXCLUDED.timezone, session_minutes=EXCLUDED.session_minutes, slots=EXCLUDED.slots, updated_at=EXCLUDED.updated_at`,
+		userID, a.Timezone, a.SessionMinutes, slots, now)
+	return err
+}
+
+// listSessions returns the user's sessions starting from from until before to.
+func listSessions(ctx context.Context, db *sql.DB, userID string, from, to int64) ([]*Session, error) {
+	rows, err := db.QueryContext(ctx, `SELECT s.id, s.exam_id, e.title, s.area_id, s.area_title, s.starts_at, s.minutes, s.status
+FROM plan_sessions s JOIN exams e ON e.id = s.exam_id
+WHERE s.user_id=$1 AND s.starts_at >= $2 AND s.starts_at < $3 ORDER BY s.starts_at, s.id`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.ExamID, &s.ExamTitle, &s.AreaID, &s.AreaTitle, &s.StartsAt, &s.Minutes, &s.Status); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, rows.Err()
+}
+
+func setSessionStatus(ctx context.Context, db *sql.DB, userID, id, status string, now int64) error {
+	res, err := db.ExecContext(ctx, `UPDATE plan_sessions SET status=$3, updated_at=$4 WHERE id=$1 AND user_id=$2`, id, userID, status, now)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// markMissed records planned sessions that ended before now as missed, and returns
+// how many there were.
+func markMissed(ctx context.Context, db *sql.DB, userID string, now int64) (int64, error) {
+	res, err := db.ExecContext(ctx, `UPDATE plan_sessions SET status='missed', updated_at=$2
+WHERE user_id=$1 AND status='planned' AND starts_at + minutes * 60 <= $2`, userID, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Sync records any sessions missed since the user last looked, and if there were any
+// plans the rest of the timetable again.
+func Sync(ctx context.Context, db *sql.DB, userID string, now time.Time) error {
+	n, err := markMissed(ctx, db, userID, now.Unix())
+	if err != nil || n == 0 {
+		return err
+	}
+	return Replan(ctx, db, userID, now)
+}
+
+// Today returns the user's sessions for today in their timezone, after recording any
+// that were missed.
+func Today(ctx context.Context, db *sql.DB, userID string, now time.Time) ([]*Session, error) {
+	if err := Sync(ctx, db, userID, now); err != nil {
+		return nil, err
+	}
+	av, err := getAvailability(ctx, db, userID)
+	if err != nil || av == nil {
+		return nil, err
+	}
+	from, to := today(av, now)
+	return listSessions(ctx, db, userID, from, to)
+}
+
+// Replan replaces the user's planned sessions from now on with a new plan from their
+// exams, availability and current mastery. Sessions already done, missed or skipped
+// are kept, and no new session starts at the same time as one of them.
+func Replan(ctx context.Context, db *sql.DB, userID string, now time.Time) error {
+	t := now.Unix()
+	if _, err := markMissed(ctx, db, userID, t); err != nil {
+		return err
+	}
+	av, err := getAvailability(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	exams, err := listExams(ctx, db, userID, true, t)
+	if err != nil {
+		return err
+	}
+	var sessions []*Session
+	if av != nil && len(exams) > 0 {
+		if sessions, err = plan(ctx, db, userID, av, exams, now); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// One plan at a time per user, so concurrent requests do not both add sessions
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('planner:' || $1))`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM plan_sessions WHERE user_id=$1 AND status='planned' AND starts_at >= $2`, userID, t); err != nil {
+		return err
+	}
+	// Sessions the student has already dealt with, or is in the middle of, stay put
+	rows, err := tx.QueryContext(ctx, `SELECT starts_at, starts_at + minutes * 60 FROM plan_sessions
+WHERE user_id=$1 AND starts_at + minutes * 60 > $2`, userID, t)
+	if err != nil {
+		return err
+	}
+	var taken [][2]int64
+	for rows.Next() {
+		var start, end int64
+		if err := rows.Scan(&start, &end); err != nil {
+			rows.Close()
+			return err
+		}
+		taken = append(taken, [2]int64{start, end})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var ids, examIDs, areaIDs, titles []string
+	var starts, minutes []int64
+	for _, s := range sessions {
+		if clashes(taken, s.StartsAt, s.StartsAt+int64(s.Minutes)*60) {
+			continue
+		}
+		ids = append(ids, s.ID)
+		examIDs = append(examIDs, s.ExamID)
+		areaIDs = append(areaIDs, s.AreaID)
+		titles = append(titles, s.AreaTitle)
+		starts = append(starts, s.StartsAt)
+		minutes = append(minutes, int64(s.Minutes))
+	}
+	if len(ids) > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO plan_sessions (id, user_id, exam_id, area_id, area_title, starts_at, minutes, updated_at)
+SELECT id, $1, exam_id, area_id, area_title, starts_at, minutes, $8
+FROM unnest($2::text[], $3::text[], $4::text[], $5::text[], $6::bigint[], $7::int[]) AS s(id, exam_id, area_id, area_title, starts_at, minutes)`,
+			userID, pq.Array(ids), pq.Array(examIDs), pq.Array(areaIDs), pq.Array(titles), pq.Array(starts), pq.Array(minutes), t)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// clashes reports whether the interval from start to end overlaps any of taken.
+func clashes(taken [][2]int64, start, end int64) bool {
+	for _, iv := range taken {
+		if start < iv[1] && iv[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// plan works out the sessions for exams from now until the last of them.
+func plan(ctx context.Context, db *sql.DB, userID string, av *Availability, exams []*Exam, now time.Time) ([]*Session, error) {
+	loc, err := time.LoadLocation(av.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := mastery.Compute(ctx, db, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]int, len(progress.Areas))
+	for _, a := range progress.Areas {
+		scores[a.ID] = a.Score
+	}
+	missed, err := recentlyMissed(ctx, db, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]target, 0, len(exams))
+	for _, e := range exams {
+		var spec *specs.Spec
+		if e.SpecID != "" {
+			spec, err = specs.Tree(ctx, db, e.SpecID)
+			if errors.Is(err, sql.ErrNoRows) {
+				spec = nil
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if t := buildTarget(e, spec, scores, missed); len(t.areas) > 0 {
+			targets = append(targets, t)
+		}
+	}
+	end := time.Unix(exams[len(exams)-1].StartsAt, 0)
+	if limit := now.Add(horizon); end.After(limit) {
+		end = limit
+	}
+	length := time.Duration(av.SessionMinutes) * time.Minute
+	return allocate(sessionStarts(av, loc, now, end, length), targets, av.SessionMinutes, loc), nil
+}
+
+// recentlyMissed returns the areas of sessions missed in the last fortnight.
+func recentlyMissed(ctx context.Context, db *sql.DB, userID string, now time.Time) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT area_id FROM plan_sessions WHERE user_id=$1 AND status='missed' AND starts_at >= $2`,
+		userID, now.AddDate(0, 0, -14).Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	missed := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		missed[id] = true
+	}
+	return missed, rows.Err()
+}
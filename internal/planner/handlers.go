@@ -0,0 +1,380 @@
+package planner
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
+)
+
+// defaultAvailability is returned until the student sets their own.
+var defaultAvailability = Availability{Timezone: "UTC", SessionMinutes: 45, Slots: []Slot{}}
+
+// maxRange bounds the time GET /api/planner/plan can list, in seconds.
+const maxRange = 366 * 24 * 60 * 60
+
+// ListExams handles GET /api/planner/exams
+func ListExams(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		exams, err := listExams(r.Context(), db, userID, false, 0)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ListExams] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeJSON(w, http.StatusOK, exams)
+	}
+}
+
+// CreateExam handles POST /api/planner/exams
+func CreateExam(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req ExamRequest
+		if err := validate.DecodeJSON(w, r, 16<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		now := time.Now()
+		if errs := req.Validate(now); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if err := checkSpec(r.Context(), db, req.SpecID); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		e := Exam{
+			ID:        uuid.NewString(),
+			Title:     strings.TrimSpace(req.Title),
+			SpecID:    req.SpecID,
+			Topics:    req.Topics,
+			StartsAt:  req.StartsAt,
+			CreatedAt: now.Unix(),
+			UpdatedAt: now.Unix(),
+		}
+		if err := createExam(r.Context(), db, userID, &e); err != nil {
+			logging.FromContext(r.Context()).Errorf("[CreateExam] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		replan(r, db, userID, now)
+		writeJSON(w, http.StatusCreated, &e)
+	}
+}
+
+// UpdateExam handles PATCH /api/planner/exams/{id}
+func UpdateExam(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req UpdateExamRequest
+		if err := validate.DecodeJSON(w, r, 16<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		e, err := getExam(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Exam not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		now := time.Now()
+		if errs := req.Apply(e, now); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if req.SpecID != nil {
+			if err := checkSpec(r.Context(), db, e.SpecID); err != nil {
+				problem.Error(w, r, err)
+				return
+			}
+		}
+		e.UpdatedAt = now.Unix()
+		if err := updateExam(r.Context(), db, userID, e); err != nil {
+			logging.FromContext(r.Context()).Errorf("[UpdateExam] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		replan(r, db, userID, now)
+		writeJSON(w, http.StatusOK, e)
+	}
+}
+
+// DeleteExam handles DELETE /api/planner/exams/{id}
+func DeleteExam(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		err = deleteExam(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Exam not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		replan(r, db, userID, time.Now())
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetAvailability handles GET /api/planner/availability
+func GetAvailability(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		av, err := getAvailability(r.Context(), db, userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[GetAvailability] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if av == nil {
+			av = &defaultAvailability
+		}
+		writeJSON(w, http.StatusOK, av)
+	}
+}
+
+// SetAvailability handles PUT /api/planner/availability
+func SetAvailability(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var av Availability
+		if err := validate.DecodeJSON(w, r, 16<<10, &av); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := av.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		now := time.Now()
+		if err := putAvailability(r.Context(), db, userID, &av, now.Unix()); err != nil {
+			logging.FromContext(r.Context()).Errorf("[SetAvailability] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		replan(r, db, userID, now)
+		writeJSON(w, http.StatusOK, &av)
+	}
+}
+
+// GetPlan handles GET /api/planner/plan. It lists the sessions starting between from
+// and to (Unix seconds), by default the next two weeks from the start of today.
+func GetPlan(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		now := time.Now()
+		if err := Sync(r.Context(), db, userID, now); err != nil {
+			logging.FromContext(r.Context()).Errorf("[GetPlan] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writePlan(w, r, db, userID, now)
+	}
+}
+
+// RebuildPlan handles POST /api/planner/plan, which plans the timetable again from
+// now, for example after the student's mastery has changed.
+func RebuildPlan(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		now := time.Now()
+		if err := Replan(r.Context(), db, userID, now); err != nil {
+			logging.FromContext(r.Context()).Errorf("[RebuildPlan] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writePlan(w, r, db, userID, now)
+	}
+}
+
+// UpdateSession handles PATCH /api/planner/sessions/{id}. Marking a session missed
+// plans the rest of the timetable again.
+func UpdateSession(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req SessionRequest
+		if err := validate.DecodeJSON(w, r, 1<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		now := time.Now()
+		err = setSessionStatus(r.Context(), db, userID, r.PathValue("id"), req.Status, now.Unix())
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Session not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if req.Status == StatusMissed {
+			replan(r, db, userID, now)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ExportCalendar handles GET /api/planner/plan.ics, the exams and sessions from the
+// last 30 days on as an iCalendar file.
+func ExportCalendar(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		now := time.Now()
+		if err := Sync(r.Context(), db, userID, now); err != nil {
+			logging.FromContext(r.Context()).Errorf("[ExportCalendar] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		exams, err := listExams(r.Context(), db, userID, false, 0)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ExportCalendar] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		sessions, err := listSessions(r.Context(), db, userID, now.AddDate(0, 0, -30).Unix(), now.Add(horizon).Unix())
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ExportCalendar] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="revision-timetable.ics"`)
+		if err := writeCalendar(w, exams, sessions, now); err != nil {
+			logging.FromContext(r.Context()).Errorf("[ExportCalendar] %v", err)
+		}
+	}
+}
+
+// today returns the bounds of the day containing now in the student's timezone.
+func today(av *Availability, now time.Time) (int64, int64) {
+	loc, err := time.LoadLocation(av.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	n := now.In(loc)
+	start := time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, loc)
+	return start.Unix(), start.AddDate(0, 0, 1).Unix()
+}
+
+// writePlan writes the plan for the range asked for in the query.
+func writePlan(w http.ResponseWriter, r *http.Request, db *sql.DB, userID string, now time.Time) {
+	av, err := getAvailability(r.Context(), db, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Errorf("[writePlan] %v", err)
+		problem.Write(w, r, problem.Internal())
+		return
+	}
+	if av == nil {
+		av = &defaultAvailability
+	}
+	from, _ := today(av, now)
+	to := from + 14*24*60*60
+	var errs []problem.FieldError
+	for _, bound := range []struct {
+		param string
+		dst   *int64
+	}{{"from", &from}, {"to", &to}} {
+		if v := r.URL.Query().Get(bound.param); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, problem.FieldError{Field: bound.param, Code: "invalid", Message: "must be a Unix time in seconds"})
+				continue
+			}
+			*bound.dst = n
+		}
+	}
+	if len(errs) == 0 && (to <= from || to-from > maxRange) {
+		errs = append(errs, problem.FieldError{Field: "to", Code: "out_of_range", Message: "must be after from, and at most a year later"})
+	}
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+	exams, err := listExams(r.Context(), db, userID, false, 0)
+	if err != nil {
+		logging.FromContext(r.Context()).Errorf("[writePlan] %v", err)
+		problem.Write(w, r, problem.Internal())
+		return
+	}
+	sessions, err := listSessions(r.Context(), db, userID, from, to)
+	if err != nil {
+		logging.FromContext(r.Context()).Errorf("[writePlan] %v", err)
+		problem.Write(w, r, problem.Internal())
+		return
+	}
+	writeJSON(w, http.StatusOK, &Plan{Timezone: av.Timezone, Exams: exams, Sessions: sessions})
+}
+
+// replan plans the timetable again after its inputs change. The change itself has
+// been saved, so a failure is only logged; the plan is rebuilt on the next change.
+func replan(r *http.Request, db *sql.DB, userID string, now time.Time) {
+	if err := Replan(r.Context(), db, userID, now); err != nil {
+		logging.FromContext(r.Context()).Errorf("[planner.replan] %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
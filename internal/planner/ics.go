@@ -0,0 +1,88 @@
+package planner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// icsTime is the iCalendar form of a UTC time.
+const icsTime = "20060102T150405Z"
+
+// writeCalendar writes the exams and sessions as an iCalendar (RFC 5545) file that
+// calendar apps can import. Times are in UTC, so no timezone definitions are needed.
+func writeCalendar(w io.Writer, exams []*Exam, sessions []*Session, now time.Time) error {
+	stamp := now.UTC().Format(icsTime)
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//KdnSite//Revision planner//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Revision timetable",
+	}
+	event := func(uid string, start time.Time, length time.Duration, summary, description, status string) {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+uid+"@kdnsite",
+			"DTSTAMP:"+stamp,
+			"DTSTART:"+start.UTC().Format(icsTime),
+			"DTEND:"+start.Add(length).UTC().Format(icsTime),
+			"SUMMARY:"+escapeText(summary),
+		)
+		if description != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeText(description))
+		}
+		if status != "" {
+			lines = append(lines, "STATUS:"+status)
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	for _, e := range exams {
+		// An exam's length is not known, so it is shown as two hours
+		event("exam-"+e.ID, time.Unix(e.StartsAt, 0), 2*time.Hour, "Exam: "+e.Title, "", "")
+	}
+	for _, s := range sessions {
+		status := "CONFIRMED"
+		if s.Status == StatusSkipped || s.Status == StatusMissed {
+			status = "CANCELLED"
+		}
+		event("session-"+s.ID, time.Unix(s.StartsAt, 0), time.Duration(s.Minutes)*time.Minute,
+			"Revise "+s.AreaTitle, "For "+s.ExamTitle, status)
+	}
+	lines = append(lines, "END:VCALENDAR")
+	for _, line := range lines {
+		if _, err := io.WriteString(w, fold(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeText escapes a TEXT value.
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// fold breaks a content line into lines of at most 75 octets, each continuation
+// starting with a space, without splitting a UTF-8 character.
+func fold(line string) string {
+	if len(line) <= 75 {
+		return line
+	}
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		fmt.Fprintf(&b, "%s\r\n ", line[:cut])
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards their length
+		limit = 74
+	}
+	b.WriteString(line)
+	return b.String()
+}
@@ -0,0 +1,208 @@
+// Package planner builds a student's revision timetable. The student enters their exams
+// and when they can study each week; the planner fills those hours with sessions up to
+// each exam, giving more time to the exams that are soonest and to the topics the
+// student knows least well, as scored by the mastery package.
+//
+// Sessions that pass without being marked done are recorded as missed, and the rest of
+// the timetable is planned again around them.
+package planner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// Timezones resolve even where the system has no zoneinfo
+	_ "time/tzdata"
+
+	"KdnSite/internal/problem"
+)
+
+// Session statuses.
+const (
+	StatusPlanned = "planned"
+	StatusDone    = "done"
+	StatusMissed  = "missed"
+	StatusSkipped = "skipped"
+)
+
+const (
+	// MaxTopics bounds the topics of an exam without a spec.
+	MaxTopics = 20
+	// MaxSlots bounds the weekly availability windows.
+	MaxSlots = 50
+	// horizon bounds how far ahead sessions are planned.
+	horizon = 180 * 24 * time.Hour
+	// maxSessions bounds how many sessions one plan may hold.
+	maxSessions = 1000
+)
+
+// Exam is an exam the student is preparing for. Its topics come from its spec, or from
+// Topics when it has none.
+type Exam struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	SpecID    string   `json:"spec_id,omitempty"`
+	Topics    []string `json:"topics"`
+	StartsAt  int64    `json:"starts_at"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// ExamRequest is the body of POST /api/planner/exams.
+type ExamRequest struct {
+	Title    string   `json:"title" validate:"required,max=200"`
+	SpecID   string   `json:"spec_id" validate:"max=100"`
+	Topics   []string `json:"topics"`
+	StartsAt int64    `json:"starts_at" validate:"required"`
+}
+
+// Validate checks that the exam is in the future and has a spec or topics, and
+// normalises Topics.
+func (req *ExamRequest) Validate(now time.Time) []problem.FieldError {
+	var errs []problem.FieldError
+	req.Topics, errs = normalizeTopics(req.Topics)
+	if req.SpecID == "" && len(req.Topics) == 0 {
+		errs = append(errs, problem.FieldError{Field: "topics", Code: "required", Message: "is required when there is no spec_id"})
+	}
+	if req.StartsAt <= now.Unix() {
+		errs = append(errs, problem.FieldError{Field: "starts_at", Code: "in_past", Message: "must be in the future"})
+	}
+	return errs
+}
+
+// UpdateExamRequest is the body of PATCH /api/planner/exams/{id}. Only the fields sent
+// are changed; an empty spec_id removes the spec.
+type UpdateExamRequest struct {
+	Title    *string   `json:"title" validate:"max=200"`
+	SpecID   *string   `json:"spec_id" validate:"max=100"`
+	Topics   *[]string `json:"topics"`
+	StartsAt *int64    `json:"starts_at"`
+}
+
+// Apply validates the request against the exam and changes it.
+func (req *UpdateExamRequest) Apply(e *Exam, now time.Time) []problem.FieldError {
+	var errs []problem.FieldError
+	if req.Title != nil {
+		if strings.TrimSpace(*req.Title) == "" {
+			errs = append(errs, problem.FieldError{Field: "title", Code: "required", Message: "is required"})
+		}
+		e.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.SpecID != nil {
+		e.SpecID = strings.TrimSpace(*req.SpecID)
+	}
+	if req.Topics != nil {
+		var topicErrs []problem.FieldError
+		e.Topics, topicErrs = normalizeTopics(*req.Topics)
+		errs = append(errs, topicErrs...)
+	}
+	if req.StartsAt != nil {
+		if *req.StartsAt <= now.Unix() {
+			errs = append(errs, problem.FieldError{Field: "starts_at", Code: "in_past", Message: "must be in the future"})
+		}
+		e.StartsAt = *req.StartsAt
+	}
+	if e.SpecID == "" && len(e.Topics) == 0 {
+		errs = append(errs, problem.FieldError{Field: "topics", Code: "required", Message: "is required when there is no spec_id"})
+	}
+	return errs
+}
+
+// normalizeTopics trims topics and drops blanks and duplicates.
+func normalizeTopics(topics []string) ([]string, []problem.FieldError) {
+	out := []string{}
+	seen := map[string]bool{}
+	var errs []problem.FieldError
+	for i, t := range topics {
+		t = strings.TrimSpace(t)
+		if len([]rune(t)) > 100 {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("topics[%d]", i), Code: "too_long", Message: "must be at most 100 characters"})
+		}
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		out = append(out, t)
+	}
+	if len(out) > MaxTopics {
+		errs = append(errs, problem.FieldError{Field: "topics", Code: "too_long", Message: fmt.Sprintf("must be at most %d items", MaxTopics)})
+	}
+	return out, errs
+}
+
+// Availability is when the student can study each week, and how long each session is.
+type Availability struct {
+	Timezone       string `json:"timezone" validate:"required,max=64"`
+	SessionMinutes int    `json:"session_minutes" validate:"required,min=15,max=180"`
+	Slots          []Slot `json:"slots"`
+}
+
+// Slot is a weekly window for study: Start is a time of day, "HH:MM", on Weekday
+// (0 is Sunday) in the student's timezone.
+type Slot struct {
+	Weekday int    `json:"weekday"`
+	Start   string `json:"start"`
+	Minutes int    `json:"minutes"`
+}
+
+// Validate checks the timezone and each slot.
+func (a *Availability) Validate() []problem.FieldError {
+	var errs []problem.FieldError
+	if _, err := time.LoadLocation(a.Timezone); err != nil || a.Timezone == "Local" {
+		errs = append(errs, problem.FieldError{Field: "timezone", Code: "invalid_timezone", Message: "must be an IANA timezone such as Europe/London"})
+	}
+	if len(a.Slots) > MaxSlots {
+		errs = append(errs, problem.FieldError{Field: "slots", Code: "too_long", Message: fmt.Sprintf("must be at most %d items", MaxSlots)})
+	}
+	if a.Slots == nil {
+		a.Slots = []Slot{}
+	}
+	for i, s := range a.Slots {
+		field := fmt.Sprintf("slots[%d]", i)
+		if s.Weekday < 0 || s.Weekday > 6 {
+			errs = append(errs, problem.FieldError{Field: field + ".weekday", Code: "out_of_range", Message: "must be from 0 (Sunday) to 6 (Saturday)"})
+		}
+		start, ok := s.startMinute()
+		if !ok {
+			errs = append(errs, problem.FieldError{Field: field + ".start", Code: "invalid_time", Message: "must be a time of day such as 17:30"})
+			continue
+		}
+		if s.Minutes < 15 || start+s.Minutes > 24*60 {
+			errs = append(errs, problem.FieldError{Field: field + ".minutes", Code: "out_of_range", Message: "must be at least 15 and end by midnight"})
+		}
+	}
+	return errs
+}
+
+// startMinute returns Start as minutes after midnight.
+func (s Slot) startMinute() (int, bool) {
+	t, err := time.Parse("15:04", s.Start)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// Session is one planned study session on an area of an exam.
+type Session struct {
+	ID        string `json:"id"`
+	ExamID    string `json:"exam_id"`
+	ExamTitle string `json:"exam_title"`
+	AreaID    string `json:"area_id"`
+	AreaTitle string `json:"area_title"`
+	StartsAt  int64  `json:"starts_at"`
+	Minutes   int    `json:"minutes"`
+	Status    string `json:"status"`
+}
+
+// SessionRequest is the body of PATCH /api/planner/sessions/{id}.
+type SessionRequest struct {
+	Status string `json:"status" validate:"required,oneof=planned done missed skipped"`
+}
+
+// Plan is the body of GET /api/planner/plan.
+type Plan struct {
+	Timezone string     `json:"timezone"`
+	Exams    []*Exam    `json:"exams"`
+	Sessions []*Session `json:"sessions"`
+}
@@ -0,0 +1,163 @@
+package planner
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"KdnSite/internal/mastery"
+	"KdnSite/internal/specs"
+)
+
+const (
+	// minNeed keeps secure areas in the plan, so they are still revised now and then.
+	minNeed = 0.1
+	// missedBoost raises the need of an area whose session was recently missed.
+	missedBoost = 1.5
+	// urgencyDays is how many days away an exam is when it counts half as much as one
+	// tomorrow.
+	urgencyDays = 7
+)
+
+// target is an exam to plan for, with the areas it covers.
+type target struct {
+	exam  *Exam
+	areas []area
+}
+
+// area is a spec point or topic of an exam and how much it needs revising, from
+// minNeed for a secure area to 1 for one never studied.
+type area struct {
+	id, title string
+	need      float64
+}
+
+// need returns how much an area scored score by mastery needs revising.
+func need(score int) float64 {
+	return math.Max(minNeed, 1-float64(score)/100)
+}
+
+// buildTarget lists the areas of an exam. A spec's areas are its subtopics (or a topic
+// without any), each scored by its own mastery or else its topic's; missed are areas
+// with recently missed sessions.
+func buildTarget(e *Exam, spec *specs.Spec, scores map[string]int, missed map[string]bool) target {
+	t := target{exam: e}
+	add := func(id, title string, score int, known bool) {
+		a := area{id: id, title: title, need: 1}
+		if known {
+			a.need = need(score)
+		}
+		if missed[id] {
+			a.need = math.Min(1, a.need*missedBoost)
+		}
+		t.areas = append(t.areas, a)
+	}
+	if spec != nil {
+		for _, topic := range spec.Topics {
+			topicScore, topicKnown := scores[topic.ID]
+			if len(topic.Subtopics) == 0 {
+				add(topic.ID, topic.Title, topicScore, topicKnown)
+				continue
+			}
+			for _, sub := range topic.Subtopics {
+				if score, ok := scores[sub.ID]; ok {
+					add(sub.ID, sub.Title, score, true)
+				} else {
+					add(sub.ID, sub.Title, topicScore, topicKnown)
+				}
+			}
+		}
+		return t
+	}
+	for _, name := range e.Topics {
+		id := mastery.TopicID(name)
+		score, known := scores[id]
+		add(id, name, score, known)
+	}
+	return t
+}
+
+// sessionStarts returns the start of every session of the given length that fits in
+// the weekly slots between from and to, in order.
+func sessionStarts(av *Availability, loc *time.Location, from, to time.Time, length time.Duration) []time.Time {
+	var starts []time.Time
+	f := from.In(loc)
+	for day := time.Date(f.Year(), f.Month(), f.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, s := range av.Slots {
+			if time.Weekday(s.Weekday) != day.Weekday() {
+				continue
+			}
+			minute, _ := s.startMinute()
+			start := time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, loc)
+			end := start.Add(time.Duration(s.Minutes) * time.Minute)
+			for t := start; !t.Add(length).After(end); t = t.Add(length) {
+				if !t.Before(from) && t.Before(to) {
+					starts = append(starts, t)
+				}
+			}
+		}
+	}
+	slices.SortFunc(starts, func(a, b time.Time) int { return a.Compare(b) })
+	return slices.CompactFunc(starts, func(a, b time.Time) bool { return a.Equal(b) })
+}
+
+// allocate fills each start with a session on the area that most needs it then. An
+// area's claim is its need, weighted towards exams that are soon, and shared out over
+// the sessions it already has so every area gets time; an area already revised that
+// day counts for less, so each day covers a spread of topics. A session must end
+// before its exam starts.
+func allocate(starts []time.Time, targets []target, minutes int, loc *time.Location) []*Session {
+	length := time.Duration(minutes) * time.Minute
+	count := map[string]int{}
+	lastDay := map[string]string{}
+	var sessions []*Session
+	for _, start := range starts {
+		if len(sessions) >= maxSessions {
+			break
+		}
+		day := start.In(loc).Format(time.DateOnly)
+		var (
+			best      *target
+			bestArea  area
+			bestClaim float64
+		)
+		for i := range targets {
+			t := &targets[i]
+			examAt := time.Unix(t.exam.StartsAt, 0)
+			if start.Add(length).After(examAt) {
+				continue
+			}
+			days := examAt.Sub(start).Hours() / 24
+			urgency := 1 / (1 + days/urgencyDays)
+			for _, a := range t.areas {
+				key := t.exam.ID + "\x00" + a.id
+				claim := a.need * urgency / float64(1+count[key])
+				if lastDay[key] == day {
+					claim /= 4
+				}
+				if claim > bestClaim {
+					best, bestArea, bestClaim = t, a, claim
+				}
+			}
+		}
+		if best == nil {
+			continue
+		}
+		key := best.exam.ID + "\x00" + bestArea.id
+		count[key]++
+		lastDay[key] = day
+		sessions = append(sessions, &Session{
+			ID:        uuid.NewString(),
+			ExamID:    best.exam.ID,
+			ExamTitle: best.exam.Title,
+			AreaID:    bestArea.id,
+			AreaTitle: bestArea.title,
+			StartsAt:  start.Unix(),
+			Minutes:   minutes,
+			Status:    StatusPlanned,
+		})
+	}
+	return sessions
+}
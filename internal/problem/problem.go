@@ -0,0 +1,164 @@
+// Package problem writes API errors as RFC 7807 application/problem+json documents.
+// Every problem carries a stable machine-readable code and the request ID; browsers
+// navigating to a page get the HTML error page instead.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"KdnSite/internal/logging"
+)
+
+// ContentType is the media type of problem documents.
+const ContentType = "application/problem+json"
+
+// Codes identify each kind of problem. Clients should branch on these, never on Detail.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeCSRF             = "csrf_token_invalid"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeValidation       = "validation_failed"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeUpstream         = "upstream_error"
+)
+
+// FieldError describes one invalid field in a request body or query string.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem detail. It implements error so domain code can
+// return one and let the handler pass it to Write unchanged.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Code + ": " + p.Detail
+	}
+	return p.Code
+}
+
+// New builds a problem. Its type is the code under /problems/ so it is stable and unique.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + strings.ReplaceAll(code, "_", "-"),
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+func BadRequest(detail string) *Problem { return New(http.StatusBadRequest, CodeBadRequest, detail) }
+
+func Unauthorized() *Problem {
+	return New(http.StatusUnauthorized, CodeUnauthorized, "You need to log in to do that.")
+}
+
+func Forbidden(detail string) *Problem { return New(http.StatusForbidden, CodeForbidden, detail) }
+
+func NotFound(detail string) *Problem { return New(http.StatusNotFound, CodeNotFound, detail) }
+
+func MethodNotAllowed() *Problem {
+	return New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "")
+}
+
+func Conflict(detail string) *Problem { return New(http.StatusConflict, CodeConflict, detail) }
+
+func PayloadTooLarge(detail string) *Problem {
+	return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, detail)
+}
+
+// Validation reports invalid fields with 422 Unprocessable Entity.
+func Validation(errs ...FieldError) *Problem {
+	p := New(http.StatusUnprocessableEntity, CodeValidation, "The request contains invalid fields.")
+	p.Errors = errs
+	return p
+}
+
+func RateLimited() *Problem {
+	return New(http.StatusTooManyRequests, CodeRateLimited, "Too many requests. Please wait and try again.")
+}
+
+// Internal hides the cause from the client; log it before responding.
+func Internal() *Problem {
+	return New(http.StatusInternalServerError, CodeInternal, "Something went wrong on our end.")
+}
+
+// Upstream reports that a dependency such as Auth0 failed.
+func Upstream(detail string) *Problem { return New(http.StatusBadGateway, CodeUpstream, detail) }
+
+// htmlRenderer draws the HTML error page. It is injected by main because the templ
+// pages import packages that themselves write problems.
+var htmlRenderer func(w http.ResponseWriter, r *http.Request, p *Problem)
+
+// SetHTMLRenderer sets how problems are shown to browsers.
+func SetHTMLRenderer(fn func(w http.ResponseWriter, r *http.Request, p *Problem)) {
+	htmlRenderer = fn
+}
+
+// Write sends p as problem+json, or as the HTML error page when the client asked for HTML.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if htmlRenderer != nil && WantsHTML(r) {
+		htmlRenderer(w, r, p)
+		return
+	}
+	out := *p
+	out.Instance = r.URL.Path
+	out.RequestID = logging.RequestID(r.Context())
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(&out)
+}
+
+// Error writes err if it is (or wraps) a *Problem, and otherwise logs it and writes a 500.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Problem
+	if errors.As(err, &p) {
+		Write(w, r, p)
+		return
+	}
+	logging.FromContext(r.Context()).Errorf("[problem.Error] %v", err)
+	Write(w, r, Internal())
+}
+
+// WantsHTML reports whether the client prefers an HTML page to JSON, as browsers
+// do when navigating. fetch() and API clients send */* or application/json.
+func WantsHTML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			return true
+		case "application/json", ContentType:
+			return false
+		}
+	}
+	return false
+}
@@ -4,24 +4,46 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
 	"KdnSite/internal/auth"
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
 
 	"github.com/google/uuid"
 )
 
+// listSpec is what GET /api/projects can sort and filter by.
+var listSpec = pagination.Spec{
+	IDColumn: "id",
+	Sorts: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Numeric: true},
+		"updated_at": {Column: "updated_at", Numeric: true},
+		"title":      {Column: "title"},
+	},
+	DefaultSort: "-updated_at",
+	DateColumn:  "created_at",
+}
+
 // ListProjects handles GET /api/projects
 func ListProjects(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
-		rows, err := db.QueryContext(r.Context(), `SELECT id, owner_id, title, created_at, updated_at, data FROM projects WHERE owner_id=$1`, userID)
+		q, err := pagination.Parse(r, listSpec)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Error(w, r, err)
+			return
+		}
+		query, args := q.SQL(`SELECT id, owner_id, title, created_at, updated_at, data FROM projects WHERE owner_id=$1`, userID)
+		rows, err := db.QueryContext(r.Context(), query, args...)
+		if err != nil {
+			problem.Write(w, r, problem.Internal())
 			return
 		}
 		defer rows.Close()
@@ -29,13 +51,12 @@ func ListProjects(db *sql.DB) http.HandlerFunc {
 		for rows.Next() {
 			var p Project
 			if err := rows.Scan(&p.ID, &p.OwnerID, &p.Title, &p.CreatedAt, &p.UpdatedAt, &p.Data); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				problem.Write(w, r, problem.Internal())
 				return
 			}
 			projects = append(projects, &p)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(projects)
+		pagination.Write(w, pagination.NewPage(q, projects, (*Project).cursor))
 	}
 }
 
@@ -44,23 +65,27 @@ func CreateProject(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
-		var p Project
-		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		var req CreateProjectRequest
+		if err := validate.DecodeJSON(w, r, MaxProjectBodyBytes, &req); err != nil {
+			problem.Error(w, r, err)
 			return
 		}
-		p.ID = uuid.NewString()
-		p.OwnerID = userID
 		t := time.Now().Unix()
-		p.CreatedAt = t
-		p.UpdatedAt = t
+		p := Project{
+			ID:        uuid.NewString(),
+			OwnerID:   userID,
+			Title:     strings.TrimSpace(req.Title),
+			CreatedAt: t,
+			UpdatedAt: t,
+			Data:      req.Data,
+		}
 		_, err = db.ExecContext(r.Context(), `INSERT INTO projects (id, owner_id, title, created_at, updated_at, data) VALUES ($1, $2, $3, $4, $5, $6)`,
 			p.ID, p.OwnerID, p.Title, p.CreatedAt, p.UpdatedAt, p.Data)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Write(w, r, problem.Internal())
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
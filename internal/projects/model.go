@@ -1,5 +1,7 @@
 package projects
 
+import "strconv"
+
 // Project represents a user-created project (visual program, etc.)
 type Project struct {
 	ID        string
@@ -9,3 +11,24 @@ type Project struct {
 	UpdatedAt int64
 	Data      string // JSON or other serialized format
 }
+
+// cursor returns the project's value for a list sort key, and its ID.
+func (p *Project) cursor(sortKey string) (string, string) {
+	switch sortKey {
+	case "title":
+		return p.Title, p.ID
+	case "created_at":
+		return strconv.FormatInt(p.CreatedAt, 10), p.ID
+	default:
+		return strconv.FormatInt(p.UpdatedAt, 10), p.ID
+	}
+}
+
+// MaxProjectBodyBytes caps the size of a create request, including the project data.
+const MaxProjectBodyBytes = 1 << 20
+
+// CreateProjectRequest is the body of POST /api/projects.
+type CreateProjectRequest struct {
+	Title string `json:"title" validate:"required,max=200"`
+	Data  string `json:"data" validate:"required,json"`
+}
@@ -1,29 +1,51 @@
 package quiz
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
+
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/specs"
 )
 
-func GetAllQuizzes(db *sql.DB) ([]Quiz, []int, error) {
-	rows, err := db.Query(`SELECT id, title, description, topic FROM quizzes`)
+// GetQuizzes returns one page of quizzes with their question counts.
+func GetQuizzes(ctx context.Context, db *sql.DB, q *pagination.Query) ([]*QuizSummary, error) {
+	query, args := q.SQL(`SELECT id, title, description, topic, created_at,
+		(SELECT COUNT(*) FROM questions WHERE questions.quiz_id = quizzes.id)
+		FROM quizzes WHERE TRUE`)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer rows.Close()
-	var quizzes []Quiz
-	var counts []int
+	var quizzes []*QuizSummary
 	for rows.Next() {
-		var q Quiz
-		if err := rows.Scan(&q.ID, &q.Title, &q.Description, &q.Topic); err != nil {
-			return nil, nil, err
+		var s QuizSummary
+		if err := rows.Scan(&s.ID, &s.Title, &s.Description, &s.Topic, &s.CreatedAt, &s.QuestionCount); err != nil {
+			return nil, err
 		}
-		var count int
-		_ = db.QueryRow(`SELECT COUNT(*) FROM questions WHERE quiz_id = $1`, q.ID).Scan(&count)
-		quizzes = append(quizzes, q)
-		counts = append(counts, count)
+		quizzes = append(quizzes, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(quizzes))
+	for i, s := range quizzes {
+		ids[i] = s.ID
 	}
-	return quizzes, counts, nil
+	points, err := specs.Load(ctx, db, specs.Quizzes, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range quizzes {
+		s.SpecPoints = points[s.ID]
+		if s.SpecPoints == nil {
+			s.SpecPoints = []string{}
+		}
+	}
+	return quizzes, nil
 }
 
 func GetQuizByID(db *sql.DB, quizID string) (*Quiz, []Question, error) {
@@ -46,12 +68,60 @@ func GetQuizByID(db *sql.DB, quizID string) (*Quiz, []Question, error) {
 		_ = json.Unmarshal([]byte(optionsJSON), &ques.Options)
 		questions = append(questions, ques)
 	}
+	if err := loadSpecPoints(db, &q, questions); err != nil {
+		return &q, nil, err
+	}
 	return &q, questions, nil
 }
 
-func SaveQuizAttempt(db *sql.DB, attempt UserQuizAttempt) error {
+// loadSpecPoints fills in the spec points of a quiz and its questions.
+func loadSpecPoints(db *sql.DB, q *Quiz, questions []Question) error {
+	ctx := context.Background()
+	points, err := specs.Load(ctx, db, specs.Quizzes, []string{q.ID})
+	if err != nil {
+		return err
+	}
+	q.SpecPoints = points[q.ID]
+	if q.SpecPoints == nil {
+		q.SpecPoints = []string{}
+	}
+	ids := make([]string, len(questions))
+	for i, ques := range questions {
+		ids[i] = ques.ID
+	}
+	if points, err = specs.Load(ctx, db, specs.Questions, ids); err != nil {
+		return err
+	}
+	for i := range questions {
+		questions[i].SpecPoints = points[questions[i].ID]
+		if questions[i].SpecPoints == nil {
+			questions[i].SpecPoints = []string{}
+		}
+	}
+	return nil
+}
+
+// SaveQuizAttempt stores an attempt and whether each question in it was answered
+// correctly, which mastery scores are worked out from.
+func SaveQuizAttempt(ctx context.Context, db *sql.DB, attempt UserQuizAttempt, results []QuestionResult) error {
 	answersJSON, _ := json.Marshal(attempt.Answers)
-	_, err := db.Exec(`INSERT INTO user_quiz_attempts (id, user_id, quiz_id, answers, score, timestamp) VALUES ($1, $2, $3, $4, $5, NOW())`,
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_quiz_attempts (id, user_id, quiz_id, answers, score, timestamp) VALUES ($1, $2, $3, $4, $5, NOW())`,
 		attempt.ID, attempt.UserID, attempt.QuizID, string(answersJSON), attempt.Score)
-	return err
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, res := range results {
+		_, err := tx.ExecContext(ctx, `INSERT INTO question_attempts (attempt_id, question_id, user_id, quiz_id, correct, answered_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+			attempt.ID, res.QuestionID, attempt.UserID, attempt.QuizID, res.Correct, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
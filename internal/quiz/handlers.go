@@ -6,28 +6,41 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/validate"
 )
 
+// listSpec is what GET /api/quizzes can sort and filter by.
+var listSpec = pagination.Spec{
+	IDColumn: "id",
+	Sorts: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Numeric: true},
+		"title":      {Column: "title"},
+	},
+	DefaultSort: "title",
+	Filters:     map[string]string{"topic": "topic"},
+	Conditions:  map[string]string{"spec_point": specs.Quizzes.Filter()},
+	DateColumn:  "created_at",
+}
+
 // List all quizzes
 func ListQuizzes(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		quizzes, counts, err := GetAllQuizzes(db)
+		q, err := pagination.Parse(r, listSpec)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Error(w, r, err)
 			return
 		}
-		var resp []map[string]interface{}
-		for i, q := range quizzes {
-			resp = append(resp, map[string]interface{}{
-				"id":             q.ID,
-				"title":          q.Title,
-				"description":    q.Description,
-				"topic":          q.Topic,
-				"question_count": counts[i],
-			})
+		quizzes, err := GetQuizzes(r.Context(), db, q)
+		if err != nil {
+			problem.Write(w, r, problem.Internal())
+			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		pagination.Write(w, pagination.NewPage(q, quizzes, (*QuizSummary).cursor))
 	}
 }
 
@@ -36,12 +49,12 @@ func GetQuiz(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		quizID := r.URL.Query().Get("id")
 		if quizID == "" {
-			w.WriteHeader(http.StatusBadRequest)
+			problem.Write(w, r, problem.BadRequest(""))
 			return
 		}
 		quiz, questions, err := GetQuizByID(db, quizID)
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
+			problem.Write(w, r, problem.NotFound(""))
 			return
 		}
 		resp := map[string]interface{}{
@@ -49,6 +62,7 @@ func GetQuiz(db *sql.DB) http.HandlerFunc {
 			"title":       quiz.Title,
 			"description": quiz.Description,
 			"topic":       quiz.Topic,
+			"spec_points": quiz.SpecPoints,
 			"questions":   questions,
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -62,33 +76,39 @@ func SubmitQuizAttempt(db *sql.DB) http.HandlerFunc {
 		userIDRaw := r.Context().Value("user_id")
 		userID, ok := userIDRaw.(string)
 		if !ok || userID == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
 		var req struct {
-			QuizID  string `json:"quiz_id"`
-			Answers []int  `json:"answers"`
+			QuizID  string `json:"quiz_id" validate:"required,max=64"`
+			Answers []int  `json:"answers" validate:"max=500"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		if err := validate.DecodeJSON(w, r, 64<<10, &req); err != nil {
+			problem.Error(w, r, err)
 			return
 		}
 		_, questions, err := GetQuizByID(db, req.QuizID)
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
+			problem.Write(w, r, problem.NotFound(""))
 			return
 		}
 		score := 0
 		results := make([]map[string]interface{}, len(questions))
+		marked := make([]QuestionResult, len(questions))
 		for i, q := range questions {
-			correct := i < len(req.Answers) && req.Answers[i] == q.Answer
+			userAnswer := -1
+			if i < len(req.Answers) {
+				userAnswer = req.Answers[i]
+			}
+			correct := userAnswer == q.Answer
 			if correct {
 				score++
 			}
+			marked[i] = QuestionResult{QuestionID: q.ID, Correct: correct}
 			results[i] = map[string]interface{}{
 				"question_id":    q.ID,
 				"correct":        correct,
-				"user_answer":    req.Answers[i],
+				"user_answer":    userAnswer,
 				"correct_answer": q.Answer,
 				"explanation":    q.Explanation,
 			}
@@ -101,7 +121,11 @@ func SubmitQuizAttempt(db *sql.DB) http.HandlerFunc {
 			Score:     score,
 			Timestamp: "",
 		}
-		_ = SaveQuizAttempt(db, attempt)
+		if err := SaveQuizAttempt(r.Context(), db, attempt, marked); err != nil {
+			log.Errorf("[SubmitQuizAttempt] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
 		resp := map[string]interface{}{
 			"score":   score,
 			"total":   len(questions),
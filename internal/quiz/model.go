@@ -1,13 +1,35 @@
 package quiz
 
+import "strconv"
+
 type Quiz struct {
 	ID          string     `json:"id"`
 	Title       string     `json:"title"`
 	Description string     `json:"description"`
 	Topic       string     `json:"topic"`
+	SpecPoints  []string   `json:"spec_points"`
 	Questions   []Question `json:"questions"`
 }
 
+// QuizSummary is a quiz as it appears in GET /api/quizzes, without its questions.
+type QuizSummary struct {
+	ID            string   `json:"id"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Topic         string   `json:"topic"`
+	SpecPoints    []string `json:"spec_points"`
+	CreatedAt     int64    `json:"created_at"`
+	QuestionCount int      `json:"question_count"`
+}
+
+// cursor returns the quiz's value for a list sort key, and its ID.
+func (s *QuizSummary) cursor(sortKey string) (string, string) {
+	if sortKey == "created_at" {
+		return strconv.FormatInt(s.CreatedAt, 10), s.ID
+	}
+	return s.Title, s.ID
+}
+
 type Question struct {
 	ID          string   `json:"id"`
 	QuizID      string   `json:"quiz_id"`
@@ -16,6 +38,7 @@ type Question struct {
 	Answer      int      `json:"answer"` // index of correct option
 	Explanation string   `json:"explanation"`
 	Difficulty  string   `json:"difficulty"`
+	SpecPoints  []string `json:"spec_points"`
 }
 
 type UserQuizAttempt struct {
@@ -26,3 +49,9 @@ type UserQuizAttempt struct {
 	Score     int    `json:"score"`
 	Timestamp string `json:"timestamp"`
 }
+
+// QuestionResult records whether one question of an attempt was answered correctly.
+type QuestionResult struct {
+	QuestionID string
+	Correct    bool
+}
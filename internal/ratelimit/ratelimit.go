@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/config"
+	"KdnSite/internal/metrics"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/session"
+	"KdnSite/internal/utils"
+)
+
+// idleTTL is how long an untouched bucket is kept before it is swept.
+const idleTTL = 30 * time.Minute
+
+// stats is published at /debug/vars as {"ratelimit": {"<rule>.allowed": n, "<rule>.limited": n}},
+// and the same counts on /metrics as ratelimit_requests_total.
+var stats = expvar.NewMap("ratelimit")
+
+// KeyFunc picks the bucket a request is charged to.
+type KeyFunc func(r *http.Request) string
+
+// Rule configures a token bucket: Burst requests at once, refilled with one token every Every.
+type Rule struct {
+	Name  string
+	Burst int
+	Every time.Duration
+	Key   KeyFunc
+}
+
+// Limiter enforces a Rule with one token bucket per key.
+type Limiter struct {
+	rule      Rule
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// New returns a limiter for the rule, with its burst and interval taken from
+// limits[rule.Name] if set there (RATE_LIMIT_<NAME> in the configuration).
+func New(rule Rule, limits map[string]config.RateLimit) *Limiter {
+	if l, ok := limits[rule.Name]; ok {
+		rule.Burst, rule.Every = l.Burst, l.Every
+	}
+	if rule.Key == nil {
+		rule.Key = ByUserOrIP
+	}
+	return &Limiter{rule: rule, buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+// Middleware rejects requests over the limit with 429 and a Retry-After header.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.rule.Key(r)
+		res := l.get(key).Reserve()
+		if delay := res.Delay(); delay > 0 {
+			res.Cancel()
+			stats.Add(l.rule.Name+".limited", 1)
+			metrics.RateLimited.WithLabelValues(l.rule.Name, "limited").Inc()
+			log.Warnf("[ratelimit] %s limited for %s on %s %s", l.rule.Name, key, r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			problem.Write(w, r, problem.RateLimited())
+			return
+		}
+		stats.Add(l.rule.Name+".allowed", 1)
+		metrics.RateLimited.WithLabelValues(l.rule.Name, "allowed").Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) get(key string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) > idleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Every(l.rule.Every), l.rule.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
+
+// ByIP charges requests to the client IP, honouring TRUSTED_PROXIES.
+func ByIP(r *http.Request) string {
+	return "ip:" + utils.ClientIP(r)
+}
+
+// ByUserOrIP charges authenticated requests to the user and anonymous ones to the client IP.
+func ByUserOrIP(r *http.Request) string {
+	if s, ok := session.FromContext(r.Context()); ok {
+		return "user:" + s.UserID
+	}
+	if token := auth.GetJWTFromRequest(r); token != "" {
+		if claims, err := auth.ValidateAndParseJWT(token); err == nil {
+			if sub, ok := claims["sub"].(string); ok && sub != "" {
+				return "user:" + sub
+			}
+		}
+	}
+	return ByIP(r)
+}
@@ -1 +1,178 @@
 package resources
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+)
+
+const selectResource = `SELECT id, owner_id, type, title, content, visibility, status, created_at, updated_at FROM resources`
+
+// scanResource reads a row selected by selectResource.
+func scanResource(row interface{ Scan(...any) error }) (*Resource, error) {
+	var res Resource
+	if err := row.Scan(&res.ID, &res.OwnerID, &res.Type, &res.Title, &res.Content, &res.Visibility, &res.Status, &res.CreatedAt, &res.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// loadLinks fills in the tags and spec points of each resource.
+func loadLinks(ctx context.Context, q tags.Querier, list []*Resource) error {
+	ids := make([]string, len(list))
+	for i, res := range list {
+		ids[i] = res.ID
+	}
+	byID, err := tags.Load(ctx, q, tags.Resources, ids)
+	if err != nil {
+		return err
+	}
+	points, err := specs.Load(ctx, q, specs.Resources, ids)
+	if err != nil {
+		return err
+	}
+	for _, res := range list {
+		res.Tags = byID[res.ID]
+		if res.Tags == nil {
+			res.Tags = []string{}
+		}
+		res.SpecPoints = points[res.ID]
+		if res.SpecPoints == nil {
+			res.SpecPoints = []string{}
+		}
+	}
+	return nil
+}
+
+// getResource returns one of the user's resources with its tags and spec points, or
+// sql.ErrNoRows.
+func getResource(ctx context.Context, db *sql.DB, ownerID, id string) (*Resource, error) {
+	res, err := scanResource(db.QueryRowContext(ctx, selectResource+` WHERE id=$1 AND owner_id=$2`, id, ownerID))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadLinks(ctx, db, []*Resource{res}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// createResource inserts res with its tags and spec points.
+func createResource(ctx context.Context, db *sql.DB, res *Resource) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO resources (id, owner_id, type, title, content, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		res.ID, res.OwnerID, res.Type, res.Title, res.Content, res.CreatedAt, res.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := tags.Set(ctx, tx, tags.Resources, res.OwnerID, res.ID, res.Tags); err != nil {
+		return err
+	}
+	if err := specs.Set(ctx, tx, specs.Resources, res.ID, res.SpecPoints); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateResource saves res and, if setLinks, its tags and spec points. If edited, a
+// public resource goes back to the library's moderation queue.
+func updateResource(ctx context.Context, db *sql.DB, res *Resource, edited, setLinks bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, `UPDATE resources SET type=$1, title=$2, content=$3, updated_at=$4,
+	status = CASE WHEN $7 AND visibility = 'public' THEN 'pending' ELSE status END
+WHERE id=$5 AND owner_id=$6 RETURNING status`,
+		res.Type, res.Title, res.Content, res.UpdatedAt, res.ID, res.OwnerID, edited).Scan(&res.Status)
+	if err != nil {
+		return err
+	}
+	if setLinks {
+		if err := tags.Set(ctx, tx, tags.Resources, res.OwnerID, res.ID, res.Tags); err != nil {
+			return err
+		}
+		if err := specs.Set(ctx, tx, specs.Resources, res.ID, res.SpecPoints); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// deleteResource deletes one of the user's resources and its tag links. It returns
+// sql.ErrNoRows if there is no such resource.
+func deleteResource(ctx context.Context, db *sql.DB, ownerID, id string) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM resources WHERE id=$1 AND owner_id=$2`, id, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// bulkUpdate applies req to the user's resources in one transaction. If any ID is not
+// one of theirs, nothing is changed and the returned problem lists the missing IDs.
+func bulkUpdate(ctx context.Context, db *sql.DB, ownerID string, req *BulkRequest, now int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var owned pq.StringArray
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(array_agg(id), '{}') FROM resources WHERE owner_id=$1 AND id = ANY($2)`,
+		ownerID, pq.Array(req.IDs)).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if missing := notFound(req.IDs, owned); len(missing) > 0 {
+		return problem.Validation(missing...)
+	}
+	switch req.Action {
+	case "delete":
+		_, err = tx.ExecContext(ctx, `DELETE FROM resources WHERE owner_id=$1 AND id = ANY($2)`, ownerID, pq.Array(req.IDs))
+	case "add_tags":
+		if err = tags.Attach(ctx, tx, tags.Resources, ownerID, req.IDs, req.Tags); err == nil {
+			err = tags.CheckLimit(ctx, tx, tags.Resources, req.IDs)
+		}
+	case "remove_tags":
+		err = tags.Detach(ctx, tx, tags.Resources, ownerID, req.IDs, req.Tags)
+	}
+	if err != nil {
+		return err
+	}
+	if req.Action != "delete" {
+		_, err = tx.ExecContext(ctx, `UPDATE resources SET updated_at=$1 WHERE owner_id=$2 AND id = ANY($3)`, now, ownerID, pq.Array(req.IDs))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// notFound reports each of ids that is not in owned.
+func notFound(ids, owned []string) []problem.FieldError {
+	have := make(map[string]bool, len(owned))
+	for _, id := range owned {
+		have[id] = true
+	}
+	var errs []problem.FieldError
+	for i, id := range ids {
+		if !have[id] {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("ids[%d]", i), Code: "not_found", Message: "is not one of your resources"})
+		}
+	}
+	return errs
+}
@@ -2,39 +2,73 @@ package resources
 
 import (
 	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+	"KdnSite/internal/validate"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// listSpec is what GET /api/resources can sort and filter by.
+var listSpec = pagination.Spec{
+	IDColumn: "id",
+	Sorts: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Numeric: true},
+		"updated_at": {Column: "updated_at", Numeric: true},
+		"title":      {Column: "title"},
+	},
+	DefaultSort: "-created_at",
+	Filters:     map[string]string{"type": "type"},
+	Conditions: map[string]string{
+		"tag":        tags.Resources.Filter(),
+		"spec_point": specs.Resources.Filter(),
+	},
+	DateColumn: "created_at",
+}
+
 // ListResources handles GET /api/resources
 func ListResources(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		q, err := pagination.Parse(r, listSpec)
+		if err != nil {
+			problem.Error(w, r, err)
 			return
 		}
-		rows, err := db.QueryContext(r.Context(), `SELECT id, owner_id, type, title, content, created_at, updated_at FROM resources WHERE owner_id=$1`, userID)
+		query, args := q.SQL(selectResource+` WHERE owner_id=$1`, userID)
+		rows, err := db.QueryContext(r.Context(), query, args...)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Write(w, r, problem.Internal())
 			return
 		}
 		defer rows.Close()
 		var resources []*Resource
 		for rows.Next() {
-			var res Resource
-			if err := rows.Scan(&res.ID, &res.OwnerID, &res.Type, &res.Title, &res.Content, &res.CreatedAt, &res.UpdatedAt); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+			res, err := scanResource(rows)
+			if err != nil {
+				problem.Write(w, r, problem.Internal())
 				return
 			}
-			resources = append(resources, &res)
+			resources = append(resources, res)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resources)
+		if err := loadLinks(r.Context(), db, resources); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		pagination.Write(w, pagination.NewPage(q, resources, (*Resource).cursor))
 	}
 }
 
@@ -43,27 +77,177 @@ func CreateResource(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req CreateResourceRequest
+		if err := validate.DecodeJSON(w, r, MaxResourceBodyBytes, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
 			return
 		}
-		var res Resource
-		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		if err := specs.Check(r.Context(), db, "spec_points", req.SpecPoints); err != nil {
+			problem.Error(w, r, err)
 			return
 		}
-		res.ID = uuid.NewString()
-		res.OwnerID = userID
 		t := time.Now().Unix()
-		res.CreatedAt = t
-		res.UpdatedAt = t
-		_, err = db.ExecContext(r.Context(), `INSERT INTO resources (id, owner_id, type, title, content, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-			res.ID, res.OwnerID, res.Type, res.Title, res.Content, res.CreatedAt, res.UpdatedAt)
+		res := Resource{
+			ID:         uuid.NewString(),
+			OwnerID:    userID,
+			Type:       req.Type,
+			Title:      strings.TrimSpace(req.Title),
+			Content:    req.Content,
+			Tags:       req.Tags,
+			SpecPoints: req.SpecPoints,
+			Visibility: "private",
+			Status:     "approved",
+			CreatedAt:  t,
+			UpdatedAt:  t,
+		}
+		if res.Tags == nil {
+			res.Tags = []string{}
+		}
+		if err := createResource(r.Context(), db, &res); err != nil {
+			logging.FromContext(r.Context()).Errorf("[CreateResource] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeResource(w, http.StatusCreated, &res)
+	}
+}
+
+// GetResource handles GET /api/resources/{id}
+func GetResource(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		res, err := getResource(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Resource not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeResource(w, http.StatusOK, res)
+	}
+}
+
+// UpdateResource handles PATCH /api/resources/{id}
+func UpdateResource(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req UpdateResourceRequest
+		if err := validate.DecodeJSON(w, r, MaxResourceBodyBytes, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		res, err := getResource(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Resource not found"))
+			return
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Error(w, r, err)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(res)
+		if req.Type != nil {
+			res.Type = *req.Type
+		}
+		if req.Title != nil {
+			res.Title = strings.TrimSpace(*req.Title)
+		}
+		if req.Content != nil {
+			res.Content = *req.Content
+		}
+		if req.Tags != nil {
+			res.Tags = *req.Tags
+		}
+		if req.SpecPoints != nil {
+			if err := specs.Check(r.Context(), db, "spec_points", *req.SpecPoints); err != nil {
+				problem.Error(w, r, err)
+				return
+			}
+			res.SpecPoints = *req.SpecPoints
+		}
+		res.UpdatedAt = time.Now().Unix()
+		edited := req.Type != nil || req.Title != nil || req.Content != nil
+		if err := updateResource(r.Context(), db, res, edited, req.Tags != nil || req.SpecPoints != nil); err != nil {
+			logging.FromContext(r.Context()).Errorf("[UpdateResource] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeResource(w, http.StatusOK, res)
 	}
 }
+
+// DeleteResource handles DELETE /api/resources/{id}
+func DeleteResource(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		err = deleteResource(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Resource not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// BulkResources handles POST /api/resources/bulk
+func BulkResources(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req BulkRequest
+		if err := validate.DecodeJSON(w, r, 64<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if err := bulkUpdate(r.Context(), db, userID, &req, time.Now().Unix()); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeResource(w http.ResponseWriter, status int, res *Resource) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
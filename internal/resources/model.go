@@ -1,11 +1,116 @@
 package resources
 
+import (
+	"strconv"
+	"strings"
+
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+)
+
 type Resource struct {
-	ID        string
-	OwnerID   string
-	Type      string // e.g. 'topic', 'flashcard', 'summary', etc.
-	Title     string
-	Content   string
-	CreatedAt int64
-	UpdatedAt int64
+	ID      string
+	OwnerID string
+	Type    string // e.g. 'topic', 'flashcard', 'summary', etc.
+	Title   string
+	Content string
+	Tags    []string
+	// SpecPoints are the IDs of the exam spec points the resource covers.
+	SpecPoints []string
+	// Visibility and Status are where the resource is published in the library and
+	// whether it has passed moderation. They are changed through the library API.
+	Visibility string
+	Status     string
+	CreatedAt  int64
+	UpdatedAt  int64
+}
+
+// cursor returns the resource's value for a list sort key, and its ID.
+func (r *Resource) cursor(sortKey string) (string, string) {
+	switch sortKey {
+	case "title":
+		return r.Title, r.ID
+	case "updated_at":
+		return strconv.FormatInt(r.UpdatedAt, 10), r.ID
+	default:
+		return strconv.FormatInt(r.CreatedAt, 10), r.ID
+	}
+}
+
+// MaxResourceBodyBytes caps the size of a create or update request.
+const MaxResourceBodyBytes = 256 << 10
+
+// CreateResourceRequest is the body of POST /api/resources.
+type CreateResourceRequest struct {
+	Type       string   `json:"type" validate:"required,oneof=topic flashcard note summary"`
+	Title      string   `json:"title" validate:"required,max=200"`
+	Content    string   `json:"content" validate:"required,max=100000"`
+	Tags       []string `json:"tags"`
+	SpecPoints []string `json:"spec_points"`
+}
+
+// Validate normalises Tags and SpecPoints.
+func (req *CreateResourceRequest) Validate() []problem.FieldError {
+	var errs, pointErrs []problem.FieldError
+	req.Tags, errs = tags.Normalize("tags", req.Tags)
+	req.SpecPoints, pointErrs = specs.Normalize("spec_points", req.SpecPoints)
+	return append(errs, pointErrs...)
+}
+
+// UpdateResourceRequest is the body of PATCH /api/resources/{id}. Only the fields
+// sent are changed; Tags and SpecPoints replace every tag or link.
+type UpdateResourceRequest struct {
+	Type       *string   `json:"type" validate:"oneof=topic flashcard note summary"`
+	Title      *string   `json:"title" validate:"max=200"`
+	Content    *string   `json:"content" validate:"max=100000"`
+	Tags       *[]string `json:"tags"`
+	SpecPoints *[]string `json:"spec_points"`
+}
+
+// Validate checks that the fields sent are not blank, and normalises Tags and
+// SpecPoints.
+func (req *UpdateResourceRequest) Validate() []problem.FieldError {
+	var errs, pointErrs []problem.FieldError
+	if req.Tags != nil {
+		*req.Tags, errs = tags.Normalize("tags", *req.Tags)
+	}
+	if req.SpecPoints != nil {
+		*req.SpecPoints, pointErrs = specs.Normalize("spec_points", *req.SpecPoints)
+		errs = append(errs, pointErrs...)
+	}
+	if req.Type != nil && strings.TrimSpace(*req.Type) == "" {
+		errs = append(errs, problem.FieldError{Field: "type", Code: "required", Message: "is required"})
+	}
+	if req.Title != nil && strings.TrimSpace(*req.Title) == "" {
+		errs = append(errs, problem.FieldError{Field: "title", Code: "required", Message: "is required"})
+	}
+	if req.Content != nil && strings.TrimSpace(*req.Content) == "" {
+		errs = append(errs, problem.FieldError{Field: "content", Code: "required", Message: "is required"})
+	}
+	return errs
+}
+
+// BulkRequest is the body of POST /api/resources/bulk, for up to 100 resources. Every
+// ID must be one of the user's resources, or nothing is changed.
+type BulkRequest struct {
+	Action string   `json:"action" validate:"required,oneof=delete add_tags remove_tags"`
+	IDs    []string `json:"ids" validate:"required,max=100"`
+	Tags   []string `json:"tags"`
+}
+
+// Validate checks that the tag actions have tags, and normalises them.
+func (req *BulkRequest) Validate() []problem.FieldError {
+	if req.Action == "delete" {
+		if len(req.Tags) > 0 {
+			return []problem.FieldError{{Field: "tags", Code: "not_allowed", Message: "is only used by add_tags and remove_tags"}}
+		}
+		return nil
+	}
+	if len(req.Tags) == 0 {
+		return []problem.FieldError{{Field: "tags", Code: "required", Message: "is required"}}
+	}
+	var errs []problem.FieldError
+	req.Tags, errs = tags.Normalize("tags", req.Tags)
+	return errs
 }
@@ -1 +1,235 @@
 package revision
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"KdnSite/internal/flashcards"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+)
+
+const selectResource = `SELECT id, owner_id, type, content, card, source_id, created_at, updated_at FROM revision_resources`
+
+// scanResource reads a row selected by selectResource.
+func scanResource(row interface{ Scan(...any) error }) (*RevisionResource, error) {
+	var (
+		res    RevisionResource
+		card   []byte
+		source sql.NullString
+	)
+	if err := row.Scan(&res.ID, &res.OwnerID, &res.Type, &res.Content, &card, &source, &res.CreatedAt, &res.UpdatedAt); err != nil {
+		return nil, err
+	}
+	res.SourceID = source.String
+	if len(card) > 0 {
+		res.Card = &flashcards.Note{}
+		if err := json.Unmarshal(card, res.Card); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// loadLinks fills in the tags and spec points of each resource.
+func loadLinks(ctx context.Context, q tags.Querier, list []*RevisionResource) error {
+	ids := make([]string, len(list))
+	for i, res := range list {
+		ids[i] = res.ID
+	}
+	byID, err := tags.Load(ctx, q, tags.RevisionResources, ids)
+	if err != nil {
+		return err
+	}
+	points, err := specs.Load(ctx, q, specs.RevisionResources, ids)
+	if err != nil {
+		return err
+	}
+	for _, res := range list {
+		res.Tags = byID[res.ID]
+		if res.Tags == nil {
+			res.Tags = []string{}
+		}
+		res.SpecPoints = points[res.ID]
+		if res.SpecPoints == nil {
+			res.SpecPoints = []string{}
+		}
+	}
+	return nil
+}
+
+// getResource returns one of the user's resources with its tags and spec points, or
+// sql.ErrNoRows.
+func getResource(ctx context.Context, db *sql.DB, ownerID, id string) (*RevisionResource, error) {
+	res, err := scanResource(db.QueryRowContext(ctx, selectResource+` WHERE id=$1 AND owner_id=$2`, id, ownerID))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadLinks(ctx, db, []*RevisionResource{res}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Create inserts res with its tags and spec points. A flashcard's content is set to a summary of its
+// note, and its cards are generated in the same transaction.
+func Create(ctx context.Context, db *sql.DB, res *RevisionResource) error {
+	card, err := prepareCard(res)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO revision_resources (id, owner_id, type, content, card, source_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		res.ID, res.OwnerID, res.Type, res.Content, card, sql.NullString{String: res.SourceID, Valid: res.SourceID != ""}, res.CreatedAt, res.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := tags.Set(ctx, tx, tags.RevisionResources, res.OwnerID, res.ID, res.Tags); err != nil {
+		return err
+	}
+	if err := specs.Set(ctx, tx, specs.RevisionResources, res.ID, res.SpecPoints); err != nil {
+		return err
+	}
+	if res.Card != nil {
+		if err := flashcards.CheckMedia(ctx, tx, res.OwnerID, res.Card, "card."); err != nil {
+			return err
+		}
+		if err := flashcards.ReplaceCards(ctx, tx, res.OwnerID, res.ID, flashcards.Generate(res.Card), res.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// updateResource saves the content, card and, if setLinks, the tags and spec points of
+// res. A changed card regenerates the flashcards.
+func updateResource(ctx context.Context, db *sql.DB, res *RevisionResource, cardChanged, setLinks bool) error {
+	card, err := prepareCard(res)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `UPDATE revision_resources SET content=$1, card=$2, updated_at=$3 WHERE id=$4 AND owner_id=$5`,
+		res.Content, card, res.UpdatedAt, res.ID, res.OwnerID)
+	if err != nil {
+		return err
+	}
+	if setLinks {
+		if err := tags.Set(ctx, tx, tags.RevisionResources, res.OwnerID, res.ID, res.Tags); err != nil {
+			return err
+		}
+		if err := specs.Set(ctx, tx, specs.RevisionResources, res.ID, res.SpecPoints); err != nil {
+			return err
+		}
+	}
+	if cardChanged {
+		if err := flashcards.CheckMedia(ctx, tx, res.OwnerID, res.Card, "card."); err != nil {
+			return err
+		}
+		if err := flashcards.ReplaceCards(ctx, tx, res.OwnerID, res.ID, flashcards.Generate(res.Card), res.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prepareCard sets a flashcard's content to the summary of its note and returns the
+// note as JSON, or nil for other types.
+func prepareCard(res *RevisionResource) ([]byte, error) {
+	if res.Card == nil {
+		return nil, nil
+	}
+	res.Content = res.Card.Summary()
+	return json.Marshal(res.Card)
+}
+
+// deleteResource deletes one of the user's resources, with its cards, their review
+// schedules and its tag links. It returns sql.ErrNoRows if there is no such resource.
+func deleteResource(ctx context.Context, db *sql.DB, ownerID, id string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := flashcards.DeleteNoteCards(ctx, tx, ownerID, []string{id}); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM revision_resources WHERE id=$1 AND owner_id=$2`, id, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// bulkUpdate applies req to the user's resources in one transaction. If any ID is not
+// one of theirs, nothing is changed and the returned problem lists the missing IDs.
+func bulkUpdate(ctx context.Context, db *sql.DB, ownerID string, req *BulkRequest, now int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var owned pq.StringArray
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(array_agg(id), '{}') FROM revision_resources WHERE owner_id=$1 AND id = ANY($2)`,
+		ownerID, pq.Array(req.IDs)).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if missing := notFound(req.IDs, owned); len(missing) > 0 {
+		return problem.Validation(missing...)
+	}
+	switch req.Action {
+	case "delete":
+		if err = flashcards.DeleteNoteCards(ctx, tx, ownerID, req.IDs); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM revision_resources WHERE owner_id=$1 AND id = ANY($2)`, ownerID, pq.Array(req.IDs))
+	case "add_tags":
+		if err = tags.Attach(ctx, tx, tags.RevisionResources, ownerID, req.IDs, req.Tags); err == nil {
+			err = tags.CheckLimit(ctx, tx, tags.RevisionResources, req.IDs)
+		}
+	case "remove_tags":
+		err = tags.Detach(ctx, tx, tags.RevisionResources, ownerID, req.IDs, req.Tags)
+	}
+	if err != nil {
+		return err
+	}
+	if req.Action != "delete" {
+		_, err = tx.ExecContext(ctx, `UPDATE revision_resources SET updated_at=$1 WHERE owner_id=$2 AND id = ANY($3)`, now, ownerID, pq.Array(req.IDs))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// notFound reports each of ids that is not in owned.
+func notFound(ids, owned []string) []problem.FieldError {
+	have := make(map[string]bool, len(owned))
+	for _, id := range owned {
+		have[id] = true
+	}
+	var errs []problem.FieldError
+	for i, id := range ids {
+		if !have[id] {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("ids[%d]", i), Code: "not_found", Message: "is not one of your revision resources"})
+		}
+	}
+	return errs
+}
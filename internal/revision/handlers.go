@@ -2,39 +2,72 @@ package revision
 
 import (
 	"KdnSite/internal/auth"
+	"KdnSite/internal/markdown"
+	"KdnSite/internal/pagination"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+	"KdnSite/internal/validate"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// listSpec is what GET /api/revision can sort and filter by.
+var listSpec = pagination.Spec{
+	IDColumn: "id",
+	Sorts: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Numeric: true},
+		"updated_at": {Column: "updated_at", Numeric: true},
+	},
+	DefaultSort: "-created_at",
+	Filters:     map[string]string{"type": "type"},
+	Conditions: map[string]string{
+		"tag":        tags.RevisionResources.Filter(),
+		"spec_point": specs.RevisionResources.Filter(),
+	},
+	DateColumn: "created_at",
+}
+
 // ListRevisionResources handles GET /api/revision
 func ListRevisionResources(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		q, err := pagination.Parse(r, listSpec)
+		if err != nil {
+			problem.Error(w, r, err)
 			return
 		}
-		rows, err := db.QueryContext(r.Context(), `SELECT id, owner_id, type, topic, content, created_at, updated_at FROM revision_resources WHERE owner_id=$1`, userID)
+		query, args := q.SQL(selectResource+` WHERE owner_id=$1`, userID)
+		rows, err := db.QueryContext(r.Context(), query, args...)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Write(w, r, problem.Internal())
 			return
 		}
 		defer rows.Close()
 		var resources []*RevisionResource
 		for rows.Next() {
-			var res RevisionResource
-			if err := rows.Scan(&res.ID, &res.OwnerID, &res.Type, &res.Topic, &res.Content, &res.CreatedAt, &res.UpdatedAt); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+			res, err := scanResource(rows)
+			if err != nil {
+				problem.Write(w, r, problem.Internal())
 				return
 			}
-			resources = append(resources, &res)
+			res.ContentHTML = markdown.Render(res.Content)
+			resources = append(resources, res)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resources)
+		if err := loadLinks(r.Context(), db, resources); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		pagination.Write(w, pagination.NewPage(q, resources, (*RevisionResource).cursor))
 	}
 }
 
@@ -43,27 +76,170 @@ func CreateRevisionResource(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req CreateRevisionResourceRequest
+		if err := validate.DecodeJSON(w, r, MaxRevisionBodyBytes, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
 			return
 		}
-		var res RevisionResource
-		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		if err := specs.Check(r.Context(), db, "spec_points", req.SpecPoints); err != nil {
+			problem.Error(w, r, err)
 			return
 		}
-		res.ID = uuid.NewString()
-		res.OwnerID = userID
 		t := time.Now().Unix()
-		res.CreatedAt = t
-		res.UpdatedAt = t
-		_, err = db.ExecContext(r.Context(), `INSERT INTO revision_resources (id, owner_id, type, topic, content, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-			res.ID, res.OwnerID, res.Type, res.Topic, res.Content, res.CreatedAt, res.UpdatedAt)
+		res := RevisionResource{
+			ID:         uuid.NewString(),
+			OwnerID:    userID,
+			Type:       req.Type,
+			Tags:       req.Tags,
+			SpecPoints: req.SpecPoints,
+			Content:    req.Content,
+			Card:       req.Card,
+			CreatedAt:  t,
+			UpdatedAt:  t,
+		}
+		if res.Tags == nil {
+			res.Tags = []string{}
+		}
+		if err := Create(r.Context(), db, &res); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeResource(w, http.StatusCreated, &res)
+	}
+}
+
+// GetRevisionResource handles GET /api/revision/{id}
+func GetRevisionResource(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(res)
+		res, err := getResource(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Revision resource not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeResource(w, http.StatusOK, res)
 	}
 }
+
+// UpdateRevisionResource handles PATCH /api/revision/{id}
+func UpdateRevisionResource(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req UpdateRevisionResourceRequest
+		if err := validate.DecodeJSON(w, r, MaxRevisionBodyBytes, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		res, err := getResource(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Revision resource not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(res); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if req.SpecPoints != nil {
+			if err := specs.Check(r.Context(), db, "spec_points", *req.SpecPoints); err != nil {
+				problem.Error(w, r, err)
+				return
+			}
+			res.SpecPoints = *req.SpecPoints
+		}
+		if req.Tags != nil {
+			res.Tags = *req.Tags
+		}
+		if req.Content != nil && req.Card == nil && res.Card == nil {
+			res.Content = *req.Content
+		}
+		if req.Card != nil {
+			res.Card = req.Card
+		}
+		res.UpdatedAt = time.Now().Unix()
+		if err := updateResource(r.Context(), db, res, req.Card != nil, req.Tags != nil || req.SpecPoints != nil); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeResource(w, http.StatusOK, res)
+	}
+}
+
+// DeleteRevisionResource handles DELETE /api/revision/{id}
+func DeleteRevisionResource(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		err = deleteResource(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Revision resource not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// BulkRevisionResources handles POST /api/revision/bulk
+func BulkRevisionResources(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req BulkRequest
+		if err := validate.DecodeJSON(w, r, 64<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if err := bulkUpdate(r.Context(), db, userID, &req, time.Now().Unix()); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeResource(w http.ResponseWriter, status int, res *RevisionResource) {
+	res.ContentHTML = markdown.Render(res.Content)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
@@ -1,11 +1,141 @@
 package revision
 
+import (
+	"strconv"
+	"strings"
+
+	"KdnSite/internal/flashcards"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/specs"
+	"KdnSite/internal/tags"
+)
+
 type RevisionResource struct {
-	ID        string
-	OwnerID   string
-	Type      string // flashcard, note, summary, etc.
-	Topic     string
-	Content   string // markdown or text
+	ID      string
+	OwnerID string
+	Type    string // flashcard, note, summary, etc.
+	Tags    []string
+	// SpecPoints are the IDs of the exam spec points the resource covers.
+	SpecPoints []string
+	Content    string // markdown or text
+	// ContentHTML is Content rendered by the markdown package. It is sanitised and
+	// safe to insert into a page; it is not stored.
+	ContentHTML string
+	// Card is the structured note behind a flashcard, from which its cards are
+	// generated. Content then holds a plain summary of it.
+	Card *flashcards.Note
+	// SourceID is the library resource this was copied from, if any.
+	SourceID  string
 	CreatedAt int64
 	UpdatedAt int64
 }
+
+// cursor returns the resource's value for a list sort key, and its ID.
+func (r *RevisionResource) cursor(sortKey string) (string, string) {
+	if sortKey == "updated_at" {
+		return strconv.FormatInt(r.UpdatedAt, 10), r.ID
+	}
+	return strconv.FormatInt(r.CreatedAt, 10), r.ID
+}
+
+// MaxRevisionBodyBytes caps the size of a create or update request.
+const MaxRevisionBodyBytes = 256 << 10
+
+// CreateRevisionResourceRequest is the body of POST /api/revision. Flashcards send
+// Card instead of Content; notes and summaries send Content.
+type CreateRevisionResourceRequest struct {
+	Type       string           `json:"type" validate:"required,oneof=flashcard note summary"`
+	Tags       []string         `json:"tags"`
+	SpecPoints []string         `json:"spec_points"`
+	Content    string           `json:"content" validate:"max=100000"`
+	Card       *flashcards.Note `json:"card"`
+}
+
+// Validate applies the rules that depend on Type, and normalises Tags and SpecPoints.
+func (req *CreateRevisionResourceRequest) Validate() []problem.FieldError {
+	var errs, pointErrs []problem.FieldError
+	req.Tags, errs = tags.Normalize("tags", req.Tags)
+	req.SpecPoints, pointErrs = specs.Normalize("spec_points", req.SpecPoints)
+	errs = append(errs, pointErrs...)
+	return append(errs, validateBody(req.Type, &req.Content, req.Card, true)...)
+}
+
+// UpdateRevisionResourceRequest is the body of PATCH /api/revision/{id}. Only the
+// fields sent are changed; Tags and SpecPoints replace every tag or link. The type
+// cannot be changed.
+type UpdateRevisionResourceRequest struct {
+	Tags       *[]string        `json:"tags"`
+	SpecPoints *[]string        `json:"spec_points"`
+	Content    *string          `json:"content" validate:"max=100000"`
+	Card       *flashcards.Note `json:"card"`
+}
+
+// Validate checks the request against the resource being updated, and normalises Tags
+// and SpecPoints.
+func (req *UpdateRevisionResourceRequest) Validate(res *RevisionResource) []problem.FieldError {
+	var errs, pointErrs []problem.FieldError
+	if req.Tags != nil {
+		*req.Tags, errs = tags.Normalize("tags", *req.Tags)
+	}
+	if req.SpecPoints != nil {
+		*req.SpecPoints, pointErrs = specs.Normalize("spec_points", *req.SpecPoints)
+		errs = append(errs, pointErrs...)
+	}
+	if req.Content == nil && req.Card == nil {
+		return errs
+	}
+	typ := res.Type
+	if typ == "flashcard" && res.Card == nil && req.Card == nil {
+		// Flashcards written before cards were structured are edited as text
+		typ = "note"
+	}
+	return append(errs, validateBody(typ, req.Content, req.Card, false)...)
+}
+
+// validateBody checks that a flashcard has a valid card and no content, and that any
+// other type has content and no card. On update only the fields sent are required.
+func validateBody(typ string, content *string, card *flashcards.Note, create bool) []problem.FieldError {
+	if typ != "flashcard" {
+		if card != nil {
+			return []problem.FieldError{{Field: "card", Code: "not_allowed", Message: "is only used by flashcards"}}
+		}
+		if content != nil && strings.TrimSpace(*content) == "" {
+			return []problem.FieldError{{Field: "content", Code: "required", Message: "is required"}}
+		}
+		return nil
+	}
+	if content != nil && *content != "" {
+		return []problem.FieldError{{Field: "content", Code: "not_allowed", Message: "is generated from card for flashcards"}}
+	}
+	if card == nil {
+		if create {
+			return []problem.FieldError{{Field: "card", Code: "required", Message: "is required"}}
+		}
+		return nil
+	}
+	return card.Validate("card.")
+}
+
+// BulkRequest is the body of POST /api/revision/bulk, for up to 100 resources. Every
+// ID must be one of the user's resources, or nothing is changed.
+type BulkRequest struct {
+	Action string   `json:"action" validate:"required,oneof=delete add_tags remove_tags"`
+	IDs    []string `json:"ids" validate:"required,max=100"`
+	Tags   []string `json:"tags"`
+}
+
+// Validate checks that the tag actions have tags, and normalises them.
+func (req *BulkRequest) Validate() []problem.FieldError {
+	if req.Action == "delete" {
+		if len(req.Tags) > 0 {
+			return []problem.FieldError{{Field: "tags", Code: "not_allowed", Message: "is only used by add_tags and remove_tags"}}
+		}
+		return nil
+	}
+	if len(req.Tags) == 0 {
+		return []problem.FieldError{{Field: "tags", Code: "required", Message: "is required"}}
+	}
+	var errs []problem.FieldError
+	req.Tags, errs = tags.Normalize("tags", req.Tags)
+	return errs
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Matched terms are wrapped in private-use characters by ts_headline and turned into
+// <mark> only after the snippet has been HTML-escaped.
+const (
+	startSel = "\ue000"
+	stopSel  = "\ue001"
+)
+
+var headlineOptions = `StartSel="` + startSel + `", StopSel="` + stopSel + `", MinWords=8, MaxWords=30, MaxFragments=2, FragmentDelimiter=" … "`
+
+// hits selects every document matching the query that the user may see: their own
+// revision resources, resources and projects, and every quiz.
+// Quizzes have a topic rather than tags, which is treated as their one tag.
+// $1 is the user ID and $2 the query in websearch syntax.
+const hits = `WITH query AS (SELECT websearch_to_tsquery('english', $2) AS q),
+hits AS (
+	SELECT 'revision'::text AS type, r.id, COALESCE(NULLIF(r.tag_names, ''), initcap(r.type)) AS title,
+		ARRAY(SELECT t.name FROM revision_resource_tags rt JOIN tags t ON t.id = rt.tag_id WHERE rt.resource_id = r.id ORDER BY t.name) AS tags,
+		r.content AS body, ts_rank(r.search, query.q) AS rank
+	FROM revision_resources r, query WHERE r.owner_id = $1 AND r.search @@ query.q
+	UNION ALL
+	SELECT 'resource', r.id, r.title,
+		ARRAY(SELECT t.name FROM resource_tags rt JOIN tags t ON t.id = rt.tag_id WHERE rt.resource_id = r.id ORDER BY t.name),
+		r.content, ts_rank(r.search, query.q)
+	FROM resources r, query WHERE r.owner_id = $1 AND r.search @@ query.q
+	UNION ALL
+	SELECT 'project', p.id, p.title, '{}', COALESCE(p.data::text, ''), ts_rank(p.search, query.q)
+	FROM projects p, query WHERE p.owner_id = $1 AND p.search @@ query.q
+	UNION ALL
+	SELECT 'quiz', z.id, z.title, array_remove(ARRAY[z.topic], ''), z.description, ts_rank(z.search, query.q)
+	FROM quizzes z, query WHERE z.search @@ query.q
+)`
+
+// matching narrows hits to the requested types ($3) and tag ($4).
+const matching = `,
+matching AS (
+	SELECT * FROM hits
+	WHERE (cardinality($3::text[]) = 0 OR type = ANY($3::text[])) AND ($4 = '' OR EXISTS (SELECT 1 FROM unnest(tags) tag WHERE lower(tag) = lower($4)))
+)`
+
+// Search runs p and returns the requested page of results with the facet counts.
+func Search(ctx context.Context, db *sql.DB, p Params) (*Response, error) {
+	resp := &Response{Query: p.Query, Results: []Result{}, Limit: p.Limit, Offset: p.Offset}
+	types := p.Types
+	if types == nil {
+		types = []string{}
+	}
+	args := []any{p.UserID, p.Query, pq.Array(types), p.Tag}
+	rows, err := db.QueryContext(ctx, hits+matching+`
+SELECT h.type, h.id, h.title, h.tags, ts_headline('english', h.body, query.q, $5), h.rank, h.total
+FROM (
+	SELECT *, COUNT(*) OVER () AS total FROM matching
+	ORDER BY rank DESC, id LIMIT $6 OFFSET $7
+) h, query
+ORDER BY h.rank DESC, h.id`, append(args, headlineOptions, p.Limit, p.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Result
+		var headline string
+		if err := rows.Scan(&r.Type, &r.ID, &r.Title, pq.Array(&r.Tags), &headline, &r.Rank, &resp.Total); err != nil {
+			return nil, err
+		}
+		r.SnippetHTML = snippetHTML(headline)
+		r.URL = resultURL(r.Type, r.ID)
+		resp.Results = append(resp.Results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// A page past the last result has no rows to carry the total
+	if len(resp.Results) == 0 && p.Offset > 0 {
+		if err := db.QueryRowContext(ctx, hits+matching+`
+SELECT COUNT(*) FROM matching`, args...).Scan(&resp.Total); err != nil {
+			return nil, err
+		}
+	}
+
+	resp.Facets, err = facets(ctx, db, p)
+	return resp, err
+}
+
+// maxTagFacets caps the tag facet to the most common tags.
+const maxTagFacets = 20
+
+func facets(ctx context.Context, db *sql.DB, p Params) (Facets, error) {
+	f := Facets{Type: []Facet{}, Tag: []Facet{}}
+	rows, err := db.QueryContext(ctx, hits+`
+SELECT 'type', type, COUNT(*) FROM hits GROUP BY type
+UNION ALL
+SELECT 'tag', tag, COUNT(*) FROM hits, unnest(tags) tag GROUP BY tag
+ORDER BY 3 DESC, 2`, p.UserID, p.Query)
+	if err != nil {
+		return f, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var facet Facet
+		if err := rows.Scan(&kind, &facet.Value, &facet.Count); err != nil {
+			return f, err
+		}
+		if kind == "type" {
+			f.Type = append(f.Type, facet)
+		} else if len(f.Tag) < maxTagFacets {
+			f.Tag = append(f.Tag, facet)
+		}
+	}
+	return f, rows.Err()
+}
+
+func snippetHTML(headline string) string {
+	return strings.NewReplacer(startSel, "<mark>", stopSel, "</mark>").Replace(html.EscapeString(headline))
+}
+
+// resultURL is the page a result opens. Resources have no page of their own yet.
+func resultURL(typ, id string) string {
+	switch typ {
+	case TypeRevision:
+		return "/user/revision"
+	case TypeProject:
+		return "/user/projects/list"
+	case TypeQuiz:
+		return "/user/quiz/take?id=" + url.QueryEscape(id)
+	default:
+		return ""
+	}
+}
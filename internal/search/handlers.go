@@ -0,0 +1,98 @@
+package search
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+)
+
+const (
+	defaultLimit   = 20
+	maxLimit       = 50
+	maxOffset      = 1000
+	maxQueryLength = 200
+)
+
+var allTypes = []string{TypeRevision, TypeResource, TypeProject, TypeQuiz}
+
+// Handler handles GET /api/search?q=...&type=revision,quiz&tag=...&limit=&offset=
+func Handler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		p, err := parseParams(r)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		p.UserID = userID
+		resp, err := Search(r.Context(), db, p)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[search.Handler] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func parseParams(r *http.Request) (Params, error) {
+	values := r.URL.Query()
+	p := Params{
+		Query: strings.TrimSpace(values.Get("q")),
+		Tag:   strings.TrimSpace(values.Get("tag")),
+		Limit: defaultLimit,
+	}
+	var errs []problem.FieldError
+	switch {
+	case p.Query == "":
+		errs = append(errs, problem.FieldError{Field: "q", Code: "required", Message: "is required"})
+	case utf8.RuneCountInString(p.Query) > maxQueryLength:
+		errs = append(errs, problem.FieldError{Field: "q", Code: "too_long", Message: fmt.Sprintf("must be at most %d characters", maxQueryLength)})
+	}
+	for _, t := range strings.Split(values.Get("type"), ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !slices.Contains(allTypes, t) {
+			errs = append(errs, problem.FieldError{Field: "type", Code: "invalid_choice", Message: "must be a comma separated list of " + strings.Join(allTypes, ", ")})
+			break
+		}
+		p.Types = append(p.Types, t)
+	}
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			errs = append(errs, problem.FieldError{Field: "limit", Code: "out_of_range", Message: fmt.Sprintf("must be a whole number from 1 to %d", maxLimit)})
+		}
+		p.Limit = n
+	}
+	if v := values.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxOffset {
+			errs = append(errs, problem.FieldError{Field: "offset", Code: "out_of_range", Message: fmt.Sprintf("must be a whole number from 0 to %d", maxOffset)})
+		}
+		p.Offset = n
+	}
+	if len(errs) > 0 {
+		return p, problem.Validation(errs...)
+	}
+	return p, nil
+}
@@ -0,0 +1,53 @@
+package search
+
+// Result types, also accepted by the type filter.
+const (
+	TypeRevision = "revision"
+	TypeResource = "resource"
+	TypeProject  = "project"
+	TypeQuiz     = "quiz"
+)
+
+// Result is one match. SnippetHTML is HTML-escaped text in which the matched terms
+// are wrapped in <mark>, so it is safe to insert as HTML.
+type Result struct {
+	Type        string   `json:"type"`
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Tags        []string `json:"tags,omitempty"`
+	SnippetHTML string   `json:"snippet_html"`
+	URL         string   `json:"url,omitempty"`
+	Rank        float64  `json:"rank"`
+}
+
+// Facet is a filter value with the number of matches it would leave.
+type Facet struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets count every match of the query, before the type and tag filters.
+type Facets struct {
+	Type []Facet `json:"type"`
+	Tag  []Facet `json:"tag"`
+}
+
+// Response is the body of GET /api/search.
+type Response struct {
+	Query   string   `json:"query"`
+	Results []Result `json:"results"`
+	Total   int      `json:"total"`
+	Facets  Facets   `json:"facets"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
+
+// Params is a parsed search request.
+type Params struct {
+	UserID string
+	Query  string
+	Types  []string
+	Tag    string
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// touchInterval limits how often last_seen_at is written for a busy session.
+const touchInterval = 60
+
+func CreateSession(ctx context.Context, db *sql.DB, s *Session) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO sessions (id, user_id, token_hash, device, ip, user_agent, created_at, last_seen_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		s.ID, s.UserID, s.TokenHash, s.Device, s.IP, s.UserAgent, s.CreatedAt, s.LastSeenAt, s.ExpiresAt)
+	return err
+}
+
+func GetSession(ctx context.Context, db *sql.DB, id string) (*Session, error) {
+	row := db.QueryRowContext(ctx, `SELECT id, user_id, token_hash, device, ip, user_agent, created_at, last_seen_at, expires_at, COALESCE(revoked_at, 0) FROM sessions WHERE id=$1`, id)
+	return scanSession(row)
+}
+
+// GetSessionByTokenHash returns the token's latest session, or a revoked one if there
+// is any, so a token stays revoked whatever sessions were made for it later.
+func GetSessionByTokenHash(ctx context.Context, db *sql.DB, tokenHash string) (*Session, error) {
+	row := db.QueryRowContext(ctx, `SELECT id, user_id, token_hash, device, ip, user_agent, created_at, last_seen_at, expires_at, COALESCE(revoked_at, 0) FROM sessions WHERE token_hash=$1 ORDER BY revoked_at IS NULL, created_at DESC LIMIT 1`, tokenHash)
+	return scanSession(row)
+}
+
+// TokenRevoked reports whether a session for the token has been revoked. A revoked
+// token must not be exchanged for a new session, or logging out would not stick.
+func TokenRevoked(ctx context.Context, db *sql.DB, tokenHash string) (bool, error) {
+	var revoked bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sessions WHERE token_hash=$1 AND revoked_at IS NOT NULL)`, tokenHash).Scan(&revoked)
+	return revoked, err
+}
+
+// ListActiveSessions returns the user's sessions that are neither revoked nor expired, most recently used first.
+func ListActiveSessions(ctx context.Context, db *sql.DB, userID string) ([]*Session, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, user_id, token_hash, device, ip, user_agent, created_at, last_seen_at, expires_at, COALESCE(revoked_at, 0) FROM sessions WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC`,
+		userID, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []*Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity, writing at most once per touchInterval seconds.
+func TouchSession(ctx context.Context, db *sql.DB, id string) error {
+	now := time.Now().Unix()
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET last_seen_at=$1 WHERE id=$2 AND last_seen_at < $3`, now, id, now-touchInterval)
+	return err
+}
+
+// RevokeSession revokes one of the user's sessions. It returns sql.ErrNoRows if the
+// session does not exist, belongs to someone else or is already revoked.
+func RevokeSession(ctx context.Context, db *sql.DB, id, userID string) error {
+	res, err := db.ExecContext(ctx, `UPDATE sessions SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL`, time.Now().Unix(), id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func RevokeAllSessions(ctx context.Context, db *sql.DB, userID string) error {
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL`, time.Now().Unix(), userID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	var s Session
+	err := row.Scan(&s.ID, &s.UserID, &s.TokenHash, &s.Device, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/problem"
+)
+
+// ListSessions handles GET /api/auth/sessions
+func ListSessions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		sessions, err := ListActiveSessions(r.Context(), db, userID)
+		if err != nil {
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if current, ok := FromContext(r.Context()); ok {
+			for _, s := range sessions {
+				s.Current = s.ID == current.ID
+			}
+		}
+		if sessions == nil {
+			sessions = []*Session{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// RevokeSessionHandler handles DELETE /api/auth/sessions?id=
+func RevokeSessionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			problem.Write(w, r, problem.BadRequest(""))
+			return
+		}
+		if err := RevokeSession(r.Context(), db, id, userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				problem.Write(w, r, problem.NotFound(""))
+				return
+			}
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
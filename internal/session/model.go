@@ -0,0 +1,16 @@
+package session
+
+// Session is a server-side record of a login, used to list and revoke a user's devices.
+type Session struct {
+	ID         string `json:"id"`
+	UserID     string `json:"-"`
+	TokenHash  string `json:"-"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	RevokedAt  int64  `json:"-"` // 0 while the session is active
+	Current    bool   `json:"current"`
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"KdnSite/internal/utils"
+)
+
+// CookieName is the HttpOnly cookie carrying the opaque session ID next to auth_token.
+const CookieName = "session_id"
+
+// Lifetime matches the auth_token cookie lifetime.
+const Lifetime = 30 * 24 * time.Hour
+
+type contextKey string
+
+const sessionContextKey contextKey = "session"
+
+// HashToken returns the hex SHA-256 of a JWT so raw tokens are never stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// New builds a session for a freshly issued token from the login request.
+func New(r *http.Request, userID, token string) *Session {
+	now := time.Now()
+	ua := r.UserAgent()
+	return &Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		TokenHash:  HashToken(token),
+		Device:     DescribeDevice(ua),
+		IP:         utils.ClientIP(r),
+		UserAgent:  ua,
+		CreatedAt:  now.Unix(),
+		LastSeenAt: now.Unix(),
+		ExpiresAt:  now.Add(Lifetime).Unix(),
+	}
+}
+
+// Valid reports whether the session may still authenticate the given user and token.
+func (s *Session) Valid(userID, token string) bool {
+	return s.RevokedAt == 0 &&
+		s.ExpiresAt > time.Now().Unix() &&
+		s.UserID == userID &&
+		s.TokenHash == HashToken(token)
+}
+
+// WithSession stores the authenticated session in the request context.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey, s)
+}
+
+// FromContext returns the session stored by RequireAuth, if any.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionContextKey).(*Session)
+	return s, ok && s != nil
+}
+
+// DescribeDevice turns a User-Agent into a short label such as "Firefox on Windows".
+func DescribeDevice(ua string) string {
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"), strings.Contains(ua, "Opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+	os := "unknown device"
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		os = "iOS"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		os = "macOS"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+	return browser + " on " + os
+}
@@ -0,0 +1,226 @@
+package specs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"KdnSite/internal/problem"
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx, so links can be written in the same
+// transaction as the items they belong to.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Set replaces the spec points linked to one item with pointIDs, which must exist.
+func Set(ctx context.Context, q Querier, t Target, itemID string, pointIDs []string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM `+t.LinkTable+` WHERE item_id=$1`, itemID); err != nil {
+		return err
+	}
+	if len(pointIDs) == 0 {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, `INSERT INTO `+t.LinkTable+` (item_id, point_id) SELECT $1, unnest($2::text[])`,
+		itemID, pq.Array(pointIDs))
+	return err
+}
+
+// Load returns the IDs of the spec points linked to each of itemIDs, in spec order.
+func Load(ctx context.Context, q Querier, t Target, itemIDs []string) (map[string][]string, error) {
+	byItem := make(map[string][]string, len(itemIDs))
+	if len(itemIDs) == 0 {
+		return byItem, nil
+	}
+	rows, err := q.QueryContext(ctx, `SELECT lt.item_id, p.id FROM `+t.LinkTable+` lt JOIN spec_points p ON p.id = lt.point_id
+WHERE lt.item_id = ANY($1) ORDER BY p.spec_id, p.ord`, pq.Array(itemIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item, point string
+		if err := rows.Scan(&item, &point); err != nil {
+			return nil, err
+		}
+		byItem[item] = append(byItem[item], point)
+	}
+	return byItem, rows.Err()
+}
+
+// Check returns a validation problem listing each of ids, reported against field, that
+// is not a spec point.
+func Check(ctx context.Context, q Querier, field string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := q.QueryContext(ctx, `SELECT id FROM spec_points WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	known := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		known[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var errs []problem.FieldError
+	for i, id := range ids {
+		if !known[id] {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Code: "not_found", Message: "is not a spec point"})
+		}
+	}
+	if len(errs) > 0 {
+		return problem.Validation(errs...)
+	}
+	return nil
+}
+
+// List returns the specs matching the non-empty filters, by board and title.
+func List(ctx context.Context, db *sql.DB, board, qualification, subject string) ([]*Spec, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, board, qualification, subject, code, title FROM specs
+WHERE ($1 = '' OR lower(board) = lower($1)) AND ($2 = '' OR lower(qualification) = lower($2)) AND ($3 = '' OR lower(subject) = lower($3))
+ORDER BY board, qualification, title`, board, qualification, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []*Spec{}
+	for rows.Next() {
+		var s Spec
+		if err := rows.Scan(&s.ID, &s.Board, &s.Qualification, &s.Subject, &s.Code, &s.Title); err != nil {
+			return nil, err
+		}
+		list = append(list, &s)
+	}
+	return list, rows.Err()
+}
+
+// Get returns a spec with its topics and subtopics, and how well each is covered for
+// the user. It returns sql.ErrNoRows if there is no such spec.
+func Get(ctx context.Context, db *sql.DB, id, userID string) (*Spec, error) {
+	s, byID, parents, err := tree(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range byID {
+		p.Coverage = &Coverage{}
+	}
+	if err := addCoverage(ctx, db, id, userID, byID, parents); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Tree returns a spec with its topics and subtopics, without their coverage. It
+// returns sql.ErrNoRows if there is no such spec.
+func Tree(ctx context.Context, db *sql.DB, id string) (*Spec, error) {
+	s, _, _, err := tree(ctx, db, id)
+	return s, err
+}
+
+// tree loads a spec and its points, returning them by ID along with each point's
+// parent ID ("" for topics).
+func tree(ctx context.Context, db *sql.DB, id string) (*Spec, map[string]*Point, map[string]string, error) {
+	var s Spec
+	err := db.QueryRowContext(ctx, `SELECT id, board, qualification, subject, code, title FROM specs WHERE id=$1`, id).
+		Scan(&s.ID, &s.Board, &s.Qualification, &s.Subject, &s.Code, &s.Title)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, COALESCE(parent_id, ''), ref, title, level FROM spec_points WHERE spec_id=$1 ORDER BY ord`, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+	byID := map[string]*Point{}
+	parents := map[string]string{}
+	for rows.Next() {
+		var (
+			p        Point
+			parentID string
+		)
+		if err := rows.Scan(&p.ID, &parentID, &p.Ref, &p.Title, &p.Level); err != nil {
+			return nil, nil, nil, err
+		}
+		byID[p.ID] = &p
+		parents[p.ID] = parentID
+		if parent := byID[parentID]; parent != nil {
+			parent.Subtopics = append(parent.Subtopics, &p)
+		} else {
+			s.Topics = append(s.Topics, &p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	return &s, byID, parents, nil
+}
+
+// coverageQuery lists (kind, point, item) for the content linked to a spec's points
+// that the user ($2) can use: their own revision and resources, approved library
+// resources published to everyone or to one of their classes, and every quiz. The
+// resources condition matches what the library shows them.
+const coverageQuery = `SELECT 'revision', l.point_id, l.item_id FROM revision_resource_spec_points l
+	JOIN revision_resources i ON i.id = l.item_id JOIN spec_points p ON p.id = l.point_id
+	WHERE p.spec_id = $1 AND i.owner_id = $2
+UNION ALL
+SELECT 'resources', l.point_id, l.item_id FROM resource_spec_points l
+	JOIN resources i ON i.id = l.item_id JOIN spec_points p ON p.id = l.point_id
+	WHERE p.spec_id = $1 AND (i.owner_id = $2 OR (i.status = 'approved' AND (i.visibility = 'public'
+		OR EXISTS (SELECT 1 FROM class_members m WHERE m.class_id = i.class_id AND m.user_id = $2))))
+UNION ALL
+SELECT 'quizzes', l.point_id, l.item_id FROM quiz_spec_points l
+	JOIN quizzes i ON i.id = l.item_id JOIN spec_points p ON p.id = l.point_id
+	WHERE p.spec_id = $1
+UNION ALL
+SELECT 'questions', l.point_id, l.item_id FROM question_spec_points l
+	JOIN questions i ON i.id = l.item_id JOIN quizzes z ON z.id = i.quiz_id JOIN spec_points p ON p.id = l.point_id
+	WHERE p.spec_id = $1`
+
+// addCoverage counts the content for each point, counting an item linked to both a
+// topic and its subtopic once for the topic.
+func addCoverage(ctx context.Context, db *sql.DB, specID, userID string, byID map[string]*Point, parents map[string]string) error {
+	rows, err := db.QueryContext(ctx, coverageQuery, specID, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type key struct{ point, kind, item string }
+	counted := map[key]bool{}
+	for rows.Next() {
+		var kind, pointID, itemID string
+		if err := rows.Scan(&kind, &pointID, &itemID); err != nil {
+			return err
+		}
+		for id := pointID; id != ""; id = parents[id] {
+			k := key{id, kind, itemID}
+			if counted[k] || byID[id] == nil {
+				continue
+			}
+			counted[k] = true
+			c := byID[id].Coverage
+			switch kind {
+			case "revision":
+				c.Revision++
+			case "resources":
+				c.Resources++
+			case "quizzes":
+				c.Quizzes++
+			case "questions":
+				c.Questions++
+			}
+		}
+	}
+	return rows.Err()
+}
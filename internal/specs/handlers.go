@@ -0,0 +1,102 @@
+package specs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
+)
+
+// LinksRequest is the body of PUT /api/quizzes/{id}/spec-points and
+// /api/questions/{id}/spec-points. It replaces every link.
+type LinksRequest struct {
+	SpecPoints []string `json:"spec_points"`
+}
+
+// ListSpecs handles GET /api/specs, optionally filtered by board, qualification and
+// subject.
+func ListSpecs(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		list, err := List(r.Context(), db, q.Get("board"), q.Get("qualification"), q.Get("subject"))
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ListSpecs] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeJSON(w, list)
+	}
+}
+
+// GetSpec handles GET /api/specs/{id}
+func GetSpec(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		spec, err := Get(r.Context(), db, r.PathValue("id"), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Specification not found"))
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[GetSpec] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeJSON(w, spec)
+	}
+}
+
+// SetLinks handles PUT on an item's spec-points, for items of t that only admins edit.
+// what names the item in the not found message.
+func SetLinks(db *sql.DB, t Target, what string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		var req LinksRequest
+		if err := validate.DecodeJSON(w, r, 16<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		ids, errs := Normalize("spec_points", req.SpecPoints)
+		if len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if err := Check(r.Context(), db, "spec_points", ids); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		id := r.PathValue("id")
+		var exists bool
+		if err := db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM `+t.Table+` WHERE id=$1)`, id).Scan(&exists); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if !exists {
+			problem.Write(w, r, problem.NotFound(what+" not found"))
+			return
+		}
+		if err := Set(r.Context(), db, t, id, ids); err != nil {
+			logging.FromContext(r.Context()).Errorf("[SetLinks] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,108 @@
+// Package specs is the catalogue of exam specifications: each board's qualification in
+// a subject, broken into topics and subtopics ("spec points"). Quizzes, questions,
+// resources and revision resources link to the points they cover, so students can see
+// their coverage of the syllabus they are actually sitting.
+package specs
+
+import (
+	"fmt"
+	"strings"
+
+	"KdnSite/internal/problem"
+)
+
+// MaxPerItem bounds how many spec points one item may link to.
+const MaxPerItem = 20
+
+// Point levels.
+const (
+	Topic    = "topic"
+	Subtopic = "subtopic"
+)
+
+// Spec is one exam board's specification for a qualification and subject.
+type Spec struct {
+	ID            string   `json:"id"`
+	Board         string   `json:"board"`
+	Qualification string   `json:"qualification"`
+	Subject       string   `json:"subject"`
+	Code          string   `json:"code"`
+	Title         string   `json:"title"`
+	Topics        []*Point `json:"topics,omitempty"`
+}
+
+// Point is a topic or subtopic of a spec. Its ID is the spec ID and its reference in
+// the specification, e.g. "aqa-gcse-chemistry:4.4.3".
+type Point struct {
+	ID        string    `json:"id"`
+	Ref       string    `json:"ref"`
+	Title     string    `json:"title"`
+	Level     string    `json:"level"`
+	Coverage  *Coverage `json:"coverage,omitempty"`
+	Subtopics []*Point  `json:"subtopics,omitempty"`
+}
+
+// Coverage counts the content the student can use for a point. A topic counts what is
+// linked to it or to any of its subtopics, each item once.
+type Coverage struct {
+	Revision  int `json:"revision"`
+	Resources int `json:"resources"`
+	Quizzes   int `json:"quizzes"`
+	Questions int `json:"questions"`
+}
+
+// PointID returns the ID of the point with ref in the spec.
+func PointID(specID, ref string) string {
+	return specID + ":" + ref
+}
+
+// Target is a kind of item that can be linked to spec points. Table and LinkTable
+// come only from the values below, so they are safe to interpolate into SQL.
+type Target struct {
+	Table     string // the items, which have an id column
+	LinkTable string // (item_id, point_id) pairs
+}
+
+var (
+	Quizzes           = Target{Table: "quizzes", LinkTable: "quiz_spec_points"}
+	Questions         = Target{Table: "questions", LinkTable: "question_spec_points"}
+	Resources         = Target{Table: "resources", LinkTable: "resource_spec_points"}
+	RevisionResources = Target{Table: "revision_resources", LinkTable: "revision_resource_spec_points"}
+)
+
+// Filter returns a pagination filter condition matching items of t linked to the point
+// whose ID is the filter value, or to one of its subtopics. The item table must not be
+// aliased in the query.
+func (t Target) Filter() string {
+	return t.FilterOn(t.Table + ".id")
+}
+
+// FilterOn is Filter for queries where the item ID is the column idColumn.
+func (t Target) FilterOn(idColumn string) string {
+	return `EXISTS (SELECT 1 FROM ` + t.LinkTable + ` sp JOIN spec_points ON spec_points.id = sp.point_id
+	WHERE sp.item_id = ` + idColumn + ` AND %s IN (spec_points.id, spec_points.parent_id))`
+}
+
+// Normalize trims and de-duplicates point IDs, reporting blank ones and too many
+// against field. Whether the points exist is checked by Check.
+func Normalize(field string, ids []string) ([]string, []problem.FieldError) {
+	var (
+		out  = []string{}
+		errs []problem.FieldError
+		seen = map[string]bool{}
+	)
+	for i, id := range ids {
+		id = strings.TrimSpace(id)
+		switch {
+		case id == "":
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Code: "required", Message: "must not be blank"})
+		case !seen[id]:
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	if len(out) > MaxPerItem {
+		errs = append(errs, problem.FieldError{Field: field, Code: "too_long", Message: fmt.Sprintf("must be at most %d items", MaxPerItem)})
+	}
+	return out, errs
+}
@@ -0,0 +1,126 @@
+package specs
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed seed/*.json
+var seedFiles embed.FS
+
+// seedFile is the layout of a file in seed/. The file name, without .json, is the
+// spec ID, so it must never change once released.
+type seedFile struct {
+	Board         string      `json:"board"`
+	Qualification string      `json:"qualification"`
+	Subject       string      `json:"subject"`
+	Code          string      `json:"code"`
+	Title         string      `json:"title"`
+	Topics        []seedTopic `json:"topics"`
+}
+
+type seedTopic struct {
+	Ref       string      `json:"ref"`
+	Title     string      `json:"title"`
+	Subtopics []seedTopic `json:"subtopics"`
+}
+
+// seedPoint is a point ready to be upserted, parents before their subtopics.
+type seedPoint struct {
+	id, parentID, ref, title, level string
+}
+
+// readSeed parses one seed file into its spec and points.
+func readSeed(name string) (*Spec, []seedPoint, error) {
+	data, err := seedFiles.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var f seedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	spec := &Spec{
+		ID:            strings.TrimSuffix(path.Base(name), ".json"),
+		Board:         f.Board,
+		Qualification: f.Qualification,
+		Subject:       f.Subject,
+		Code:          f.Code,
+		Title:         f.Title,
+	}
+	if spec.Board == "" || spec.Subject == "" || spec.Title == "" {
+		return nil, nil, fmt.Errorf("%s: board, subject and title are required", name)
+	}
+	var points []seedPoint
+	seen := map[string]bool{}
+	add := func(parentID, level string, t seedTopic) (string, error) {
+		if t.Ref == "" || t.Title == "" {
+			return "", fmt.Errorf("%s: every topic needs a ref and title", name)
+		}
+		if seen[t.Ref] {
+			return "", fmt.Errorf("%s: ref %s is used twice", name, t.Ref)
+		}
+		seen[t.Ref] = true
+		id := PointID(spec.ID, t.Ref)
+		points = append(points, seedPoint{id: id, parentID: parentID, ref: t.Ref, title: t.Title, level: level})
+		return id, nil
+	}
+	for _, topic := range f.Topics {
+		id, err := add("", Topic, topic)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, sub := range topic.Subtopics {
+			if _, err := add(id, Subtopic, sub); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return spec, points, nil
+}
+
+// Seed loads every seed file into specs and spec_points in one transaction, adding new
+// points and updating changed titles. Points removed from a file are kept so content
+// linked to them is not unlinked; delete them with a migration if that is intended.
+func Seed(ctx context.Context, db *sql.DB) error {
+	names, err := fs.Glob(seedFiles, "seed/*.json")
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	for _, name := range names {
+		spec, points, err := readSeed(name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO specs (id, board, qualification, subject, code, title, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (id) DO UPDATE SET board=$2, qualification=$3, subject=$4, code=$5, title=$6, updated_at=$7`,
+			spec.ID, spec.Board, spec.Qualification, spec.Subject, spec.Code, spec.Title, now)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for i, p := range points {
+			_, err = tx.ExecContext(ctx, `INSERT INTO spec_points (id, spec_id, parent_id, ref, title, level, ord)
+VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+ON CONFLICT (id) DO UPDATE SET parent_id=NULLIF($3, ''), title=$5, level=$6, ord=$7`,
+				p.id, spec.ID, p.parentID, p.ref, p.title, p.level, i)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", name, p.ref, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/config"
+)
+
+// ErrNotFound is returned by Get when no object exists under the key.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage stores user uploads and generated files under slash-separated keys such as
+// "avatars/<hash>_256.png". Keys are always generated by the server, never taken from clients.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New builds the storage backend selected by cfg.Backend ("local" or "s3").
+func New(cfg config.Storage) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		log.Infof("[storage.New] Using local storage in %s", cfg.Dir)
+		return NewLocal(cfg.Dir)
+	case "s3":
+		log.Infof("[storage.New] Using S3 storage at %s, bucket %s", cfg.S3.Endpoint, cfg.S3.Bucket)
+		return NewS3(S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			Region:    cfg.S3.Region,
+			UseSSL:    cfg.S3.UseSSL,
+		})
+	default:
+		return nil, errors.New("unknown storage backend " + cfg.Backend)
+	}
+}
@@ -0,0 +1,216 @@
+package study
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"KdnSite/internal/leaderboard"
+	"KdnSite/internal/problem"
+)
+
+const selectSession = `SELECT s.id, s.topic, COALESCE(s.tag_id, ''), COALESCE(t.name, ''), s.planned_minutes, s.status,
+	s.focus_seconds, s.pauses, s.resumed_at, s.timezone, to_char(s.day, 'YYYY-MM-DD'), s.started_at, s.ended_at
+FROM study_sessions s LEFT JOIN tags t ON t.id = s.tag_id`
+
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	var (
+		s                Session
+		resumedAt, ended sql.NullInt64
+	)
+	if err := row.Scan(&s.ID, &s.Topic, &s.TagID, &s.TagName, &s.PlannedMinutes, &s.Status,
+		&s.FocusSeconds, &s.Pauses, &resumedAt, &s.Timezone, &s.Day, &s.StartedAt, &ended); err != nil {
+		return nil, err
+	}
+	if resumedAt.Valid {
+		s.ResumedAt = &resumedAt.Int64
+	}
+	if ended.Valid {
+		s.EndedAt = &ended.Int64
+	}
+	return &s, nil
+}
+
+// listSessions returns the user's sessions started from from up to to, newest first.
+func listSessions(ctx context.Context, db *sql.DB, userID string, from, to int64) ([]*Session, error) {
+	rows, err := db.QueryContext(ctx, selectSession+`
+WHERE s.user_id=$1 AND s.started_at >= $2 AND s.started_at < $3 ORDER BY s.started_at DESC, s.id`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// timezone returns the timezone the user last studied in, or else the one they plan
+// their revision in, or UTC.
+func timezone(ctx context.Context, db *sql.DB, userID string) (string, error) {
+	var tz string
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(
+	(SELECT timezone FROM study_sessions WHERE user_id=$1 ORDER BY started_at DESC LIMIT 1),
+	(SELECT timezone FROM study_availability WHERE user_id=$1),
+	'UTC')`, userID).Scan(&tz)
+	return tz, err
+}
+
+// knownTimezone reports whether Postgres knows the named timezone.
+func knownTimezone(ctx context.Context, db *sql.DB, name string) (bool, error) {
+	var known bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name=$1)`, name).Scan(&known)
+	return known, err
+}
+
+// startSession saves a new running session. It fails with a conflict if the user
+// already has a session on the go, or a validation error if the tag is not theirs.
+func startSession(ctx context.Context, db *sql.DB, userID string, s *Session) error {
+	if s.TagID != "" {
+		err := db.QueryRowContext(ctx, `SELECT name FROM tags WHERE id=$1 AND owner_id=$2`, s.TagID, userID).Scan(&s.TagName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return problem.Validation(problem.FieldError{Field: "tag_id", Code: "not_found", Message: "is not one of your tags"})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO study_sessions
+(id, user_id, topic, tag_id, planned_minutes, status, focus_seconds, pauses, resumed_at, timezone, day, started_at)
+VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, 0, 0, $7, $8, $9, $10)`,
+		s.ID, userID, s.Topic, s.TagID, s.PlannedMinutes, s.Status, s.ResumedAt, s.Timezone, s.Day, s.StartedAt)
+	if pqErr := (*pq.Error)(nil); errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return problem.Conflict("Finish your current study session before starting another")
+	}
+	return err
+}
+
+// updateSession applies change to one of the user's sessions and saves it. change
+// returns a problem if the session cannot change that way.
+func updateSession(ctx context.Context, db *sql.DB, userID, id string, change func(*Session) error) (*Session, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	s, err := scanSession(tx.QueryRowContext(ctx, selectSession+` WHERE s.id=$1 AND s.user_id=$2 FOR UPDATE OF s`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	if err := change(s); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE study_sessions SET status=$3, focus_seconds=$4, pauses=$5, resumed_at=$6, ended_at=$7
+WHERE id=$1 AND user_id=$2`, id, userID, s.Status, s.FocusSeconds, s.Pauses, s.ResumedAt, s.EndedAt); err != nil {
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+// deleteSession deletes one of the user's sessions, returning whether it was finished.
+func deleteSession(ctx context.Context, db *sql.DB, userID, id string) (bool, error) {
+	var status string
+	err := db.QueryRowContext(ctx, `DELETE FROM study_sessions WHERE id=$1 AND user_id=$2 RETURNING status`, id, userID).Scan(&status)
+	return status == StatusFinished, err
+}
+
+// loadDays returns the minutes studied on each day, newest first.
+func loadDays(ctx context.Context, db *sql.DB, userID string) ([]Day, error) {
+	rows, err := db.QueryContext(ctx, `SELECT to_char(day, 'YYYY-MM-DD'), SUM(focus_seconds) / 60
+FROM study_sessions WHERE user_id=$1 AND status='finished'
+GROUP BY day ORDER BY day DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	days := []Day{}
+	for rows.Next() {
+		var d Day
+		if err := rows.Scan(&d.Date, &d.Minutes); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// Summarise returns the user's study time and streak, with the minutes studied on each
+// of the last days days.
+func Summarise(ctx context.Context, db *sql.DB, userID string, now time.Time, days int) (*Summary, error) {
+	tz, err := timezone(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	all, err := loadDays(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	n := now.In(loc)
+	today := time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, time.UTC)
+	since := today.AddDate(0, 0, -(days - 1)).Format(time.DateOnly)
+	week := today.AddDate(0, 0, -6).Format(time.DateOnly)
+	sum := &Summary{Timezone: tz, Days: []Day{}}
+	sum.Streak, sum.studiedOn = streak(all, today)
+	for _, d := range all {
+		sum.TotalMinutes += d.Minutes
+		if d.Date == today.Format(time.DateOnly) {
+			sum.TodayMinutes = d.Minutes
+		}
+		if d.Date >= week {
+			sum.WeekMinutes += d.Minutes
+		}
+		if d.Date >= since {
+			sum.Days = append(sum.Days, d)
+		}
+	}
+	return sum, nil
+}
+
+// TopicMinutes returns the minutes the user has studied each topic or tag, by name, in
+// sessions finished since since.
+func TopicMinutes(ctx context.Context, db *sql.DB, userID string, since int64) (map[string]int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT COALESCE(NULLIF(s.topic, ''), t.name, ''), SUM(s.focus_seconds) / 60
+FROM study_sessions s LEFT JOIN tags t ON t.id = s.tag_id
+WHERE s.user_id=$1 AND s.status='finished' AND s.started_at >= $2
+GROUP BY 1`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	minutes := map[string]int{}
+	for rows.Next() {
+		var (
+			name string
+			m    int
+		)
+		if err := rows.Scan(&name, &m); err != nil {
+			return nil, err
+		}
+		if name != "" {
+			minutes[name] += m
+		}
+	}
+	return minutes, rows.Err()
+}
+
+// refreshLeaderboard records the user's study time and streak on the leaderboard: a
+// point for every minute studied.
+func refreshLeaderboard(ctx context.Context, db *sql.DB, userID string, now time.Time) error {
+	sum, err := Summarise(ctx, db, userID, now, 1)
+	if err != nil {
+		return err
+	}
+	return leaderboard.Record(ctx, db, userID, sum.TotalMinutes, sum.Streak, sum.studiedOn, sum.Timezone)
+}
@@ -0,0 +1,259 @@
+package study
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/logging"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
+)
+
+// maxRange bounds the time GET /api/study-sessions can list, in seconds.
+const maxRange = 366 * 24 * 60 * 60
+
+// ListSessions handles GET /api/study-sessions
+func ListSessions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		now := time.Now().Unix()
+		to := now + 1
+		from := to - 30*24*60*60
+		var errs []problem.FieldError
+		for _, bound := range []struct {
+			param string
+			dst   *int64
+		}{{"from", &from}, {"to", &to}} {
+			if v := r.URL.Query().Get(bound.param); v != "" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					errs = append(errs, problem.FieldError{Field: bound.param, Code: "invalid", Message: "must be a Unix time in seconds"})
+					continue
+				}
+				*bound.dst = n
+			}
+		}
+		if len(errs) == 0 && (to <= from || to-from > maxRange) {
+			errs = append(errs, problem.FieldError{Field: "to", Code: "out_of_range", Message: "must be after from, and at most a year later"})
+		}
+		if len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		sessions, err := listSessions(r.Context(), db, userID, from, to)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[ListSessions] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		for _, s := range sessions {
+			s.FocusSeconds = s.focus(now)
+		}
+		writeJSON(w, http.StatusOK, sessions)
+	}
+}
+
+// StartSession handles POST /api/study-sessions
+func StartSession(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req StartRequest
+		if err := validate.DecodeJSON(w, r, 4<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		if req.Timezone == "" {
+			if req.Timezone, err = timezone(r.Context(), db, userID); err != nil {
+				logging.FromContext(r.Context()).Errorf("[StartSession] %v", err)
+				problem.Write(w, r, problem.Internal())
+				return
+			}
+		}
+		// The leaderboard works out streaks in Postgres, so the timezone must be one both know
+		loc, err := time.LoadLocation(req.Timezone)
+		known, dbErr := knownTimezone(r.Context(), db, req.Timezone)
+		if dbErr != nil {
+			logging.FromContext(r.Context()).Errorf("[StartSession] %v", dbErr)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if err != nil || !known {
+			problem.Write(w, r, problem.Validation(problem.FieldError{Field: "timezone", Code: "invalid_timezone", Message: "must be an IANA timezone such as Europe/London"}))
+			return
+		}
+		now := time.Now()
+		t := now.Unix()
+		s := Session{
+			ID:             uuid.NewString(),
+			Topic:          req.Topic,
+			TagID:          req.TagID,
+			PlannedMinutes: req.PlannedMinutes,
+			Status:         StatusRunning,
+			ResumedAt:      &t,
+			Timezone:       req.Timezone,
+			Day:            now.In(loc).Format(time.DateOnly),
+			StartedAt:      t,
+		}
+		if err := startSession(r.Context(), db, userID, &s); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, &s)
+	}
+}
+
+// PauseSession handles POST /api/study-sessions/{id}/pause
+func PauseSession(db *sql.DB) http.HandlerFunc {
+	return changeSession(db, func(s *Session, now int64) error {
+		if s.Status != StatusRunning {
+			return problem.Conflict("Only a running session can be paused")
+		}
+		s.FocusSeconds = s.focus(now)
+		s.ResumedAt = nil
+		s.Pauses++
+		s.Status = StatusPaused
+		return nil
+	})
+}
+
+// ResumeSession handles POST /api/study-sessions/{id}/resume
+func ResumeSession(db *sql.DB) http.HandlerFunc {
+	return changeSession(db, func(s *Session, now int64) error {
+		if s.Status != StatusPaused {
+			return problem.Conflict("Only a paused session can be resumed")
+		}
+		s.ResumedAt = &now
+		s.Status = StatusRunning
+		return nil
+	})
+}
+
+// FinishSession handles POST /api/study-sessions/{id}/finish
+func FinishSession(db *sql.DB) http.HandlerFunc {
+	return changeSession(db, func(s *Session, now int64) error {
+		if s.Status == StatusFinished {
+			return problem.Conflict("The session has already finished")
+		}
+		s.FocusSeconds = s.focus(now)
+		s.ResumedAt = nil
+		s.EndedAt = &now
+		s.Status = StatusFinished
+		return nil
+	})
+}
+
+// changeSession returns a handler that applies change to the session in the path.
+func changeSession(db *sql.DB, change func(s *Session, now int64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		now := time.Now()
+		s, err := updateSession(r.Context(), db, userID, r.PathValue("id"), func(s *Session) error {
+			return change(s, now.Unix())
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Study session not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if s.Status == StatusFinished {
+			if err := refreshLeaderboard(r.Context(), db, userID, now); err != nil {
+				logging.FromContext(r.Context()).Errorf("[changeSession] leaderboard: %v", err)
+			}
+		}
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+// DeleteSession handles DELETE /api/study-sessions/{id}, which also abandons a session
+// on the go.
+func DeleteSession(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		finished, err := deleteSession(r.Context(), db, userID, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound("Study session not found"))
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if finished {
+			if err := refreshLeaderboard(r.Context(), db, userID, time.Now()); err != nil {
+				logging.FromContext(r.Context()).Errorf("[DeleteSession] leaderboard: %v", err)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetSummary handles GET /api/study-sessions/summary
+func GetSummary(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			problem.Write(w, r, problem.MethodNotAllowed())
+			return
+		}
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		days := heatmapDays
+		if v := r.URL.Query().Get("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > heatmapDays {
+				problem.Write(w, r, problem.Validation(problem.FieldError{Field: "days", Code: "out_of_range", Message: "must be from 1 to " + strconv.Itoa(heatmapDays)}))
+				return
+			}
+			days = n
+		}
+		sum, err := Summarise(r.Context(), db, userID, time.Now(), days)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("[GetSummary] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		writeJSON(w, http.StatusOK, sum)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,138 @@
+// Package study records timed study sessions, Pomodoro style: the student starts a
+// session on a topic or a tagged set of revision items, pauses and resumes it, and
+// finishes it. Only the time spent studying counts, not the time paused.
+//
+// Finished sessions make up the student's study time and streak, which feed the
+// leaderboard, their progress and a heatmap of the days they studied.
+package study
+
+import (
+	"strings"
+	"time"
+	// Timezones resolve even where the system has no zoneinfo
+	_ "time/tzdata"
+
+	"KdnSite/internal/problem"
+)
+
+// Session statuses.
+const (
+	StatusRunning  = "running"
+	StatusPaused   = "paused"
+	StatusFinished = "finished"
+)
+
+const (
+	// DefaultMinutes is the length of a session when none is given, a Pomodoro.
+	DefaultMinutes = 25
+	// streakMinutes is how long a student must study on a day for it to count
+	// towards their streak.
+	streakMinutes = 10
+	// heatmapDays is how far back the heatmap goes by default, and at most.
+	heatmapDays = 366
+)
+
+// Session is a study session. FocusSeconds is the time studied so far, up to when the
+// session was read; while it runs, ResumedAt is when the current stretch began.
+type Session struct {
+	ID             string `json:"id"`
+	Topic          string `json:"topic,omitempty"`
+	TagID          string `json:"tag_id,omitempty"`
+	TagName        string `json:"tag_name,omitempty"`
+	PlannedMinutes int    `json:"planned_minutes"`
+	Status         string `json:"status"`
+	FocusSeconds   int64  `json:"focus_seconds"`
+	Pauses         int    `json:"pauses"`
+	ResumedAt      *int64 `json:"resumed_at"`
+	Timezone       string `json:"timezone"`
+	Day            string `json:"day"`
+	StartedAt      int64  `json:"started_at"`
+	EndedAt        *int64 `json:"ended_at"`
+}
+
+// StartRequest is the body of POST /api/study-sessions. Timezone defaults to the one
+// the student plans their revision in, or UTC.
+type StartRequest struct {
+	Topic          string `json:"topic" validate:"max=200"`
+	TagID          string `json:"tag_id" validate:"max=100"`
+	PlannedMinutes int    `json:"planned_minutes" validate:"min=0,max=120"`
+	Timezone       string `json:"timezone" validate:"max=64"`
+}
+
+// Validate checks that the session is about something and normalises the request.
+func (req *StartRequest) Validate() []problem.FieldError {
+	var errs []problem.FieldError
+	req.Topic = strings.TrimSpace(req.Topic)
+	if req.Topic == "" && req.TagID == "" {
+		errs = append(errs, problem.FieldError{Field: "topic", Code: "required", Message: "is required unless tag_id is given"})
+	}
+	if req.PlannedMinutes == 0 {
+		req.PlannedMinutes = DefaultMinutes
+	} else if req.PlannedMinutes < 5 {
+		errs = append(errs, problem.FieldError{Field: "planned_minutes", Code: "out_of_range", Message: "must be at least 5"})
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			errs = append(errs, problem.FieldError{Field: "timezone", Code: "invalid_timezone", Message: "must be an IANA timezone such as Europe/London"})
+		}
+	}
+	return errs
+}
+
+// Summary is the body of GET /api/study-sessions/summary. Minutes are of finished
+// sessions; TodayMinutes and WeekMinutes are for today and the six days before it, in
+// the student's timezone.
+type Summary struct {
+	Timezone     string `json:"timezone"`
+	Streak       int    `json:"streak"`
+	TodayMinutes int    `json:"today_minutes"`
+	WeekMinutes  int    `json:"week_minutes"`
+	TotalMinutes int    `json:"total_minutes"`
+	Days         []Day  `json:"days"`
+	// studiedOn is the last day that counted towards Streak.
+	studiedOn string
+}
+
+// Day is the time studied on a date, "YYYY-MM-DD".
+type Day struct {
+	Date    string `json:"date"`
+	Minutes int    `json:"minutes"`
+}
+
+// focus returns the seconds studied in the session up to now. A session counts for no
+// more than its planned length, so a timer left running does not keep counting.
+func (s *Session) focus(now int64) int64 {
+	focus := s.FocusSeconds
+	if s.Status == StatusRunning && s.ResumedAt != nil {
+		focus += max(0, now-*s.ResumedAt)
+	}
+	return min(focus, int64(s.PlannedMinutes)*60)
+}
+
+// streak counts the days in a row, ending today or yesterday, on which the student
+// studied long enough, and the last of them. days must be newest first, and today a
+// date in UTC.
+func streak(days []Day, today time.Time) (n int, last string) {
+	var next time.Time
+	for _, d := range days {
+		if d.Minutes < streakMinutes {
+			continue
+		}
+		date, err := time.Parse(time.DateOnly, d.Date)
+		if err != nil {
+			continue
+		}
+		if n == 0 {
+			// A streak not yet kept up today is still current until tomorrow
+			if date.Before(today.AddDate(0, 0, -1)) {
+				return 0, ""
+			}
+			last = d.Date
+		} else if !date.Equal(next) {
+			break
+		}
+		n++
+		next = date.AddDate(0, 0, -1)
+	}
+	return n, last
+}
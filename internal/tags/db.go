@@ -0,0 +1,239 @@
+package tags
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"KdnSite/internal/problem"
+)
+
+// ErrExists is returned by Rename when the user already has a tag with that slug.
+var ErrExists = errors.New("a tag with this name already exists")
+
+// Querier is satisfied by *sql.DB and *sql.Tx, so tags can be written in the same
+// transaction as the items they label.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Set replaces the tags on one item with names, creating any the user does not have.
+func Set(ctx context.Context, q Querier, t Target, ownerID, itemID string, names []string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM `+t.LinkTable+` WHERE resource_id=$1`, itemID); err != nil {
+		return err
+	}
+	return Attach(ctx, q, t, ownerID, []string{itemID}, names)
+}
+
+// Attach adds names to every item in itemIDs, creating any tags the user does not have.
+// The items must already be known to belong to ownerID.
+func Attach(ctx context.Context, q Querier, t Target, ownerID string, itemIDs, names []string) error {
+	tagIDs, err := ensure(ctx, q, ownerID, names)
+	if err != nil {
+		return err
+	}
+	if len(tagIDs) > 0 {
+		_, err = q.ExecContext(ctx, `INSERT INTO `+t.LinkTable+` (resource_id, tag_id)
+SELECT item, tag FROM unnest($1::text[]) item, unnest($2::text[]) tag
+ON CONFLICT DO NOTHING`, pq.Array(itemIDs), pq.Array(tagIDs))
+		if err != nil {
+			return err
+		}
+	}
+	return refresh(ctx, q, t, itemIDs)
+}
+
+// CheckLimit returns a validation problem if any of itemIDs now has more than
+// MaxPerItem tags, reported against ids[i] for the item at index i. Run it after
+// Attach, in the same transaction, which has locked the items.
+func CheckLimit(ctx context.Context, q Querier, t Target, itemIDs []string) error {
+	rows, err := q.QueryContext(ctx, `SELECT resource_id FROM `+t.LinkTable+` WHERE resource_id = ANY($1)
+GROUP BY resource_id HAVING COUNT(*) > $2`, pq.Array(itemIDs), MaxPerItem)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	over := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		over[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var errs []problem.FieldError
+	for i, id := range itemIDs {
+		if over[id] {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("ids[%d]", i), Code: "too_many_tags", Message: fmt.Sprintf("would have more than %d tags", MaxPerItem)})
+		}
+	}
+	if len(errs) > 0 {
+		return problem.Validation(errs...)
+	}
+	return nil
+}
+
+// Detach removes the tags with the slugs of names from every item in itemIDs. The
+// tags themselves are kept.
+func Detach(ctx context.Context, q Querier, t Target, ownerID string, itemIDs, names []string) error {
+	slugs := make([]string, len(names))
+	for i, name := range names {
+		slugs[i] = Slug(name)
+	}
+	_, err := q.ExecContext(ctx, `DELETE FROM `+t.LinkTable+` lt USING tags
+WHERE tags.id = lt.tag_id AND tags.owner_id = $1 AND tags.slug = ANY($2) AND lt.resource_id = ANY($3)`,
+		ownerID, pq.Array(slugs), pq.Array(itemIDs))
+	if err != nil {
+		return err
+	}
+	return refresh(ctx, q, t, itemIDs)
+}
+
+// ensure returns the IDs of the user's tags called names, creating those that are new.
+func ensure(ctx context.Context, q Querier, ownerID string, names []string) ([]string, error) {
+	now := time.Now().Unix()
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		var id string
+		// The no-op update makes RETURNING yield the existing row's ID on conflict
+		err := q.QueryRowContext(ctx, `INSERT INTO tags (id, owner_id, name, slug, created_at) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (owner_id, slug) DO UPDATE SET slug = EXCLUDED.slug RETURNING id`,
+			uuid.NewString(), ownerID, name, Slug(name), now).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// refresh rewrites tag_names, the copy of the tag names that search indexes.
+func refresh(ctx context.Context, q Querier, t Target, itemIDs []string) error {
+	_, err := q.ExecContext(ctx, `UPDATE `+t.Table+` SET tag_names = `+tagNames(t)+` WHERE id = ANY($1)`, pq.Array(itemIDs))
+	return err
+}
+
+// tagNames is the SQL for an item's tag_names, computed from its links.
+func tagNames(t Target) string {
+	return `COALESCE((SELECT string_agg(tags.name, ', ' ORDER BY tags.name) FROM ` + t.LinkTable + ` lt
+	JOIN tags ON tags.id = lt.tag_id WHERE lt.resource_id = ` + t.Table + `.id), '')`
+}
+
+// Load returns the tag names on each of itemIDs, sorted by name.
+func Load(ctx context.Context, q Querier, t Target, itemIDs []string) (map[string][]string, error) {
+	byItem := make(map[string][]string, len(itemIDs))
+	if len(itemIDs) == 0 {
+		return byItem, nil
+	}
+	rows, err := q.QueryContext(ctx, `SELECT lt.resource_id, tags.name FROM `+t.LinkTable+` lt JOIN tags ON tags.id = lt.tag_id
+WHERE lt.resource_id = ANY($1) ORDER BY tags.name`, pq.Array(itemIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item, name string
+		if err := rows.Scan(&item, &name); err != nil {
+			return nil, err
+		}
+		byItem[item] = append(byItem[item], name)
+	}
+	return byItem, rows.Err()
+}
+
+// List returns the user's tags by name, with how many items each is attached to.
+func List(ctx context.Context, db *sql.DB, ownerID string) ([]Tag, error) {
+	rows, err := db.QueryContext(ctx, `SELECT t.id, t.name, t.slug, t.created_at,
+	(SELECT COUNT(*) FROM revision_resource_tags WHERE tag_id = t.id) + (SELECT COUNT(*) FROM resource_tags WHERE tag_id = t.id)
+FROM tags t WHERE t.owner_id=$1 ORDER BY lower(t.name), t.id`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug, &t.CreatedAt, &t.Count); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// Rename changes the name of one of the user's tags. It returns sql.ErrNoRows if the
+// tag does not exist and ErrExists if another tag already has the new slug.
+func Rename(ctx context.Context, db *sql.DB, ownerID, id, name string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE tags SET name=$1, slug=$2 WHERE id=$3 AND owner_id=$4`, name, Slug(name), id, ownerID)
+	if pqErr := (*pq.Error)(nil); errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrExists
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := refreshTagged(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes one of the user's tags from every item and then deletes it. It returns
+// sql.ErrNoRows if the tag does not exist.
+func Delete(ctx context.Context, db *sql.DB, ownerID, id string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// The links go with the tag, so note which items to refresh first
+	items := make([]pq.StringArray, len(targets))
+	for i, t := range targets {
+		err := tx.QueryRowContext(ctx, `SELECT COALESCE(array_agg(resource_id), '{}') FROM `+t.LinkTable+` WHERE tag_id=$1`, id).Scan(&items[i])
+		if err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id=$1 AND owner_id=$2`, id, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	for i, t := range targets {
+		if err := refresh(ctx, tx, t, items[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// refreshTagged rewrites tag_names on every item that has the tag.
+func refreshTagged(ctx context.Context, q Querier, tagID string) error {
+	for _, t := range targets {
+		_, err := q.ExecContext(ctx, `UPDATE `+t.Table+` SET tag_names = `+tagNames(t)+`
+WHERE id IN (SELECT resource_id FROM `+t.LinkTable+` WHERE tag_id=$1)`, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package tags
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"KdnSite/internal/auth"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
+)
+
+// RenameRequest is the body of PATCH /api/tags/{id}.
+type RenameRequest struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+// ListTags handles GET /api/tags
+func ListTags(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		list, err := List(r.Context(), db, userID)
+		if err != nil {
+			log.Errorf("[ListTags] %v", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// RenameTag handles PATCH /api/tags/{id}
+func RenameTag(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		var req RenameRequest
+		if err := validate.DecodeJSON(w, r, 4<<10, &req); err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		names, errs := Normalize("name", []string{req.Name})
+		if len(errs) > 0 {
+			errs[0].Field = "name"
+			problem.Write(w, r, problem.Validation(errs...))
+			return
+		}
+		switch err := Rename(r.Context(), db, userID, r.PathValue("id"), names[0]); {
+		case errors.Is(err, sql.ErrNoRows):
+			problem.Write(w, r, problem.NotFound("Tag not found"))
+		case errors.Is(err, ErrExists):
+			problem.Write(w, r, problem.Conflict("You already have a tag with this name."))
+		case err != nil:
+			log.Errorf("[RenameTag] %v", err)
+			problem.Write(w, r, problem.Internal())
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// DeleteTag handles DELETE /api/tags/{id}
+func DeleteTag(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			problem.Write(w, r, problem.Unauthorized())
+			return
+		}
+		switch err := Delete(r.Context(), db, userID, r.PathValue("id")); {
+		case errors.Is(err, sql.ErrNoRows):
+			problem.Write(w, r, problem.NotFound("Tag not found"))
+		case err != nil:
+			log.Errorf("[DeleteTag] %v", err)
+			problem.Write(w, r, problem.Internal())
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
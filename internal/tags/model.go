@@ -0,0 +1,98 @@
+// Package tags lets students label their revision resources and resources with their
+// own tags. A tag belongs to one user and can be attached to items of either kind;
+// tags are matched by slug, so "Cell Biology" and "cell biology" are the same tag.
+package tags
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"KdnSite/internal/problem"
+)
+
+const (
+	// MaxPerItem bounds how many tags one item may have.
+	MaxPerItem = 20
+	// MaxNameLength bounds a tag name in characters.
+	MaxNameLength = 50
+)
+
+// Tag is one of a user's tags, with the number of items it is attached to.
+type Tag struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	Count     int    `json:"count"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Target is a kind of item that can be tagged. Table and LinkTable come only from the
+// values below, so they are safe to interpolate into SQL.
+type Target struct {
+	Table     string // the items, which have id, owner_id and tag_names columns
+	LinkTable string // (resource_id, tag_id) pairs
+}
+
+var (
+	RevisionResources = Target{Table: "revision_resources", LinkTable: "revision_resource_tags"}
+	Resources         = Target{Table: "resources", LinkTable: "resource_tags"}
+
+	targets = []Target{RevisionResources, Resources}
+)
+
+// Filter returns a pagination filter condition matching items of t that have the tag
+// whose slug is the filter value. The item table must not be aliased in the query.
+func (t Target) Filter() string {
+	return `EXISTS (SELECT 1 FROM ` + t.LinkTable + ` lt JOIN tags ON tags.id = lt.tag_id WHERE lt.resource_id = ` + t.Table + `.id AND tags.slug = %s)`
+}
+
+// Slug returns the key a tag name is matched by: lower case, with every run of
+// characters other than letters and digits turned into a single hyphen.
+func Slug(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// Normalize trims and de-duplicates names by slug, keeping the first spelling of
+// each, and reports invalid names against field.
+func Normalize(field string, names []string) ([]string, []problem.FieldError) {
+	var (
+		out  []string
+		errs []problem.FieldError
+		seen = map[string]bool{}
+	)
+	for i, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		slug := Slug(name)
+		switch {
+		case slug == "":
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Code: "invalid_tag", Message: "must contain a letter or digit"})
+			continue
+		case utf8.RuneCountInString(name) > MaxNameLength:
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Code: "too_long", Message: fmt.Sprintf("must be at most %d characters", MaxNameLength)})
+			continue
+		case seen[slug]:
+			continue
+		}
+		seen[slug] = true
+		out = append(out, name)
+	}
+	if len(out) > MaxPerItem {
+		errs = append(errs, problem.FieldError{Field: field, Code: "too_long", Message: fmt.Sprintf("must be at most %d items", MaxPerItem)})
+	}
+	return out, errs
+}
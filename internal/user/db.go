@@ -16,6 +16,6 @@ func GetUserProfile(ctx context.Context, db *sql.DB, id string) (*UserProfile, e
 }
 
 func UpdateUserProfile(ctx context.Context, db *sql.DB, u *UserProfile) error {
-	_, err := db.ExecContext(ctx, `UPDATE users SET username=$1, avatar_url=$2 WHERE id=$3`, u.Username, u.AvatarURL, u.ID)
+	_, err := db.ExecContext(ctx, `UPDATE users SET username=$1 WHERE id=$2`, u.Username, u.ID)
 	return err
 }
@@ -2,6 +2,8 @@ package user
 
 import (
 	"KdnSite/internal/auth"
+	"KdnSite/internal/problem"
+	"KdnSite/internal/validate"
 	"database/sql"
 	"encoding/json"
 	"net/http"
@@ -14,7 +16,7 @@ func GetProfile(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
 		profile, err := GetUserProfile(r.Context(), db, userID)
@@ -35,12 +37,12 @@ func GetProfile(db *sql.DB) http.HandlerFunc {
 			}
 			_, err := db.ExecContext(r.Context(), `INSERT INTO users (id, email, username, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`, userID, email, username, time.Now().Unix())
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				problem.Write(w, r, problem.Internal())
 				return
 			}
 			profile, err = GetUserProfile(r.Context(), db, userID)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				problem.Write(w, r, problem.Internal())
 				return
 			}
 		}
@@ -54,17 +56,17 @@ func UpdateProfile(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Write(w, r, problem.Unauthorized())
 			return
 		}
-		var u UserProfile
-		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		var req UpdateProfileRequest
+		if err := validate.DecodeJSON(w, r, MaxProfileBodyBytes, &req); err != nil {
+			problem.Error(w, r, err)
 			return
 		}
-		u.ID = userID
+		u := UserProfile{ID: userID, Username: strings.TrimSpace(req.Username)}
 		if err := UpdateUserProfile(r.Context(), db, &u); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Write(w, r, problem.Internal())
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -7,3 +7,12 @@ type UserProfile struct {
 	CreatedAt int64
 	AvatarURL string
 }
+
+// MaxProfileBodyBytes caps the size of a profile update.
+const MaxProfileBodyBytes = 4 << 10
+
+// UpdateProfileRequest is the body of POST /api/user/profile. The avatar is changed
+// through the upload endpoint, never set directly.
+type UpdateProfileRequest struct {
+	Username string `json:"username" validate:"required,max=50"`
+}
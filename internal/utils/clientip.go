@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the IPs or CIDRs (e.g. "10.0.0.0/8", "172.17.0.1") whose
+// X-Forwarded-For headers are believed. It is called once at startup.
+func SetTrustedProxies(entries []string) {
+	trustedProxies = nil
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Warnf("[SetTrustedProxies] Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+			continue
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made the request. X-Forwarded-For
+// is only consulted when the direct peer is a trusted proxy, and is walked from the
+// right so a client cannot spoof its address by prepending entries.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !isTrustedProxy(peer) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return hop
+		}
+	}
+	return host
+}
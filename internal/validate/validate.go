@@ -0,0 +1,224 @@
+// Package validate decodes JSON request bodies strictly and checks them against
+// declarative `validate` struct tags, reporting every failure as a problem detail.
+//
+// Rules are comma separated and apply to the field's JSON name in error responses:
+//
+//	required        the value must not be empty (whitespace-only strings are empty)
+//	min=N, max=N    length in characters for strings, items for slices, value for numbers
+//	oneof=a b c     the string must be one of the space separated values
+//	json            the string must be valid JSON
+//
+// Rules other than required are skipped for empty values, so optional fields only
+// need to be valid when they are sent.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"KdnSite/internal/problem"
+)
+
+// DecodeJSON reads a single JSON object of at most maxBytes from the request body into
+// dst, rejecting unknown fields and trailing data, and then validates dst. The returned
+// error is always a *problem.Problem ready for problem.Error.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, maxBytes int64, dst any) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "application/json" {
+			return problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia, "Send the request body as application/json.")
+		}
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return decodeProblem(err, maxBytes)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return decodeProblem(err, maxBytes)
+		}
+		return problem.BadRequest("The request body must contain a single JSON object.")
+	}
+	if errs := Struct(dst); len(errs) > 0 {
+		return problem.Validation(errs...)
+	}
+	return nil
+}
+
+// decodeProblem turns a json.Decoder error into the matching problem.
+func decodeProblem(err error, maxBytes int64) *problem.Problem {
+	var (
+		maxErr    *http.MaxBytesError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxErr):
+		return problem.PayloadTooLarge(fmt.Sprintf("The request body must be at most %d bytes.", maxBytes))
+	case errors.Is(err, io.EOF):
+		return problem.BadRequest("The request body is empty.")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return problem.BadRequest("The request body is not complete JSON.")
+	case errors.As(err, &syntaxErr):
+		return problem.BadRequest(fmt.Sprintf("The request body is not valid JSON (at byte %d).", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		return problem.Validation(problem.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: "must be a " + jsonKind(typeErr.Type),
+		})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return problem.Validation(problem.FieldError{Field: field, Code: "unknown", Message: "is not a recognised field"})
+	default:
+		return problem.BadRequest("The request body could not be read.")
+	}
+}
+
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "whole number"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "non-negative whole number"
+	default:
+		return "number"
+	}
+}
+
+// Struct checks the `validate` tags of v, which must be a struct or pointer to one,
+// and returns a FieldError for every failed rule in field order.
+func Struct(v any) []problem.FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []problem.FieldError
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag, ok := f.Tag.Lookup("validate")
+		if !ok || !f.IsExported() {
+			continue
+		}
+		if fe, failed := checkField(fieldName(f), rv.Field(i), tag); failed {
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+func fieldName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+// checkField applies the rules in tag to fv and reports the first one that fails.
+func checkField(name string, fv reflect.Value, tag string) (problem.FieldError, bool) {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			if hasRule(tag, "required") {
+				return problem.FieldError{Field: name, Code: "required", Message: "is required"}, true
+			}
+			return problem.FieldError{}, false
+		}
+		fv = fv.Elem()
+	}
+	empty := isEmpty(fv)
+	for _, rule := range strings.Split(tag, ",") {
+		rule, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if rule == "required" {
+			if empty {
+				return problem.FieldError{Field: name, Code: "required", Message: "is required"}, true
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+		switch rule {
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad %s rule on %s: %q", rule, name, arg))
+			}
+			size, unit := measure(fv)
+			if rule == "min" && size < float64(n) {
+				return problem.FieldError{Field: name, Code: "too_short", Message: fmt.Sprintf("must be at least %d%s", n, unit)}, true
+			}
+			if rule == "max" && size > float64(n) {
+				return problem.FieldError{Field: name, Code: "too_long", Message: fmt.Sprintf("must be at most %d%s", n, unit)}, true
+			}
+		case "oneof":
+			allowed := strings.Fields(arg)
+			if !slices.Contains(allowed, fv.String()) {
+				return problem.FieldError{Field: name, Code: "invalid_choice", Message: "must be one of " + strings.Join(allowed, ", ")}, true
+			}
+		case "json":
+			if !json.Valid([]byte(fv.String())) {
+				return problem.FieldError{Field: name, Code: "invalid_json", Message: "must be valid JSON"}, true
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q on %s", rule, name))
+		}
+	}
+	return problem.FieldError{}, false
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// measure returns the size min and max compare against, with the unit for messages.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	default:
+		return 0, ""
+	}
+}